@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Message is one parsed message from a local archive
+type Message struct {
+	Source    string // File, or file and message number for mbox
+	MessageID string // As in the header, brackets included, like IMAP's
+	From      string
+	Subject   string
+	Date      time.Time
+	Flags     []string
+	Body      string
+}
+
+// Archive is a local mail store that can be read without a network
+type Archive interface {
+	// Walk calls fn for every message, stopping at the first error fn
+	// returns. Messages that can't be read are logged and skipped.
+	Walk(fn func(*Message) error) error
+}
+
+// Open opens path as a Maildir when it is a directory, otherwise as an
+// mbox file. A leading ~ is expanded to the home directory.
+func Open(path string) (Archive, error) {
+	path, err := ExpandHome(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open archive: %w", err)
+	}
+	if info.IsDir() {
+		return OpenMaildir(path)
+	}
+	return &Mbox{Path: path}, nil
+}
+
+// ExpandHome expands a leading ~ to the home directory
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// parse reads one message with enmime. fallback is used when the message
+// has no usable Date header.
+func parse(r io.Reader, source string, fallback time.Time) (*Message, *enmime.Envelope, error) {
+	env, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	msg := &Message{
+		Source:    source,
+		MessageID: strings.TrimSpace(env.GetHeader("Message-Id")),
+		From:      "Unknown",
+		Subject:   env.GetHeader("Subject"),
+		Date:      fallback,
+		Body:      env.Text,
+	}
+
+	if from, err := env.AddressList("From"); err == nil && len(from) > 0 {
+		if from[0].Name != "" {
+			msg.From = fmt.Sprintf("%s <%s>", from[0].Name, from[0].Address)
+		} else {
+			msg.From = from[0].Address
+		}
+	}
+	if date, err := env.Date(); err == nil {
+		msg.Date = date
+	}
+
+	return msg, env, nil
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const goodMessage = "From: Ann <ann@example.org>\r\nSubject: Hello\r\nMessage-ID: <1@example.org>\r\nDate: Mon, 3 Mar 2025 09:00:00 +0000\r\n\r\nHi\r\n"
+
+// badMessage has no header, which can't be parsed
+const badMessage = "garbage\r\n"
+
+func collect(t *testing.T, a Archive) []*Message {
+	t.Helper()
+	var messages []*Message
+	if err := a.Walk(func(msg *Message) error {
+		messages = append(messages, msg)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	return messages
+}
+
+func TestMaildirSkipsUnreadableMessages(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{"1.bad:2,": badMessage, "2.good:2,S": goodMessage}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, "cur", name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := OpenMaildir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := collect(t, m)
+	if len(messages) != 1 || messages[0].Subject != "Hello" {
+		t.Fatalf("read %d messages, want only the good one", len(messages))
+	}
+	if messages[0].MessageID != "<1@example.org>" {
+		t.Errorf("MessageID = %q, want it as in the header", messages[0].MessageID)
+	}
+}
+
+func TestMboxSkipsUnreadableMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.mbox")
+	content := "From a@example.org Mon Mar  3 09:00:00 2025\n" + badMessage + "\n" +
+		"From b@example.org Mon Mar  3 10:00:00 2025\n" + goodMessage + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := collect(t, &Mbox{Path: path})
+	if len(messages) != 1 || messages[0].Subject != "Hello" {
+		t.Fatalf("read %d messages, want only the good one", len(messages))
+	}
+	if messages[0].Source != path+"#2" {
+		t.Errorf("Source = %q, want the second message", messages[0].Source)
+	}
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// maildirFlags maps Maildir info letters to IMAP flags
+var maildirFlags = map[byte]string{
+	'D': imap.DraftFlag,
+	'F': imap.FlaggedFlag,
+	'R': imap.AnsweredFlag,
+	'S': imap.SeenFlag,
+	'T': imap.DeletedFlag,
+}
+
+// Maildir reads the messages in one Maildir folder
+type Maildir struct {
+	Path string
+}
+
+// OpenMaildir checks that path looks like a Maildir
+func OpenMaildir(path string) (*Maildir, error) {
+	if _, err := os.Stat(filepath.Join(path, "cur")); err != nil {
+		return nil, fmt.Errorf("%s is not a maildir: %w", path, err)
+	}
+	return &Maildir{Path: path}, nil
+}
+
+// Walk reads the messages in cur and new, in file name order
+func (m *Maildir) Walk(fn func(*Message) error) error {
+	for _, sub := range []string{"cur", "new"} {
+		dir := filepath.Join(m.Path, sub)
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read maildir: %w", err)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			msg, err := m.read(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				log.Printf("Skipping unreadable message: %v", err)
+				continue
+			}
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// read parses one message file, taking its flags from the file name
+func (m *Maildir) read(path string) (*Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, _, err := parse(f, path, info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, letters, ok := strings.Cut(filepath.Base(path), ":2,"); ok {
+		for i := 0; i < len(letters); i++ {
+			if flag, ok := maildirFlags[letters[i]]; ok {
+				msg.Flags = append(msg.Flags, flag)
+			}
+		}
+	}
+	return msg, nil
+}
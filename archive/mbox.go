@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// fromLineLayouts are the date formats seen after the sender in "From "
+// separator lines, including the one Google Takeout writes
+var fromLineLayouts = []string{
+	time.ANSIC,
+	"Mon Jan 02 15:04:05 -0700 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+}
+
+// Mbox reads an mbox file one message at a time, so exports of any size
+// can be searched
+type Mbox struct {
+	Path string
+}
+
+// Walk reads every message in the file. Lines escaped as ">From " (mboxrd
+// and mboxo) are unescaped.
+func (m *Mbox) Walk(fn func(*Message) error) error {
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return fmt.Errorf("unable to open mbox: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+
+	var buf bytes.Buffer
+	var fromLine string
+	count := 0
+	blank := true // Separators must follow a blank line or start the file
+
+	flush := func() error {
+		if fromLine == "" {
+			return nil
+		}
+		count++
+		msg, err := m.parse(&buf, count, fromLine)
+		buf.Reset()
+		if err != nil {
+			log.Printf("Skipping unreadable message: %v", err)
+			return nil
+		}
+		return fn(msg)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			if blank && strings.HasPrefix(line, "From ") {
+				if err := flush(); err != nil {
+					return err
+				}
+				fromLine = strings.TrimRight(line, "\r\n")
+			} else if fromLine != "" {
+				if unescaped := strings.TrimLeft(line, ">"); len(unescaped) < len(line) && strings.HasPrefix(unescaped, "From ") {
+					line = line[1:]
+				}
+				buf.WriteString(line)
+			}
+			blank = strings.TrimRight(line, "\r\n") == ""
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read mbox: %w", err)
+		}
+	}
+}
+
+// parse parses one message, taking its flags from the Status headers
+// mail clients write into mbox files
+func (m *Mbox) parse(r io.Reader, n int, fromLine string) (*Message, error) {
+	msg, env, err := parse(r, fmt.Sprintf("%s#%d", m.Path, n), fromLineDate(fromLine))
+	if err != nil {
+		return nil, err
+	}
+
+	status := env.GetHeader("Status") + env.GetHeader("X-Status")
+	if strings.Contains(status, "R") {
+		msg.Flags = append(msg.Flags, imap.SeenFlag)
+	}
+	if strings.Contains(status, "A") {
+		msg.Flags = append(msg.Flags, imap.AnsweredFlag)
+	}
+	if strings.Contains(status, "F") {
+		msg.Flags = append(msg.Flags, imap.FlaggedFlag)
+	}
+	return msg, nil
+}
+
+// fromLineDate reads the date from a "From sender date" separator line
+func fromLineDate(line string) time.Time {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 3 {
+		return time.Time{}
+	}
+	date := strings.Join(strings.Fields(parts[2]), " ")
+	for _, layout := range fromLineLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
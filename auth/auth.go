@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -46,26 +47,26 @@ func (u *Username) SetUserName() error {
 
 const tokenFile = "token.json"
 
+// Output is where sign-in progress is printed
+var Output io.Writer = os.Stdout
+
+// Account is the Gmail address the OAuth2 token is authorized for
+const Account = "nko3@njit.edu"
+
 // Authenticate using OAuth2 with credentials.json
 // Returns a v1 *client.Client
 func Authenticate() (*client.Client, error) {
-	// 1. Read credentials.json
-	b, err := os.ReadFile("credentials.json")
-	if err != nil {
-		return nil, fmt.Errorf("unable to read credentials.json: %w", err)
-	}
-
-	// 2. Parse the credentials
-	config, err := google.ConfigFromJSON(b, "https://mail.google.com/")
+	// 1. Read and parse credentials.json
+	config, err := loadConfig()
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse credentials: %w", err)
+		return nil, err
 	}
 
-	// 3. Get token (either from file or new auth)
+	// 2-3. Get token (either from file or new auth)
 	token := getToken(config)
 
 	// 4. Connect to Gmail IMAP (v1 Style)
-	fmt.Println("Connecting to Gmail...")
+	fmt.Fprintln(Output, "Connecting to Gmail...")
 
 	// In v1, we Dial directly from the client package
 	c, err := client.DialTLS("imap.gmail.com:993", nil)
@@ -75,10 +76,10 @@ func Authenticate() (*client.Client, error) {
 
 	// 5. Authenticate with OAuth2
 	// We use the XOAUTH2 mechanism via the SASL library
-	fmt.Println("Authenticating with OAuth2...")
+	fmt.Fprintln(Output, "Authenticating with OAuth2...")
 
 	saslClient := sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
-		Username: "nko3@njit.edu", // <--- Ensure this matches the authenticated user
+		Username: Account, // <--- Ensure this matches the authenticated user
 		Token:    token.AccessToken,
 	})
 
@@ -88,10 +89,39 @@ func Authenticate() (*client.Client, error) {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
-	fmt.Println("✓ Authenticated successfully")
+	fmt.Fprintln(Output, "✓ Authenticated successfully")
 	return c, nil
 }
 
+// Token returns a valid access token for Account, refreshing the cached
+// token when it has expired
+func Token() (string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := config.TokenSource(context.Background(), getToken(config)).Token()
+	if err != nil {
+		return "", fmt.Errorf("unable to refresh token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// loadConfig reads the OAuth2 client config from credentials.json
+func loadConfig() (*oauth2.Config, error) {
+	b, err := os.ReadFile("credentials.json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials.json: %w", err)
+	}
+
+	config, err := google.ConfigFromJSON(b, "https://mail.google.com/")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %w", err)
+	}
+	return config, nil
+}
+
 // getToken retrieves a token from file or initiates OAuth flow
 func getToken(config *oauth2.Config) *oauth2.Token {
 	token, err := tokenFromFile(tokenFile)
@@ -130,8 +160,8 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 
 	// Generate auth URL
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Opening browser for authentication...\n")
-	fmt.Printf("If browser doesn't open, go to:\n%v\n\n", authURL)
+	fmt.Fprintf(Output, "Opening browser for authentication...\n")
+	fmt.Fprintf(Output, "If browser doesn't open, go to:\n%v\n\n", authURL)
 
 	openBrowser(authURL)
 
@@ -160,7 +190,7 @@ func openBrowser(url string) {
 		err = fmt.Errorf("unsupported platform")
 	}
 	if err != nil {
-		fmt.Println("Could not open browser automatically. Please use the link above.")
+		fmt.Fprintln(Output, "Could not open browser automatically. Please use the link above.")
 	}
 }
 
@@ -0,0 +1,538 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+	"github.com/PlantingTrees/intent/schedule"
+)
+
+// ParserFunc builds a parser with the current configuration, such as
+// saved macros. It is called again on SIGHUP.
+type ParserFunc func() (*engine.Parser, error)
+
+// Daemon holds the mail sessions, listeners and schedules between CLI and
+// REPL runs, and takes commands over a Unix socket
+type Daemon struct {
+	socket      string
+	stateFile   string // Registered listeners, restored on start and reload
+	openSession engine.SessionFunc
+	newParser   ParserFunc
+	jobs        *schedule.Store
+	jitter      time.Duration
+
+	mu     sync.Mutex
+	parser *engine.Parser
+
+	// Each client connection, and the scheduled jobs, run commands on a
+	// session of their own, so one's results never answer another's
+	// "reply to 2"
+	jobSession session
+	clientsMu  sync.Mutex
+	clients    map[net.Conn]bool
+
+	listenersMu sync.Mutex
+	listeners   map[string]*listener
+	nextID      int
+	hits        []Hit // The latest messages listeners matched
+	hitSeq      int
+
+	wg      sync.WaitGroup
+	started time.Time
+}
+
+// maxHits is how many listener hits are kept for clients to read
+const maxHits = 100
+
+// session is an executor, opened when its first command runs, that keeps
+// its search results between commands. It runs them one at a time.
+type session struct {
+	mu       sync.Mutex
+	executor *engine.Executor
+	closer   func()
+}
+
+// close closes the session's connection, if it was opened
+func (s *session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closer != nil {
+		s.closer()
+	}
+	s.executor, s.closer = nil, nil
+}
+
+// listener is a running listen command
+type listener struct {
+	info   Listener
+	cancel context.CancelFunc
+}
+
+// DefaultSocket is where the daemon listens unless told otherwise: the
+// user's runtime directory, or the config directory without one
+func DefaultSocket() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "intent.sock"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "intent", "intent.sock"), nil
+}
+
+// New creates a daemon serving on socket. Listeners it is asked to run are
+// kept in stateFile, so they survive restarts.
+func New(socket, stateFile string, session engine.SessionFunc, newParser ParserFunc) *Daemon {
+	return &Daemon{
+		socket:      socket,
+		stateFile:   stateFile,
+		openSession: session,
+		newParser:   newParser,
+		clients:     make(map[net.Conn]bool),
+		listeners:   make(map[string]*listener),
+	}
+}
+
+// SetSchedule makes the daemon run the jobs in store
+func (d *Daemon) SetSchedule(store *schedule.Store, jitter time.Duration) {
+	d.jobs = store
+	d.jitter = jitter
+}
+
+// Run serves until SIGTERM or SIGINT, then stops every listener and
+// closes the sessions. SIGHUP reloads the configuration.
+func (d *Daemon) Run() error {
+	d.started = time.Now()
+
+	ln, err := d.listen()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(d.socket)
+
+	if err := d.reload(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if d.jobs != nil {
+		scheduler := schedule.New(d.jobs, d.runJob)
+		scheduler.SetJitter(d.jitter)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			d.wg.Add(1)
+			go d.serve(conn)
+		}
+	}()
+	log.Printf("Daemon listening on %s", d.socket)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			log.Println("Reloading configuration")
+			if err := d.reload(); err != nil {
+				log.Printf("Reload failed: %v", err)
+			}
+			continue
+		}
+		log.Printf("Received %s, shutting down", sig)
+		break
+	}
+	signal.Stop(signals)
+
+	ln.Close()
+	cancel()
+	d.stopAll()
+	d.clientsMu.Lock()
+	for conn := range d.clients {
+		conn.Close()
+	}
+	d.clientsMu.Unlock()
+	d.wg.Wait()
+	d.jobSession.close()
+	return nil
+}
+
+// serve answers a client's calls on a session of its own, closed when the
+// client disconnects
+func (d *Daemon) serve(conn net.Conn) {
+	defer d.wg.Done()
+	d.clientsMu.Lock()
+	d.clients[conn] = true
+	d.clientsMu.Unlock()
+
+	s := &Service{d: d, session: &session{}}
+	defer s.session.close()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Daemon", s); err != nil {
+		log.Printf("Client not served: %v", err)
+		conn.Close()
+	} else {
+		server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+
+	d.clientsMu.Lock()
+	delete(d.clients, conn)
+	d.clientsMu.Unlock()
+}
+
+// listen opens the control socket, replacing one left by a crashed daemon
+func (d *Daemon) listen() (net.Listener, error) {
+	if conn, err := net.Dial("unix", d.socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already running on %s", d.socket)
+	}
+	os.Remove(d.socket)
+
+	if err := os.MkdirAll(filepath.Dir(d.socket), 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create socket directory: %w", err)
+	}
+	ln, err := net.Listen("unix", d.socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", d.socket, err)
+	}
+	// Only the user may send commands
+	if err := os.Chmod(d.socket, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// reload rebuilds the parser and starts the saved listeners that aren't
+// running, stopping those that were removed from the file
+func (d *Daemon) reload() error {
+	parser, err := d.newParser()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.parser = parser
+	d.mu.Unlock()
+
+	saved, err := d.loadListeners()
+	if err != nil {
+		return err
+	}
+
+	// Failed listeners are dropped here and started again below
+	d.listenersMu.Lock()
+	running := make(map[string]bool)
+	for id, l := range d.listeners {
+		if l.info.Status == "running" {
+			running[l.info.Query] = true
+		} else {
+			delete(d.listeners, id)
+		}
+	}
+	d.listenersMu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, query := range saved {
+		wanted[query] = true
+		if running[query] {
+			continue
+		}
+		if _, err := d.startListener(query, false); err != nil {
+			log.Printf("Listener %q not started: %v", query, err)
+		}
+	}
+
+	for _, l := range d.Listeners() {
+		if !wanted[l.Query] {
+			d.stopListener(l.ID, false)
+		}
+	}
+	return nil
+}
+
+// Listeners returns the running listeners, oldest first
+func (d *Daemon) Listeners() []Listener {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+
+	list := make([]Listener, 0, len(d.listeners))
+	for _, l := range d.listeners {
+		list = append(list, l.info)
+	}
+	sortListeners(list)
+	return list
+}
+
+// startListener parses and starts a listen command on its own connection
+func (d *Daemon) startListener(query string, save bool) (Listener, error) {
+	d.mu.Lock()
+	intent, err := d.parser.Parse(query)
+	d.mu.Unlock()
+	if err != nil {
+		return Listener{}, err
+	}
+	if intent.Command != engine.CommandListen {
+		return Listener{}, fmt.Errorf("%s is not a listen command", intent.Command)
+	}
+
+	executor, closer, err := d.openSession()
+	if err != nil {
+		return Listener{}, err
+	}
+	if err := executor.Validate(intent); err != nil {
+		closer()
+		return Listener{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.listenersMu.Lock()
+	d.nextID++
+	l := &listener{
+		info: Listener{
+			ID:      strconv.Itoa(d.nextID),
+			Query:   intent.String(),
+			Started: time.Now(),
+			Status:  "running",
+		},
+		cancel: cancel,
+	}
+	d.listeners[l.info.ID] = l
+	d.listenersMu.Unlock()
+
+	id := l.info.ID
+	executor.SetListenHook(func(msg engine.Email) { d.addHit(id, msg) })
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer closer()
+
+		err := executor.Listen(ctx, intent)
+		if ctx.Err() != nil {
+			return
+		}
+		status := "stopped"
+		if err != nil {
+			status = "failed: " + err.Error()
+		}
+		d.listenersMu.Lock()
+		l.info.Status = status
+		d.listenersMu.Unlock()
+		log.Printf("Listener %s ended: %s", l.info.ID, status)
+	}()
+
+	log.Printf("Listener %s started: %s", l.info.ID, l.info.Query)
+	if save {
+		return l.info, d.saveListeners()
+	}
+	return l.info, nil
+}
+
+// addHit records a message a listener matched, dropping the oldest past
+// maxHits
+func (d *Daemon) addHit(listener string, msg engine.Email) {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+
+	d.hitSeq++
+	d.hits = append(d.hits, Hit{
+		Seq:      d.hitSeq,
+		Listener: listener,
+		From:     msg.From,
+		Subject:  msg.Subject,
+		Date:     msg.Date,
+	})
+	if len(d.hits) > maxHits {
+		d.hits = d.hits[len(d.hits)-maxHits:]
+	}
+}
+
+// Hits returns the listener hits numbered after after, oldest first
+func (d *Daemon) Hits(after int) []Hit {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+
+	hits := []Hit{}
+	for _, h := range d.hits {
+		if h.Seq > after {
+			hits = append(hits, h)
+		}
+	}
+	return hits
+}
+
+// stopListener stops a listener and, when asked, forgets it for good
+func (d *Daemon) stopListener(id string, save bool) (Listener, error) {
+	d.listenersMu.Lock()
+	l, ok := d.listeners[id]
+	if ok {
+		delete(d.listeners, id)
+	}
+	d.listenersMu.Unlock()
+
+	if !ok {
+		return Listener{}, fmt.Errorf("no listener %s", id)
+	}
+	l.cancel()
+	l.info.Status = "stopped"
+	log.Printf("Listener %s stopped", id)
+
+	if save {
+		return l.info, d.saveListeners()
+	}
+	return l.info, nil
+}
+
+// stopAll stops every listener without forgetting them
+func (d *Daemon) stopAll() {
+	for _, l := range d.Listeners() {
+		d.stopListener(l.ID, false)
+	}
+}
+
+// execute runs a command on s and returns what it printed. Unless
+// confirmed, a command that would ask first stops there and returns the
+// prompt with what it printed up to it, and the result it names as
+// Target. A confirmed command that names a result only goes ahead if it is
+// still target.
+func (d *Daemon) execute(s *session, query string, confirmed bool, target string) (RunReply, error) {
+	d.mu.Lock()
+	intent, err := d.parser.Parse(query)
+	d.mu.Unlock()
+	if err != nil {
+		return RunReply{}, err
+	}
+	if intent.Command == engine.CommandListen {
+		return RunReply{}, fmt.Errorf("listeners are started with Daemon.Listen")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.executor == nil {
+		if s.executor, s.closer, err = d.openSession(); err != nil {
+			return RunReply{}, err
+		}
+	}
+	named := targetOf(s.executor.Named(intent))
+	if confirmed && named != target {
+		return RunReply{}, fmt.Errorf("result %d is no longer the message you confirmed; search again", intent.Result)
+	}
+	if err := s.executor.Validate(intent); err != nil {
+		return RunReply{}, err
+	}
+
+	var out bytes.Buffer
+	var prompt string
+	asked := 0
+	s.executor.SetOutput(&out)
+	defer s.executor.SetOutput(os.Stdout)
+	s.executor.SetConfirm(func(p string) bool {
+		if !confirmed {
+			prompt, asked = p, out.Len()
+		}
+		return confirmed
+	}, engine.DefaultConfirmThreshold)
+
+	result, err := s.executor.Execute(intent)
+	if err != nil {
+		return RunReply{}, err
+	}
+	if prompt != "" {
+		return RunReply{Output: out.String()[:asked], Prompt: prompt, Target: named}, nil
+	}
+	return RunReply{Result: result, Output: out.String()}, nil
+}
+
+// targetOf identifies a message by its Message-ID, or else its mailbox and
+// UID, and is empty without one
+func targetOf(msg *engine.Email) string {
+	switch {
+	case msg == nil:
+		return ""
+	case msg.MessageID != "":
+		return msg.MessageID
+	default:
+		return fmt.Sprintf("%s/%d", msg.Mailbox, msg.UID)
+	}
+}
+
+// runJob runs a scheduled job on the jobs' session. Jobs can't be asked to
+// confirm, so those that would ask fail.
+func (d *Daemon) runJob(job schedule.Job) (string, error) {
+	reply, err := d.execute(&d.jobSession, job.Query, false, "")
+	if err != nil {
+		return "", err
+	}
+	if reply.Prompt != "" {
+		return "", fmt.Errorf("%s needs confirmation; use --dry-run to review", reply.Prompt)
+	}
+	return engine.Digest(reply.Result), nil
+}
+
+// loadListeners reads the queries of the saved listeners
+func (d *Daemon) loadListeners() ([]string, error) {
+	b, err := os.ReadFile(d.stateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read listeners: %w", err)
+	}
+
+	var queries []string
+	if err := json.Unmarshal(b, &queries); err != nil {
+		return nil, fmt.Errorf("corrupt listeners file: %w", err)
+	}
+	return queries, nil
+}
+
+// saveListeners writes the queries of the running listeners
+func (d *Daemon) saveListeners() error {
+	var queries []string
+	for _, l := range d.Listeners() {
+		queries = append(queries, l.Query)
+	}
+	b, err := json.MarshalIndent(queries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.stateFile), 0o700); err != nil {
+		return fmt.Errorf("unable to write listeners: %w", err)
+	}
+	tmp := d.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write listeners: %w", err)
+	}
+	if err := os.Rename(tmp, d.stateFile); err != nil {
+		return fmt.Errorf("unable to write listeners: %w", err)
+	}
+	return nil
+}
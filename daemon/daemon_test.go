@@ -0,0 +1,161 @@
+package daemon
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+	"github.com/PlantingTrees/intent/schedule"
+)
+
+// newTestDaemon returns a daemon whose sessions all run on one in-memory
+// store, without its socket
+func newTestDaemon(t *testing.T) (*Daemon, *engine.MemoryBackend) {
+	t.Helper()
+	dir := t.TempDir()
+	store := engine.NewMemoryBackend("INBOX")
+	session := store.Session(engine.NewJournal(filepath.Join(dir, "journal.jsonl"), "me@example.com"))
+	parser := func() (*engine.Parser, error) { return engine.NewParser(), nil }
+
+	d := New(filepath.Join(dir, "intent.sock"), filepath.Join(dir, "listeners.json"), session, parser)
+	if err := d.reload(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.stopAll()
+		d.wg.Wait()
+	})
+	return d, store
+}
+
+func TestRunReturnsOutput(t *testing.T) {
+	d, store := newTestDaemon(t)
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Interview", Date: time.Now()})
+
+	reply, err := d.execute(&session{}, `search from "acme.com"`, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reply.Output, "Interview") {
+		t.Errorf("output %q doesn't list the match", reply.Output)
+	}
+	if reply.Result == nil || reply.Prompt != "" {
+		t.Errorf("reply = %+v, want a result", reply)
+	}
+}
+
+func TestRunAsksBeforeBulkActions(t *testing.T) {
+	d, store := newTestDaemon(t)
+	for i := 0; i <= engine.DefaultConfirmThreshold; i++ {
+		store.Add("INBOX", engine.Email{From: "bulk@spam.com", Subject: fmt.Sprint(i), Date: time.Now()})
+	}
+	flagged := func() int {
+		n := 0
+		for _, msg := range store.Messages("INBOX") {
+			if slices.Contains(msg.Flags, "\\Flagged") {
+				n++
+			}
+		}
+		return n
+	}
+
+	s := &session{}
+	reply, err := d.execute(s, `star from "spam.com"`, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Prompt == "" || strings.Contains(reply.Output, "Cancelled") {
+		t.Errorf("reply = %+v, want a prompt and the output before it", reply)
+	}
+	if n := flagged(); n != 0 {
+		t.Fatalf("%d messages starred before confirming", n)
+	}
+
+	if reply, err = d.execute(s, `star from "spam.com"`, true, reply.Target); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Prompt != "" {
+		t.Errorf("confirmed run asked %q", reply.Prompt)
+	}
+	if n := flagged(); n != engine.DefaultConfirmThreshold+1 {
+		t.Errorf("%d messages starred after confirming", n)
+	}
+}
+
+func TestSessionsKeepTheirOwnResults(t *testing.T) {
+	d, store := newTestDaemon(t)
+	store.Add("INBOX", engine.Email{MessageID: "<interview@acme.com>", From: "hr@acme.com", Subject: "Interview", Date: time.Now()})
+	store.Add("INBOX", engine.Email{MessageID: "<weekly@other.com>", From: "news@other.com", Subject: "Weekly", Date: time.Now()})
+
+	repl, other := &session{}, &session{}
+	if _, err := d.execute(repl, `search from "acme.com"`, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.execute(other, `search from "other.com"`, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.runJob(schedule.Job{Query: `search from "other.com"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	intent, err := engine.NewParser().Parse(`reply to 1 "Thanks"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := repl.executor.Named(intent); msg == nil || msg.Subject != "Interview" {
+		t.Errorf("reply to 1 names %+v, want the REPL's own result", msg)
+	}
+}
+
+func TestConfirmChecksTarget(t *testing.T) {
+	d, store := newTestDaemon(t)
+	store.Add("INBOX", engine.Email{MessageID: "<interview@acme.com>", From: "hr@acme.com", Subject: "Interview", Date: time.Now()})
+	store.Add("INBOX", engine.Email{MessageID: "<offer@acme.com>", From: "hr@acme.com", Subject: "Offer", Date: time.Now().Add(-time.Hour)})
+
+	s := &session{}
+	if _, err := d.execute(s, `search from "acme.com"`, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Result 1 was the offer when the reply was previewed, but a search
+	// since made it the interview
+	_, err := d.execute(s, `reply to 1 "Thanks"`, true, "<offer@acme.com>")
+	if err == nil || !strings.Contains(err.Error(), "no longer") {
+		t.Errorf("confirmed reply to a changed result: %v", err)
+	}
+}
+
+func TestListenerHits(t *testing.T) {
+	d, store := newTestDaemon(t)
+	l, err := d.startListener(`listen from "acme.com"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the listener to start before anything arrives
+	for !store.Watching() {
+		time.Sleep(time.Millisecond)
+	}
+	store.Add("INBOX", engine.Email{From: "news@other.com", Subject: "Weekly", Date: time.Now()})
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Offer", Date: time.Now()})
+
+	var hits []Hit
+	for i := 0; i < 250 && len(hits) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		hits = d.Hits(0)
+	}
+	if len(hits) == 0 {
+		t.Fatal("listener never reported a hit")
+	}
+	for _, h := range hits {
+		if h.Listener != l.ID || h.Subject != "Offer" {
+			t.Errorf("hit %+v, want only offers from listener %s", h, l.ID)
+		}
+	}
+	if later := d.Hits(hits[len(hits)-1].Seq); len(later) != 0 {
+		t.Errorf("Hits after the last one returned %d", len(later))
+	}
+}
@@ -0,0 +1,230 @@
+package daemon
+
+import (
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+)
+
+// Listener describes a listener running in the daemon
+type Listener struct {
+	ID      string    `json:"id"`
+	Query   string    `json:"query"`
+	Started time.Time `json:"started"`
+	Status  string    `json:"status"` // running, stopped, or failed: reason
+}
+
+// QueryArgs carries a command in query syntax
+type QueryArgs struct {
+	Query string `json:"query"`
+}
+
+// RunArgs carries a command to run and whether it may go ahead without
+// asking
+type RunArgs struct {
+	Query   string `json:"query"`
+	Confirm bool   `json:"confirm,omitempty"` // Allow actions above the confirmation threshold, and sending replies
+	Target  string `json:"target,omitempty"`  // With Confirm, the Target of the reply that asked
+}
+
+// HitsArgs asks for the listener hits after a sequence number
+type HitsArgs struct {
+	After int `json:"after"`
+}
+
+// Hit is a new message a listener matched
+type Hit struct {
+	Seq      int       `json:"seq"`
+	Listener string    `json:"listener"`
+	From     string    `json:"from"`
+	Subject  string    `json:"subject"`
+	Date     time.Time `json:"date"`
+}
+
+// IDArgs names a listener
+type IDArgs struct {
+	ID string `json:"id"`
+}
+
+// Empty is for methods without arguments
+type Empty struct{}
+
+// RunReply is the result of a command run by the daemon, and what it
+// printed. A command that stopped to ask has Prompt set and no result; run
+// it again with Confirm and its Target to go ahead.
+type RunReply struct {
+	Result *engine.Result `json:"result"`
+	Output string         `json:"output"`
+	Prompt string         `json:"prompt,omitempty"`
+	Target string         `json:"target,omitempty"` // The message a command like "reply to 2" names, by Message-ID
+}
+
+// Status describes the running daemon
+type Status struct {
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+	Listeners int       `json:"listeners"`
+	Jobs      int       `json:"jobs"`
+}
+
+// Service is the JSON-RPC API on the control socket, registered as
+// "Daemon": Daemon.Listen, Daemon.Listeners, Daemon.Unlisten, Daemon.Hits,
+// Daemon.Run, Daemon.Status and Daemon.Reload. Each connection has its own.
+type Service struct {
+	d       *Daemon
+	session *session // Where the connection's commands run
+}
+
+// Listen starts a listen command and keeps it across restarts
+func (s *Service) Listen(args QueryArgs, reply *Listener) error {
+	l, err := s.d.startListener(args.Query, true)
+	if err != nil {
+		return err
+	}
+	*reply = l
+	return nil
+}
+
+// Listeners lists the running listeners
+func (s *Service) Listeners(args Empty, reply *[]Listener) error {
+	*reply = s.d.Listeners()
+	return nil
+}
+
+// Unlisten stops a listener for good
+func (s *Service) Unlisten(args IDArgs, reply *Listener) error {
+	l, err := s.d.stopListener(args.ID, true)
+	if err != nil {
+		return err
+	}
+	*reply = l
+	return nil
+}
+
+// Hits returns the messages listeners matched after args.After, oldest
+// first. Only the latest maxHits are kept.
+func (s *Service) Hits(args HitsArgs, reply *[]Hit) error {
+	*reply = s.d.Hits(args.After)
+	return nil
+}
+
+// Run runs any other command on the connection's session
+func (s *Service) Run(args RunArgs, reply *RunReply) error {
+	r, err := s.d.execute(s.session, args.Query, args.Confirm, args.Target)
+	if err != nil {
+		return err
+	}
+	*reply = r
+	return nil
+}
+
+// Status reports on the daemon
+func (s *Service) Status(args Empty, reply *Status) error {
+	reply.PID = os.Getpid()
+	reply.Started = s.d.started
+	reply.Listeners = len(s.d.Listeners())
+	if s.d.jobs != nil {
+		jobs, err := s.d.jobs.Jobs()
+		if err != nil {
+			return err
+		}
+		reply.Jobs = len(jobs)
+	}
+	return nil
+}
+
+// Reload does what SIGHUP does
+func (s *Service) Reload(args Empty, reply *Empty) error {
+	return s.d.reload()
+}
+
+// Client talks to a running daemon
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the daemon on socket
+func Dial(socket string) (*Client, error) {
+	c, err := jsonrpc.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not running: %w", err)
+	}
+	return &Client{rpc: c}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Listen registers a listener with the daemon
+func (c *Client) Listen(query string) (Listener, error) {
+	var l Listener
+	err := c.rpc.Call("Daemon.Listen", QueryArgs{Query: query}, &l)
+	return l, err
+}
+
+// Listeners lists the daemon's listeners
+func (c *Client) Listeners() ([]Listener, error) {
+	var list []Listener
+	err := c.rpc.Call("Daemon.Listeners", Empty{}, &list)
+	return list, err
+}
+
+// Unlisten stops one of the daemon's listeners
+func (c *Client) Unlisten(id string) (Listener, error) {
+	var l Listener
+	err := c.rpc.Call("Daemon.Unlisten", IDArgs{ID: id}, &l)
+	return l, err
+}
+
+// Hits returns the messages the daemon's listeners matched after the hit
+// numbered after
+func (c *Client) Hits(after int) ([]Hit, error) {
+	var hits []Hit
+	err := c.rpc.Call("Daemon.Hits", HitsArgs{After: after}, &hits)
+	return hits, err
+}
+
+// Run runs a command on the daemon. Commands that would ask first come
+// back with a Prompt instead.
+func (c *Client) Run(query string) (RunReply, error) {
+	var reply RunReply
+	err := c.rpc.Call("Daemon.Run", RunArgs{Query: query}, &reply)
+	return reply, err
+}
+
+// Confirm runs again a command that came back with a Prompt, letting it go
+// ahead if it still names the message asked about
+func (c *Client) Confirm(query string, asked RunReply) (RunReply, error) {
+	var reply RunReply
+	err := c.rpc.Call("Daemon.Run", RunArgs{Query: query, Confirm: true, Target: asked.Target}, &reply)
+	return reply, err
+}
+
+// Status reports on the daemon
+func (c *Client) Status() (Status, error) {
+	var status Status
+	err := c.rpc.Call("Daemon.Status", Empty{}, &status)
+	return status, err
+}
+
+// Reload asks the daemon to reload its configuration
+func (c *Client) Reload() error {
+	return c.rpc.Call("Daemon.Reload", Empty{}, &Empty{})
+}
+
+// sortListeners orders listeners by ID, which is the order they started
+func sortListeners(list []Listener) {
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].ID)
+		b, _ := strconv.Atoi(list[j].ID)
+		return a < b
+	})
+}
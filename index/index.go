@@ -0,0 +1,316 @@
+package index
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document is a message to index
+type Document struct {
+	UID       uint32
+	MessageID string
+	From      string
+	Subject   string
+	Date      time.Time
+	Body      string
+}
+
+// Meta is what the index keeps about a message besides its terms
+type Meta struct {
+	MessageID string
+	From      string
+	Subject   string
+	Date      time.Time
+	Length    int // Number of indexed terms
+}
+
+// Hit is a search result
+type Hit struct {
+	UID   uint32
+	Meta  *Meta
+	Score float64
+}
+
+// Index is an on-disk inverted index of one mailbox, with term positions
+// for phrase queries
+type Index struct {
+	Mailbox     string
+	UIDValidity uint32
+	LastUID     uint32 // Highest UID synced so far
+
+	Docs     map[uint32]*Meta
+	Postings map[string]map[uint32][]int // term -> UID -> positions
+	TotalLen int
+
+	path string
+	mu   sync.RWMutex
+}
+
+// Open loads the index stored at path, or returns an empty one
+func Open(path string) (*Index, error) {
+	ix := &Index{
+		Docs:     make(map[uint32]*Meta),
+		Postings: make(map[string]map[uint32][]int),
+		path:     path,
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open index: %w", err)
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(ix); err != nil {
+		return nil, fmt.Errorf("corrupt index: %w", err)
+	}
+	return ix, nil
+}
+
+// Save writes the index to disk
+func (ix *Index) Save() error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	tmp := ix.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to write index: %w", err)
+	}
+	if err := gob.NewEncoder(f).Encode(ix); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ix.path)
+}
+
+// Reset empties the index for a mailbox, e.g. after its UIDVALIDITY changed
+func (ix *Index) Reset(mailbox string, uidValidity uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.Mailbox = mailbox
+	ix.UIDValidity = uidValidity
+	ix.LastUID = 0
+	ix.Docs = make(map[uint32]*Meta)
+	ix.Postings = make(map[string]map[uint32][]int)
+	ix.TotalLen = 0
+}
+
+// Covers reports whether the index mirrors the given mailbox generation
+func (ix *Index) Covers(mailbox string, uidValidity uint32) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return ix.Mailbox == mailbox && ix.UIDValidity == uidValidity && ix.LastUID > 0
+}
+
+// Oldest returns the arrival time of the oldest indexed message, and the
+// zero time when the index is empty
+func (ix *Index) Oldest() time.Time {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var oldest time.Time
+	for _, meta := range ix.Docs {
+		if oldest.IsZero() || meta.Date.Before(oldest) {
+			oldest = meta.Date
+		}
+	}
+	return oldest
+}
+
+// Add indexes a document, replacing any earlier version of it
+func (ix *Index) Add(doc Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(doc.UID)
+
+	terms := Tokenize(doc.Subject + "\n" + doc.From + "\n" + doc.Body)
+	for pos, term := range terms {
+		postings := ix.Postings[term]
+		if postings == nil {
+			postings = make(map[uint32][]int)
+			ix.Postings[term] = postings
+		}
+		postings[doc.UID] = append(postings[doc.UID], pos)
+	}
+
+	ix.Docs[doc.UID] = &Meta{
+		MessageID: doc.MessageID,
+		From:      doc.From,
+		Subject:   doc.Subject,
+		Date:      doc.Date,
+		Length:    len(terms),
+	}
+	ix.TotalLen += len(terms)
+	if doc.UID > ix.LastUID {
+		ix.LastUID = doc.UID
+	}
+}
+
+// Remove drops a document, e.g. after it was expunged
+func (ix *Index) Remove(uid uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(uid)
+}
+
+func (ix *Index) remove(uid uint32) {
+	meta, ok := ix.Docs[uid]
+	if !ok {
+		return
+	}
+
+	for term, postings := range ix.Postings {
+		if _, ok := postings[uid]; ok {
+			delete(postings, uid)
+			if len(postings) == 0 {
+				delete(ix.Postings, term)
+			}
+		}
+	}
+	ix.TotalLen -= meta.Length
+	delete(ix.Docs, uid)
+}
+
+// UIDs returns every indexed UID
+func (ix *Index) UIDs() []uint32 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	uids := make([]uint32, 0, len(ix.Docs))
+	for uid := range ix.Docs {
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// Search ranks documents with BM25. Each query is a word or phrase, and a
+// document matches when it contains any of them; multi-word queries must
+// appear as a phrase. With no queries, every document passing keep matches,
+// newest first. keep may be nil.
+func (ix *Index) Search(queries []string, keep func(*Meta) bool) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var hits []Hit
+
+	if len(queries) == 0 {
+		for uid, meta := range ix.Docs {
+			if keep == nil || keep(meta) {
+				hits = append(hits, Hit{UID: uid, Meta: meta})
+			}
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			return hits[i].Meta.Date.After(hits[j].Meta.Date)
+		})
+		return hits
+	}
+
+	scores := make(map[uint32]float64)
+	for _, query := range queries {
+		terms := Tokenize(query)
+		if len(terms) == 0 {
+			continue
+		}
+
+		for uid := range ix.phraseMatches(terms) {
+			for _, term := range terms {
+				scores[uid] += ix.bm25(term, uid)
+			}
+		}
+	}
+
+	for uid, score := range scores {
+		meta := ix.Docs[uid]
+		if keep == nil || keep(meta) {
+			hits = append(hits, Hit{UID: uid, Meta: meta, Score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Meta.Date.After(hits[j].Meta.Date)
+	})
+	return hits
+}
+
+// phraseMatches returns the documents containing terms at consecutive
+// positions
+func (ix *Index) phraseMatches(terms []string) map[uint32]bool {
+	matches := make(map[uint32]bool)
+
+	for uid, positions := range ix.Postings[terms[0]] {
+		for _, start := range positions {
+			if ix.phraseAt(uid, terms[1:], start+1) {
+				matches[uid] = true
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func (ix *Index) phraseAt(uid uint32, terms []string, pos int) bool {
+	for i, term := range terms {
+		positions := ix.Postings[term][uid]
+		j := sort.SearchInts(positions, pos+i)
+		if j == len(positions) || positions[j] != pos+i {
+			return false
+		}
+	}
+	return true
+}
+
+// bm25 scores one term for one document
+func (ix *Index) bm25(term string, uid uint32) float64 {
+	postings := ix.Postings[term]
+	tf := float64(len(postings[uid]))
+	if tf == 0 {
+		return 0
+	}
+
+	n := float64(len(ix.Docs))
+	df := float64(len(postings))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	avgLen := float64(ix.TotalLen) / n
+	docLen := float64(ix.Docs[uid].Length)
+
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+}
+
+// Tokenize splits text into lowercase, stemmed terms
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, Stem(word))
+	}
+	return terms
+}
@@ -0,0 +1,176 @@
+package intentengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// Gmail system mailboxes used by the message actions
+const (
+	allMailMailbox = "[Gmail]/All Mail"
+	trashMailbox   = "[Gmail]/Trash"
+)
+
+// DefaultConfirmThreshold is the number of affected messages above which an
+// action asks for confirmation before running
+const DefaultConfirmThreshold = 10
+
+// executeAction applies a message action (archive, star, label, ...) to every
+// message matching the intent
+func (e *Executor) executeAction(intent *Intent) (*Result, error) {
+	fmt.Fprintf(e.out, "\n=== Executing %s ===\n", strings.ToUpper(string(intent.Command)))
+	if len(intent.Keywords) > 0 {
+		fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	}
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	if intent.Target != "" {
+		fmt.Fprintln(e.out, "Target:", intent.Target)
+	}
+	e.printDateRange(intent)
+
+	folder, err := e.backend.Open(intent.Folder(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := e.backend.Matches(intent)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(e.out, "✓ %d messages affected\n\n", len(messages))
+
+	if len(messages) == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+		return &Result{Command: intent.Command, DryRun: intent.DryRun}, nil
+	}
+
+	if intent.DryRun {
+		fmt.Fprint(e.out, "=== Dry Run: no changes made ===\n\n")
+		e.printResults(messages)
+		return &Result{Command: intent.Command, Count: len(messages), DryRun: true, Messages: messages}, nil
+	}
+
+	if len(messages) > e.confirmThreshold {
+		prompt := fmt.Sprintf("%s %d messages?", intent.Command, len(messages))
+		if e.confirm == nil {
+			return nil, fmt.Errorf("%s affects %d messages and needs confirmation; use --dry-run to review them", intent.Command, len(messages))
+		}
+		if !e.confirm(prompt) {
+			fmt.Fprintln(e.out, "Cancelled.")
+			return &Result{Command: intent.Command, Messages: messages}, nil
+		}
+	}
+
+	uids := make([]uint32, len(messages))
+	for i, msg := range messages {
+		uids[i] = msg.UID
+	}
+
+	// Snapshot the messages before changing them, so the action can be undone
+	var entry *JournalEntry
+	if e.journal != nil {
+		entry = snapshot(folder, intent, messages)
+	}
+
+	copied, err := e.applyAction(intent, uids)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", intent.Command, err)
+	}
+	// Copies are recorded so undo removes exactly them
+	if entry != nil && copied != nil {
+		entry.TargetUIDValidity = copied.UIDValidity
+		for i := range entry.Messages {
+			entry.Messages[i].CopyUID = copied.UIDs[entry.Messages[i].UID]
+		}
+	}
+
+	fmt.Fprintf(e.out, "✓ %s applied to %d messages\n", intent.Command, len(messages))
+
+	result := &Result{Command: intent.Command, Count: len(messages), Messages: messages}
+
+	if entry != nil {
+		if err := e.journal.Append(entry); err != nil {
+			return nil, fmt.Errorf("action applied but not journaled: %w", err)
+		}
+		fmt.Fprintf(e.out, "  (journal entry %s, type 'undo %s' to reverse)\n", entry.ID, entry.ID)
+		result.JournalID = entry.ID
+	}
+
+	return result, nil
+}
+
+// snapshot builds the journal entry for an action from the messages'
+// current flags and Gmail labels
+func snapshot(folder *Folder, intent *Intent, messages []Email) *JournalEntry {
+	entry := &JournalEntry{
+		Operation:   intent.Command,
+		Query:       intent.String(),
+		Mailbox:     folder.Name,
+		Target:      intent.Target,
+		UIDValidity: folder.UIDValidity,
+	}
+	for _, msg := range messages {
+		entry.Messages = append(entry.Messages, JournalMessage{
+			UID:       msg.UID,
+			MessageID: msg.MessageID,
+			Flags:     msg.Flags,
+			Labels:    msg.Labels,
+		})
+	}
+
+	return entry
+}
+
+// applyAction changes the messages in the open folder. A label copied
+// into a folder reports where the copies went.
+func (e *Executor) applyAction(intent *Intent, uids []uint32) (*Copied, error) {
+	switch intent.Command {
+	case CommandMarkRead, CommandStar:
+		flag, _ := actionFlag(intent.Command)
+		return nil, e.backend.Store(uids, flag, true)
+	case CommandMarkUnread, CommandUnstar:
+		flag, _ := actionFlag(intent.Command)
+		return nil, e.backend.Store(uids, flag, false)
+	case CommandArchive, CommandTrash, CommandMove:
+		// Moving out of INBOX into All Mail drops Gmail's Inbox label
+		dest, _ := actionDestination(intent)
+		return nil, e.backend.Move(uids, dest)
+	case CommandLabel:
+		err := e.backend.Label(uids, intent.Target, true)
+		if !errors.Is(err, errNoLabels) {
+			return nil, err
+		}
+		// Without Gmail labels, the closest equivalent is a copy into a folder
+		return e.backend.Copy(uids, intent.Target)
+	default:
+		return nil, fmt.Errorf("unknown action: %s", intent.Command)
+	}
+}
+
+// actionFlag returns the flag changed by a flag action
+func actionFlag(cmd CommandType) (string, bool) {
+	switch cmd {
+	case CommandMarkRead, CommandMarkUnread:
+		return imap.SeenFlag, true
+	case CommandStar, CommandUnstar:
+		return imap.FlaggedFlag, true
+	}
+	return "", false
+}
+
+// actionDestination returns the mailbox a moving action puts messages in
+func actionDestination(intent *Intent) (string, bool) {
+	switch intent.Command {
+	case CommandArchive:
+		return allMailMailbox, true
+	case CommandTrash:
+		return trashMailbox, true
+	case CommandMove:
+		return intent.Target, true
+	}
+	return "", false
+}
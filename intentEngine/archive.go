@@ -0,0 +1,77 @@
+package intentengine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PlantingTrees/intent/archive"
+	"github.com/PlantingTrees/intent/mailsync"
+)
+
+// executeArchiveSearch searches a local mbox file or Maildir, with the same
+// filters as a server search and no network. With a folder, the archive is
+// the root of a sync mirror.
+func (e *Executor) executeArchiveSearch(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing SEARCH (archive) ===")
+	fmt.Fprintln(e.out, "Archive:", intent.Archive)
+	fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	e.printDateRange(intent)
+
+	path := intent.Archive
+	if intent.Mailbox != "" {
+		// A folder is read from a sync mirror's Maildir++ tree
+		root, err := archive.ExpandHome(path)
+		if err != nil {
+			return nil, err
+		}
+		path = mailsync.FolderPath(root, intent.Mailbox)
+		fmt.Fprintln(e.out, "Folder:", intent.Mailbox)
+	}
+
+	a, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(e.out, "\nSearching...")
+
+	scanned := 0
+	var messages []Email
+	err = a.Walk(func(msg *archive.Message) error {
+		scanned++
+		email := Email{
+			ID:        msg.Source,
+			MessageID: msg.MessageID,
+			From:      msg.From,
+			Subject:   msg.Subject,
+			Date:      msg.Date,
+			Flags:     msg.Flags,
+			Body:      msg.Body,
+		}
+		if matchesIntent(email, intent) {
+			messages = append(messages, email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("archive search failed: %w", err)
+	}
+
+	total := len(messages)
+	messages = e.paginate(intent, messages)
+
+	// Archive results have no server UIDs, so they can't be replied to
+	e.lastResults = nil
+
+	fmt.Fprintf(e.out, "✓ Found %d matching messages (%d scanned)\n\n", total, scanned)
+	if total == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+	} else {
+		fmt.Fprint(e.out, "=== Search Results ===\n\n")
+	}
+	e.printResults(messages)
+	e.printPage(intent, len(messages), DefaultPageSize)
+
+	return &Result{Command: CommandSearch, Count: total, Messages: messages}, nil
+}
@@ -0,0 +1,36 @@
+package intentengine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PlantingTrees/intent/mailsync"
+)
+
+// deliver writes a message into a mirror folder the way sync does
+func deliver(t *testing.T, root, folder string, uid uint32, from, subject string) {
+	t.Helper()
+	m, err := mailsync.OpenMaildir(mailsync.FolderPath(root, folder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := fmt.Sprintf("From: %s\r\nSubject: %s\r\nMessage-ID: <%d@example.org>\r\nDate: Mon, 3 Mar 2025 09:00:00 +0000\r\n\r\nHello\r\n", from, subject, uid)
+	if _, err := m.Deliver(uid, []byte(raw), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchSyncMirrorFolder(t *testing.T) {
+	root := t.TempDir()
+	deliver(t, root, "INBOX", 1, "hr@acme.com", "Interview")
+	deliver(t, root, "Receipts", 1, "billing@acme.com", "Invoice")
+
+	e := NewExecutor(nil)
+	if found := run(t, e, fmt.Sprintf(`search from "acme.com" in archive %q`, root)).Messages; len(found) != 1 || found[0].Subject != "Interview" {
+		t.Errorf("INBOX search found %+v", found)
+	}
+
+	if found := run(t, e, fmt.Sprintf(`search from "acme.com" in "Receipts" in archive %q`, root)).Messages; len(found) != 1 || found[0].Subject != "Invoice" {
+		t.Errorf("Receipts search found %+v", found)
+	}
+}
@@ -0,0 +1,321 @@
+package intentengine
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/emersion/go-imap"
+	"github.com/jhillyerd/enmime"
+)
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Size        int
+}
+
+// attachmentsOf lists the parts of a parsed message that carry a file
+// name, whether marked as attachments or inline
+func attachmentsOf(env *enmime.Envelope) []Attachment {
+	var attachments []Attachment
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines, env.OtherParts} {
+		for _, part := range parts {
+			if part.FileName == "" {
+				continue
+			}
+			attachments = append(attachments, Attachment{
+				Filename:    baseName(part.FileName),
+				ContentType: part.ContentType,
+				Size:        len(part.Content),
+			})
+		}
+	}
+	return attachments
+}
+
+// attachmentNames joins the names of a message's attachments for display
+func attachmentNames(email Email) string {
+	var names []string
+	for _, a := range email.Attachments {
+		names = append(names, a.Filename)
+	}
+	return strings.Join(names, ", ")
+}
+
+// matchesAttachments checks a message against the intent's attachment and
+// size filters
+func matchesAttachments(email Email, intent *Intent) bool {
+	if intent.LargerThan > 0 && int64(email.Size) <= intent.LargerThan {
+		return false
+	}
+	if !intent.HasAttachmentFilter() {
+		return true
+	}
+	for _, a := range email.Attachments {
+		if filenameMatches(intent.Filename, a.Filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// filenameMatches reports whether name, without any directories the sender
+// gave it, matches the glob, ignoring case. An empty glob matches any name.
+func filenameMatches(glob, name string) bool {
+	if glob == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(glob), strings.ToLower(baseName(name)))
+	return ok
+}
+
+// baseName strips the directories of a file name, in either slash style
+func baseName(name string) string {
+	return name[strings.LastIndexAny(name, `/\`)+1:]
+}
+
+// filterByStructure keeps the messages whose BODYSTRUCTURE has an
+// attachment the intent asks for, so bodies are only fetched for the page
+// shown. Order is kept.
+func (b *imapBackend) filterByStructure(seqNums []uint32, intent *Intent) ([]uint32, error) {
+	if len(seqNums) == 0 {
+		return seqNums, nil
+	}
+	set := new(imap.SeqSet)
+	set.AddNum(seqNums...)
+
+	messages := make(chan *imap.Message, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.c.Fetch(set, []imap.FetchItem{imap.FetchBodyStructure, imap.FetchRFC822Size}, messages)
+	}()
+
+	keep := make(map[uint32]bool)
+	for msg := range messages {
+		email := Email{Size: msg.Size, Attachments: structureAttachments(msg.BodyStructure)}
+		keep[msg.SeqNum] = matchesAttachments(email, intent)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+
+	var filtered []uint32
+	for _, n := range seqNums {
+		if keep[n] {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered, nil
+}
+
+// structureAttachments lists the parts of a BODYSTRUCTURE that carry a
+// file name, as attachmentsOf does for a parsed message
+func structureAttachments(bs *imap.BodyStructure) []Attachment {
+	if bs == nil {
+		return nil
+	}
+	var attachments []Attachment
+	bs.Walk(func(_ []int, part *imap.BodyStructure) bool {
+		if len(part.Parts) > 0 {
+			return true
+		}
+		if name, _ := part.Filename(); name != "" {
+			attachments = append(attachments, Attachment{
+				Filename:    baseName(name),
+				ContentType: strings.ToLower(part.MIMEType + "/" + part.MIMESubType),
+				Size:        int(part.Size),
+			})
+		}
+		return true
+	})
+	return attachments
+}
+
+// executeAttachments lists the attachments of a message from the last search
+func (e *Executor) executeAttachments(intent *Intent) (*Result, error) {
+	target := e.lastResults[intent.Result-1]
+
+	fmt.Fprintln(e.out, "\n=== Executing ATTACHMENTS ===")
+	fmt.Fprintf(e.out, "[%d] %s: %s\n\n", intent.Result, target.From, target.Subject)
+
+	env, err := e.fetchEnvelope(target)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := attachmentsOf(env)
+	if len(attachments) == 0 {
+		fmt.Fprintln(e.out, "This message has no attachments.")
+	}
+	for i, a := range attachments {
+		fmt.Fprintf(e.out, "[%d] %s (%s, %s)\n", i+1, a.Filename, a.ContentType, formatSize(int64(a.Size)))
+	}
+
+	return &Result{Command: CommandAttachments, Count: len(attachments), Attachments: attachments}, nil
+}
+
+// executeSaveAttachments writes the attachments of a message from the last
+// search to a directory. Names are sanitized and never overwrite a file.
+func (e *Executor) executeSaveAttachments(intent *Intent) (*Result, error) {
+	target := e.lastResults[intent.Result-1]
+
+	fmt.Fprintln(e.out, "\n=== Executing SAVE ATTACHMENTS ===")
+	fmt.Fprintf(e.out, "[%d] %s: %s\n\n", intent.Result, target.From, target.Subject)
+
+	dir, err := expandHome(intent.Target)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", dir, err)
+	}
+
+	env, err := e.fetchEnvelope(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []string
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines, env.OtherParts} {
+		for _, part := range parts {
+			if part.FileName == "" {
+				continue
+			}
+			contentType := sniffType(part.ContentType, part.Content)
+			name := sanitizeFilename(part.FileName, contentType, len(saved)+1)
+
+			file, err := saveFile(dir, name, part.Content)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(e.out, "✓ Saved %s (%s, %s)\n", file, contentType, formatSize(int64(len(part.Content))))
+			saved = append(saved, file)
+		}
+	}
+	if len(saved) == 0 {
+		fmt.Fprintln(e.out, "This message has no attachments.")
+	}
+
+	return &Result{Command: CommandSaveAttachments, Count: len(saved), Files: saved}, nil
+}
+
+// fetchEnvelope fetches a message from the last search and parses it
+func (e *Executor) fetchEnvelope(target Email) (*enmime.Envelope, error) {
+	mailbox := target.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := e.imapClient.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", mailbox, err)
+	}
+
+	raw, err := e.fetchRaw(target.UID)
+	if err != nil {
+		return nil, err
+	}
+	env, err := enmime.ReadEnvelope(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse message: %w", err)
+	}
+	return env, nil
+}
+
+// sniffType returns the declared content type, or the one the content
+// looks like when the sender only said it was binary
+func sniffType(declared string, content []byte) string {
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	if declared != "" && declared != "application/octet-stream" {
+		return declared
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	return sniffed
+}
+
+// sanitizeFilename makes an attachment's name safe to write: no
+// directories, control characters, characters Windows forbids or leading
+// dots, and an extension matching its content type when it has none. n
+// names unnamed files.
+func sanitizeFilename(name, contentType string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:<>"|?*`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, baseName(name))
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = fmt.Sprintf("attachment-%d", n)
+	}
+
+	if filepath.Ext(name) == "" {
+		if ext, ok := commonExtensions[contentType]; ok {
+			name += ext
+		} else if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return name
+}
+
+// commonExtensions are the usual extensions of types that have several
+var commonExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"text/plain": ".txt",
+	"text/html":  ".html",
+}
+
+// saveFile writes content to name in dir, numbering the name when a file
+// already has it, and returns the path written
+func saveFile(dir, name string, content []byte) (string, error) {
+	f, err := createFile(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("unable to save %s: %w", f.Name(), err)
+	}
+	return f.Name(), nil
+}
+
+// createFile creates name in dir for writing, numbering the name when a
+// file already has it
+func createFile(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to save %s: %w", name, err)
+		}
+		return f, nil
+	}
+}
+
+// expandHome expands a leading ~ to the home directory
+func expandHome(dir string) (string, error) {
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, dir[1:])
+	}
+	return dir, nil
+}
@@ -0,0 +1,73 @@
+package intentengine
+
+import (
+	"context"
+	"errors"
+)
+
+// Backend is the mail store searches, listeners and message actions run
+// against. Calls other than Open and Watch work in the folder opened last,
+// as IMAP does. IMAP, JMAP and MemoryBackend implement it; commands only
+// IMAP offers (folders, sync, export, attachments, replies) use the IMAP
+// connection directly.
+type Backend interface {
+	// Open makes folder the one later calls work in. A read-only folder
+	// keeps flags such as \Seen as they are.
+	Open(folder string, readOnly bool) (*Folder, error)
+
+	// Search returns the page of messages matching a search intent, in the
+	// order it asks for, and how many match in all
+	Search(intent *Intent) ([]Email, int, error)
+
+	// Matches returns every message an action on intent would change, with
+	// its flags and labels
+	Matches(intent *Intent) ([]Email, error)
+
+	// Fetch returns one message with its body, or ErrNotFound
+	Fetch(uid uint32) (*Email, error)
+
+	// FindMessageID returns the UIDs of the messages with a Message-ID
+	FindMessageID(id string) ([]uint32, error)
+
+	// Store adds or removes a flag
+	Store(uids []uint32, flag string, add bool) error
+
+	// Label adds or removes a Gmail-style label, or returns errNoLabels
+	// when the store only has folders
+	Label(uids []uint32, label string, add bool) error
+
+	// Copy copies messages into dest. It reports the UIDs the copies got
+	// when the store says (UIDPLUS), and nil otherwise.
+	Copy(uids []uint32, dest string) (*Copied, error)
+
+	// Move moves messages into dest
+	Move(uids []uint32, dest string) error
+
+	// Delete permanently removes exactly these messages, and fails rather
+	// than remove any other
+	Delete(uids []uint32) error
+
+	// Watch calls found with each batch of messages that arrive in folder,
+	// until ctx is done. found runs while the store is idle, so it may use
+	// the backend.
+	Watch(ctx context.Context, folder string, found func([]Email)) error
+}
+
+// Folder is a folder as a backend opened it
+type Folder struct {
+	Name        string
+	Messages    uint32
+	UIDValidity uint32 // Zero when the store has no UIDs
+}
+
+// Copied says which UIDs copied messages got in their destination
+type Copied struct {
+	UIDValidity uint32            // The destination's
+	UIDs        map[uint32]uint32 // Copy's UID by original UID
+}
+
+// ErrNotFound is returned for a message that isn't in the folder
+var ErrNotFound = errors.New("message not found")
+
+// errNoLabels is returned by Label when the store only has folders
+var errNoLabels = errors.New("labels are not supported")
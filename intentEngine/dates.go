@@ -0,0 +1,294 @@
+package intentengine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date expressions accepted inside [...]
+var (
+	tzPattern        = regexp.MustCompile(`(?i)(?:^|\s)tz:(\S+)`)
+	lastNPattern     = regexp.MustCompile(`^(?:last|past)\s+(\d+)\s+(hour|day|week|month)s?$`)
+	periodPattern    = regexp.MustCompile(`^(this|last)\s+(week|month|year)$`)
+	olderPattern     = regexp.MustCompile(`^older\s+than\s+(\d+)\s+(hour|day|week|month)s?$`)
+	boundPattern     = regexp.MustCompile(`^(since|after|before)\s+(.+)$`)
+	monthPattern     = regexp.MustCompile(`^(?:in\s+)?([a-z]+)(?:\s+(\d{4}))?$`)
+	isoWeekPattern   = regexp.MustCompile(`^(?:week\s+|w)(\d{1,2})(?:\s+(\d{4}))?$`)
+	isoWeekIDPattern = regexp.MustCompile(`^(\d{4})-?w(\d{1,2})$`)
+	rangePattern     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+to\s+(\d{4}-\d{2}-\d{2})$`)
+)
+
+// weekdays and months by the names people type
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+// SetClock sets the clock that relative dates like "yesterday" are
+// resolved against, so they can be pinned to a fixed time
+func (p *Parser) SetClock(now func() time.Time) {
+	p.now = now
+}
+
+// parseDateRange parses date range expressions. A "tz:Zone" modifier
+// resolves the expression in that IANA time zone instead of the local one.
+func (p *Parser) parseDateRange(intent *Intent, expr string) error {
+	now := p.now()
+	written := strings.Join(strings.Fields(expr), " ")
+
+	if m := tzPattern.FindStringSubmatch(expr); m != nil {
+		loc, err := loadLocation(m[1])
+		if err != nil {
+			return err
+		}
+		now = now.In(loc)
+		expr = strings.Replace(expr, m[0], "", 1)
+	}
+	expr = strings.Join(strings.Fields(strings.ToLower(expr)), " ")
+
+	start, end, err := resolveRange(expr, now)
+	if err != nil {
+		return err
+	}
+	intent.SetDateRange(start, end)
+	intent.DateRange.Expr = written
+	return nil
+}
+
+// resolveRange turns a lowercase date expression into a half-open range
+// [start, end); a zero start or end means unbounded on that side
+func resolveRange(expr string, now time.Time) (time.Time, time.Time, error) {
+	switch expr {
+	case "":
+		return time.Time{}, time.Time{}, fmt.Errorf("empty date range")
+	case "recent":
+		return startOfDay(now.AddDate(0, 0, -1)), nextDay(now), nil
+	case "today":
+		return startOfDay(now), nextDay(now), nil
+	case "yesterday":
+		return startOfDay(now.AddDate(0, 0, -1)), startOfDay(now), nil
+	}
+
+	// "last 3 hours", "last 7 days", "past 2 weeks", "last 6 months"
+	if m := lastNPattern.FindStringSubmatch(expr); m != nil {
+		n, err := rangeCount(m[1], m[2])
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if m[2] == "hour" {
+			return now.Add(-time.Duration(n) * time.Hour), time.Time{}, nil
+		}
+		return startOfDay(shift(now, m[2], -n)), nextDay(now), nil
+	}
+
+	// Calendar periods; weeks start on Monday
+	if m := periodPattern.FindStringSubmatch(expr); m != nil {
+		var start time.Time
+		switch m[2] {
+		case "week":
+			start = startOfWeek(now)
+		case "month":
+			start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		case "year":
+			start = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		}
+		if m[1] == "this" {
+			return start, nextDay(now), nil
+		}
+		return shift(start, m[2], -1), start, nil
+	}
+
+	// "older than 30 days": open start
+	if m := olderPattern.FindStringSubmatch(expr); m != nil {
+		n, err := rangeCount(m[1], m[2])
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if m[2] == "hour" {
+			return time.Time{}, now.Add(-time.Duration(n) * time.Hour), nil
+		}
+		return time.Time{}, nextDay(shift(now, m[2], -n)), nil
+	}
+
+	// "since monday", "after 2024-06-01", "before 2024-06-01"
+	if m := boundPattern.FindStringSubmatch(expr); m != nil {
+		day, err := resolveDay(m[2], now)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		switch m[1] {
+		case "since":
+			return day, time.Time{}, nil
+		case "after":
+			return day.AddDate(0, 0, 1), time.Time{}, nil
+		default:
+			return time.Time{}, day, nil
+		}
+	}
+
+	// "week 23", "w23 2024", "2024-W23"
+	if m := isoWeekPattern.FindStringSubmatch(expr); m != nil {
+		return isoWeek(now, m[2], m[1])
+	}
+	if m := isoWeekIDPattern.FindStringSubmatch(expr); m != nil {
+		return isoWeek(now, m[1], m[2])
+	}
+
+	if m := rangePattern.FindStringSubmatch(expr); m != nil {
+		start, err := time.ParseInLocation("2006-01-02", m[1], now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start date: %w", err)
+		}
+		end, err := time.ParseInLocation("2006-01-02", m[2], now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end date: %w", err)
+		}
+		if end.Before(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("end date is before start date")
+		}
+		return start, nextDay(end), nil
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", expr, now.Location()); err == nil {
+		return day, nextDay(day), nil
+	}
+
+	// "in March", "march 2024": without a year, the latest March that has begun
+	if m := monthPattern.FindStringSubmatch(expr); m != nil {
+		if month, ok := months[m[1]]; ok {
+			year := now.Year()
+			if m[2] != "" {
+				year, _ = strconv.Atoi(m[2])
+			} else if month > now.Month() {
+				year--
+			}
+			start := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+			return start, start.AddDate(0, 1, 0), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("unrecognized date format: %s", expr)
+}
+
+// resolveDay resolves "today", "yesterday", a weekday (its latest
+// occurrence, today included) or a date to the start of that day
+func resolveDay(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "today":
+		return startOfDay(now), nil
+	case "yesterday":
+		return startOfDay(now.AddDate(0, 0, -1)), nil
+	}
+
+	if weekday, ok := weekdays[s]; ok {
+		back := (int(now.Weekday()) - int(weekday) + 7) % 7
+		return startOfDay(now.AddDate(0, 0, -back)), nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized day: %s", s)
+	}
+	return day, nil
+}
+
+// isoWeek returns an ISO 8601 week, from Monday to the next Monday. year may be empty
+// for the current one.
+func isoWeek(now time.Time, year, week string) (time.Time, time.Time, error) {
+	y := now.Year()
+	if year != "" {
+		y, _ = strconv.Atoi(year)
+	}
+	w, _ := strconv.Atoi(week)
+
+	// January 4th is always in week 1
+	monday := startOfWeek(time.Date(y, 1, 4, 0, 0, 0, 0, now.Location())).AddDate(0, 0, (w-1)*7)
+	if _, got := monday.ISOWeek(); w < 1 || got != w {
+		return time.Time{}, time.Time{}, fmt.Errorf("%d has no week %d", y, w)
+	}
+	return monday, monday.AddDate(0, 0, 7), nil
+}
+
+// loadLocation loads a tz: zone; "utc" and "local" are accepted in any case
+func loadLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "utc", "z":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// maxRangeHours bounds the N of "last N" and "older than N", at about
+// 114 years, so the range can't overflow and wrap around
+const maxRangeHours = 1000000
+
+// rangeCount reads the N of "last N days" and the like, refusing spans
+// longer than maxRangeHours
+func rangeCount(digits, unit string) (int, error) {
+	hours := map[string]int{"hour": 1, "day": 24, "week": 7 * 24, "month": 31 * 24}[unit]
+	n, err := strconv.Atoi(digits)
+	if err != nil || n > maxRangeHours/hours {
+		return 0, fmt.Errorf("%s %ss is too far back", digits, unit)
+	}
+	return n, nil
+}
+
+// shift moves t by n hours, days, weeks or months
+func shift(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "year":
+		return t.AddDate(n, 0, 0)
+	default:
+		return t.AddDate(0, 0, n)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// nextDay returns the start of the day after t, the exclusive end of t's day
+func nextDay(t time.Time) time.Time {
+	return startOfDay(t).AddDate(0, 0, 1)
+}
+
+// startOfWeek returns the Monday that starts t's week
+func startOfWeek(t time.Time) time.Time {
+	back := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t.AddDate(0, 0, -back))
+}
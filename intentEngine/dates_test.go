@@ -0,0 +1,273 @@
+package intentengine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no tz data for %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestResolveRange(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	day := func(year int, month time.Month, d, hour, min int) time.Time {
+		return time.Date(year, month, d, hour, min, 0, 0, ny)
+	}
+	var open time.Time
+	// A Wednesday, three days after the switch to daylight saving time
+	now := day(2025, 3, 12, 15, 30)
+
+	tests := []struct {
+		expr       string
+		start, end time.Time
+	}{
+		{"today", day(2025, 3, 12, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"yesterday", day(2025, 3, 11, 0, 0), day(2025, 3, 12, 0, 0)},
+		{"recent", day(2025, 3, 11, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"last 3 hours", day(2025, 3, 12, 12, 30), open},
+		{"last 7 days", day(2025, 3, 5, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"past 2 weeks", day(2025, 2, 26, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"this week", day(2025, 3, 10, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"last week", day(2025, 3, 3, 0, 0), day(2025, 3, 10, 0, 0)},
+		{"last month", day(2025, 2, 1, 0, 0), day(2025, 3, 1, 0, 0)},
+		{"this year", day(2025, 1, 1, 0, 0), day(2025, 3, 13, 0, 0)},
+		{"last year", day(2024, 1, 1, 0, 0), day(2025, 1, 1, 0, 0)},
+		{"older than 30 days", open, day(2025, 2, 11, 0, 0)},
+		{"older than 2 hours", open, day(2025, 3, 12, 13, 30)},
+		{"since monday", day(2025, 3, 10, 0, 0), open},
+		{"since wednesday", day(2025, 3, 12, 0, 0), open},
+		{"since thursday", day(2025, 3, 6, 0, 0), open},
+		{"after 2025-03-01", day(2025, 3, 2, 0, 0), open},
+		{"before 2025-03-01", open, day(2025, 3, 1, 0, 0)},
+		{"2025-03-01 to 2025-03-09", day(2025, 3, 1, 0, 0), day(2025, 3, 10, 0, 0)},
+		{"2025-03-09", day(2025, 3, 9, 0, 0), day(2025, 3, 10, 0, 0)},
+		{"in march", day(2025, 3, 1, 0, 0), day(2025, 4, 1, 0, 0)},
+		{"in april", day(2024, 4, 1, 0, 0), day(2024, 5, 1, 0, 0)},
+		{"dec 2023", day(2023, 12, 1, 0, 0), day(2024, 1, 1, 0, 0)},
+	}
+	for _, tt := range tests {
+		start, end, err := resolveRange(tt.expr, now)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%q = [%v, %v), want [%v, %v)", tt.expr, start, end, tt.start, tt.end)
+		}
+	}
+
+	for _, expr := range []string{"", "next tuesday", "since someday", "2025-03-09 to 2025-03-01", "week 0", "week 53 2021"} {
+		if _, _, err := resolveRange(expr, now); err == nil {
+			t.Errorf("%q resolved, want an error", expr)
+		}
+	}
+}
+
+func TestResolveISOWeek(t *testing.T) {
+	now := time.Date(2025, 3, 12, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr  string
+		start string // Monday the week starts on
+	}{
+		{"week 11", "2025-03-10"},
+		{"w1 2025", "2024-12-30"},
+		{"week 1 2021", "2021-01-04"},
+		{"2020-w53", "2020-12-28"},
+		{"2026w1", "2025-12-29"},
+	}
+	for _, tt := range tests {
+		start, end, err := resolveRange(tt.expr, now)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := start.Format("2006-01-02"); got != tt.start || end.Sub(start) != 7*24*time.Hour {
+			t.Errorf("%q = [%v, %v), want a week from %s", tt.expr, start, end, tt.start)
+		}
+	}
+}
+
+func TestResolveRangeAcrossDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	tests := []struct {
+		now  time.Time
+		expr string
+		want time.Duration
+	}{
+		// Clocks skip 2:00 on March 9th and repeat 1:00 on November 2nd
+		{time.Date(2025, 3, 9, 12, 0, 0, 0, ny), "today", 23 * time.Hour},
+		{time.Date(2025, 11, 2, 12, 0, 0, 0, ny), "today", 25 * time.Hour},
+		{time.Date(2025, 3, 10, 12, 0, 0, 0, ny), "yesterday", 23 * time.Hour},
+		{time.Date(2025, 3, 12, 12, 0, 0, 0, ny), "last week", 7*24*time.Hour - time.Hour},
+	}
+	for _, tt := range tests {
+		start, end, err := resolveRange(tt.expr, tt.now)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if got := end.Sub(start); got != tt.want {
+			t.Errorf("%q on %s spans %v, want %v", tt.expr, tt.now.Format("Jan 2"), got, tt.want)
+		}
+		if start.Hour() != 0 || end.Hour() != 0 {
+			t.Errorf("%q on %s = [%v, %v), want local midnights", tt.expr, tt.now.Format("Jan 2"), start, end)
+		}
+	}
+}
+
+func TestParseDateRangeTimeZone(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	tokyo := mustLoad(t, "Asia/Tokyo")
+	p := NewParser()
+	// Wednesday afternoon in New York is already Thursday in Tokyo
+	p.SetClock(func() time.Time { return time.Date(2025, 3, 12, 15, 30, 0, 0, ny) })
+
+	tests := []struct {
+		input string
+		start time.Time
+	}{
+		{`search from "a@example.org" [today]`, time.Date(2025, 3, 12, 0, 0, 0, 0, ny)},
+		{`search from "a@example.org" [today tz:Asia/Tokyo]`, time.Date(2025, 3, 13, 0, 0, 0, 0, tokyo)},
+		{`search from "a@example.org" [today tz:UTC]`, time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		intent, err := p.Parse(tt.input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		r := intent.DateRange
+		if r == nil || !r.Start.Equal(tt.start) || !r.End.Equal(tt.start.AddDate(0, 0, 1)) {
+			t.Errorf("%s = %+v, want the day from %v", tt.input, r, tt.start)
+		}
+	}
+
+	if _, err := p.Parse(`search from "a@example.org" [today tz:Mars/Olympus]`); err == nil {
+		t.Error("unknown time zone parsed")
+	}
+}
+
+func TestParseDateRangeTooFarBack(t *testing.T) {
+	p := NewParser()
+	for _, expr := range []string{
+		"older than 3000000 hours",
+		"older than 99999999999999999999 days",
+		"last 50000 days",
+		"last 9999 months",
+	} {
+		input := `trash from "x@example.org" [` + expr + `]`
+		_, err := p.Parse(input)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: err = %v, want a parse error", input, err)
+		}
+	}
+
+	if _, err := p.Parse(`search from "x@example.org" [older than 1000000 hours]`); err != nil {
+		t.Errorf("the longest span allowed: %v", err)
+	}
+}
+
+func TestDateRangeContains(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	// March 9th in New York is 23 hours long
+	start := time.Date(2025, 3, 9, 0, 0, 0, 0, ny)
+	end := time.Date(2025, 3, 10, 0, 0, 0, 0, ny)
+	var open time.Time
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		t          time.Time
+		want       bool
+	}{
+		{"start", start, end, start, true},
+		{"before start", start, end, start.Add(-time.Nanosecond), false},
+		{"last instant", start, end, end.Add(-time.Nanosecond), true},
+		{"end", start, end, end, false},
+		{"before the clocks change", start, end, time.Date(2025, 3, 9, 1, 59, 59, 0, ny), true},
+		{"after the clocks change", start, end, time.Date(2025, 3, 9, 3, 0, 0, 0, ny), true},
+		{"end in UTC", start, end, end.UTC(), false},
+		{"last instant in UTC", start, end, time.Date(2025, 3, 10, 3, 59, 59, 0, time.UTC), true},
+		{"open start", open, end, time.Time{}.Add(time.Hour), true},
+		{"open start, end", open, end, end, false},
+		{"open end", start, open, start.AddDate(100, 0, 0), true},
+		{"open end, before start", start, open, start.Add(-time.Nanosecond), false},
+	}
+	for _, tt := range tests {
+		r := &DateRange{Start: tt.start, End: tt.end}
+		if got := r.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestInRange(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	r := &DateRange{Start: time.Date(2025, 3, 9, 0, 0, 0, 0, ny), End: time.Date(2025, 3, 10, 0, 0, 0, 0, ny)}
+	messages := []Email{
+		{Subject: "before", Date: r.Start.Add(-time.Second)},
+		{Subject: "start", Date: r.Start},
+		{Subject: "last", Date: r.End.Add(-time.Second)},
+		{Subject: "end", Date: r.End},
+	}
+
+	var kept []string
+	for _, msg := range inRange(messages, r) {
+		kept = append(kept, msg.Subject)
+	}
+	if strings.Join(kept, ",") != "start,last" {
+		t.Errorf("kept %v, want start,last", kept)
+	}
+	if got := inRange(messages[:1], nil); len(got) != 1 {
+		t.Errorf("no range kept %d messages, want all", len(got))
+	}
+}
+
+func TestBuildSearchCriteriaWidensDays(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	day := func(d, hour, min int) time.Time {
+		return time.Date(2025, 3, d, hour, min, 0, 0, ny)
+	}
+	var open time.Time
+
+	tests := []struct {
+		name          string
+		start, end    time.Time
+		since, before string // Dates sent in SEARCH, "" when absent
+	}{
+		{"whole day", day(9, 0, 0), day(10, 0, 0), "2025-03-08", "2025-03-11"},
+		{"two days", day(8, 0, 0), day(10, 0, 0), "2025-03-07", "2025-03-11"},
+		{"partial days", day(11, 12, 30), day(12, 13, 30), "2025-03-10", "2025-03-14"},
+		{"open start", open, day(10, 0, 0), "", "2025-03-11"},
+		{"open end", day(9, 0, 0), open, "2025-03-08", ""},
+	}
+	for _, tt := range tests {
+		intent := &Intent{Command: CommandSearch, DateRange: &DateRange{Start: tt.start, End: tt.end}}
+		criteria := buildSearchCriteria(intent)
+
+		format := func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format("2006-01-02")
+		}
+		if got := format(criteria.Since); got != tt.since {
+			t.Errorf("%s: SINCE %q, want %q", tt.name, got, tt.since)
+		}
+		if got := format(criteria.Before); got != tt.before {
+			t.Errorf("%s: BEFORE %q, want %q", tt.name, got, tt.before)
+		}
+	}
+
+	if criteria := buildSearchCriteria(&Intent{Command: CommandSearch}); !criteria.Since.IsZero() || !criteria.Before.IsZero() {
+		t.Error("no date range still sent SINCE or BEFORE")
+	}
+}
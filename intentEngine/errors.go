@@ -0,0 +1,157 @@
+package intentengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError describes where and why a command failed to parse. It is
+// plain data so other front ends can render it their own way.
+type ParseError struct {
+	Input      string   `json:"input"`
+	Offset     int      `json:"offset"` // Byte offset of the bad spot in Input
+	Message    string   `json:"message"`
+	Expected   []string `json:"expected,omitempty"`   // Tokens that would have been accepted
+	Suggestion string   `json:"suggestion,omitempty"` // Corrected command, when a likely typo was found
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s at position %d", e.Message, e.column()+1)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean: %s)", e.Suggestion)
+	}
+	return msg
+}
+
+// Render shows the input with a caret under the bad spot, followed by what
+// was expected and any suggestion
+func (e *ParseError) Render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %s\n", e.Input)
+	fmt.Fprintf(&b, "  %s^\n", strings.Repeat(" ", e.column()))
+	fmt.Fprintf(&b, "%s\n", e.Message)
+	if len(e.Expected) > 0 {
+		fmt.Fprintf(&b, "Expected: %s\n", strings.Join(e.Expected, ", "))
+	}
+	if e.Suggestion != "" {
+		fmt.Fprintf(&b, "Did you mean: %s\n", e.Suggestion)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// column converts the byte offset to a character column
+func (e *ParseError) column() int {
+	offset := e.Offset
+	if offset > len(e.Input) {
+		offset = len(e.Input)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return utf8.RuneCountInString(e.Input[:offset])
+}
+
+// Tokens accepted at the start of a command, after the verb and inside
+// a date range
+var (
+	verbTokens   = []string{"search", "listen", "archive", "trash", "star", "unstar", "mark", "label", "move", "undo", "reply", "sync", "folders", "expand", "next", "attachments", "export", "save", "define", "run"}
+	clauseTokens = []string{"for", "on", `"keywords"`, "from", "[date]", "about", "in", "respond", "sort", "limit", "page", "has:attachment", "filename:", "larger", "to", "--dry-run", "--draft"}
+	dateForms    = []string{"today", "yesterday", "recent", "last N hours|days|weeks|months", "this|last week|month|year",
+		"since <day>", "before|after <date>", "older than N days", "in <month>", "week N", "YYYY-MM-DD", "YYYY-MM-DD to YYYY-MM-DD"}
+)
+
+// dateWords are the words date expressions are built from
+var dateWords = []string{
+	"recent", "today", "yesterday", "last", "past", "this", "older", "than",
+	"since", "after", "before", "in", "to", "week", "weeks", "month", "months",
+	"year", "hour", "hours", "day", "days",
+}
+
+func init() {
+	for name := range weekdays {
+		dateWords = append(dateWords, name)
+	}
+	for name := range months {
+		dateWords = append(dateWords, name)
+	}
+	sort.Strings(dateWords)
+}
+
+// closest returns the words in vocab within a small edit distance of word,
+// best first: fewest edits, then closest in length
+func closest(word string, vocab []string) []string {
+	word = strings.ToLower(word)
+	limit := 1 + len(word)/4
+
+	type candidate struct {
+		word       string
+		dist, diff int
+	}
+	var candidates []candidate
+	for _, v := range vocab {
+		if v == word {
+			return nil
+		}
+		if d := editDistance(word, v); d <= limit && d < len(word) {
+			diff := len(v) - len(word)
+			if diff < 0 {
+				diff = -diff
+			}
+			candidates = append(candidates, candidate{v, d, diff})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		return candidates[i].diff < candidates[j].diff
+	})
+
+	words := make([]string, len(candidates))
+	for i, c := range candidates {
+		words[i] = c.word
+	}
+	return words
+}
+
+// editDistance is the optimal string alignment distance: insertions,
+// deletions, substitutions and swaps of adjacent letters each cost one
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// leadingWord returns the word at the start of s
+func leadingWord(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-')
+	})
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
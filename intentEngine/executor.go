@@ -1,334 +1,546 @@
 package intentengine
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/mail"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/PlantingTrees/intent/index"
+	"github.com/PlantingTrees/intent/jmap"
+	"github.com/PlantingTrees/intent/responder"
+	"github.com/PlantingTrees/intent/schedule"
+	"github.com/PlantingTrees/intent/semantic"
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/jhillyerd/enmime"
 )
 
 // Email represents a simplified email structure for filtering
 type Email struct {
-	ID      string
-	From    string
-	Subject string
-	Date    time.Time
-	Body    string
+	ID        string
+	UID       uint32
+	MessageID string
+	From      string
+	Subject   string
+	Date      time.Time
+	Flags     []string
+	Body      string
+	Mailbox   string // Where the message was found, empty for archive and JMAP results
+	Size      uint32 // Size in bytes, zero when unknown
+
+	// Files attached to the message, when its body was fetched
+	Attachments []Attachment
+
+	// Gmail labels, when the backend has them and they were asked for
+	Labels []string
+
+	// Conversation: the server's thread ID when it has one (Gmail, JMAP),
+	// otherwise the reply headers that link messages together
+	ThreadID   string
+	InReplyTo  string
+	References []string
 }
 
 // Executor executes parsed intents
 type Executor struct {
-	imapClient *client.Client
+	imapClient       *client.Client
+	backend          Backend
+	confirm          func(prompt string) bool
+	confirmThreshold int
+	journal          *Journal
+	responder        *responder.Responder
+	embedder         semantic.Embedder
+	vectors          *semantic.Cache
+	index            *index.Index
+	dial             func() (*client.Client, error)
+	folderWorkers    int
+	macros           *Macros
+	schedule         *schedule.Store
+	out              io.Writer // Where results and progress are printed
+
+	// Results of the last search, for commands that refer to them by number
+	lastResults []Email
+	threads     []Thread // Conversations of the last search, for expand
+	lastSearch  *Intent  // The last search and its result count, for next
+	lastTotal   int
+
+	// Called for each new message a listener matches
+	onMatch func(Email)
 }
 
+// SessionFunc opens a new authenticated executor, with its own
+// connection, and returns how to close it
+type SessionFunc func() (*Executor, func(), error)
+
 // NewExecutor creates a new executor instance with IMAP client
 func NewExecutor(c *client.Client) *Executor {
-	return &Executor{
-		imapClient: c,
+	e := &Executor{
+		imapClient:       c,
+		confirmThreshold: DefaultConfirmThreshold,
+		folderWorkers:    DefaultFolderWorkers,
+		out:              os.Stdout,
+	}
+	if c != nil {
+		e.backend = &imapBackend{c}
 	}
+	return e
+}
+
+// SetOutput sets where results and progress are printed, os.Stdout by
+// default
+func (e *Executor) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// SetBackend sets the store that searches, listeners, actions and undo run
+// against. It defaults to the IMAP connection.
+func (e *Executor) SetBackend(b Backend) {
+	e.backend = b
+}
+
+// SetConfirm sets the prompt used before large bulk actions.
+// Actions above the threshold are refused when no prompt is set.
+func (e *Executor) SetConfirm(confirm func(prompt string) bool, threshold int) {
+	e.confirm = confirm
+	e.confirmThreshold = threshold
+}
+
+// SetJournal sets the journal that records actions so they can be undone
+func (e *Executor) SetJournal(j *Journal) {
+	e.journal = j
+}
+
+// SetResponder sets the responder used to send and draft replies
+func (e *Executor) SetResponder(r *responder.Responder) {
+	e.responder = r
+}
+
+// SetEmbedder sets the embedder and vector cache used by SEARCH ABOUT
+func (e *Executor) SetEmbedder(embedder semantic.Embedder, cache *semantic.Cache) {
+	e.embedder = embedder
+	e.vectors = cache
+}
+
+// SetIndex sets the local index that searches are answered from once synced
+func (e *Executor) SetIndex(ix *index.Index) {
+	e.index = ix
+}
+
+// SetJMAP sets a JMAP server as the backend, instead of IMAP
+func (e *Executor) SetJMAP(c *jmap.Client) {
+	e.backend = newJMAPBackend(c)
 }
 
 // Execute executes the given intent
-func (e *Executor) Execute(intent *Intent) (interface{}, error) {
+func (e *Executor) Execute(intent *Intent) (*Result, error) {
 	switch intent.Command {
 	case CommandSearch:
 		return e.executeSearch(intent)
 	case CommandListen:
 		return e.executeListen(intent)
+	case CommandUndo:
+		return e.executeUndo(intent)
+	case CommandReply:
+		return e.executeReply(intent)
+	case CommandSync:
+		return e.executeSync(intent)
+	case CommandFolders:
+		return e.executeFolders(intent)
+	case CommandExpand:
+		return e.executeExpand(intent)
+	case CommandNext:
+		return e.executeNext(intent)
+	case CommandAttachments:
+		return e.executeAttachments(intent)
+	case CommandSaveAttachments:
+		return e.executeSaveAttachments(intent)
+	case CommandExport:
+		return e.executeExport(intent)
+	case CommandSave, CommandDefine:
+		return e.executeSave(intent)
+	case CommandSchedule:
+		return e.executeSchedule(intent)
 	default:
+		if intent.Command.IsAction() {
+			return e.executeAction(intent)
+		}
 		return nil, fmt.Errorf("unknown command type: %s", intent.Command)
 	}
 }
 
 // executeSearch performs a search based on the intent using Gmail IMAP
-func (e *Executor) executeSearch(intent *Intent) (interface{}, error) {
-	fmt.Println("\n=== Executing SEARCH ===")
-	fmt.Println("Keywords:", strings.Join(intent.Keywords, ", "))
-	fmt.Println("Sender:", intent.Sender)
-	if intent.AllFromSender {
-		fmt.Println("Mode: ALL emails from sender domain")
+func (e *Executor) executeSearch(intent *Intent) (*Result, error) {
+	if intent.About != "" {
+		return e.executeSemanticSearch(intent)
 	}
-	if intent.DateRange != nil {
-		fmt.Printf("Date Range: %s to %s\n",
-			intent.DateRange.Start.Format("2006-01-02"),
-			intent.DateRange.End.Format("2006-01-02"))
+	if intent.Archive != "" {
+		return e.executeArchiveSearch(intent)
+	}
+	if intent.AllFolders {
+		return e.executeFolderSearch(intent)
 	}
 
-	// Select INBOX
-	mbox, err := e.imapClient.Select("INBOX", false)
+	fmt.Fprintln(e.out, "\n=== Executing SEARCH ===")
+	fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	if intent.AllFromSender {
+		fmt.Fprintln(e.out, "Mode: ALL emails from sender domain")
+	}
+	e.printDateRange(intent)
+
+	folder, err := e.backend.Open(intent.Folder(), false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select INBOX: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("\nMailbox: %s (%d messages)\n", mbox.Name, mbox.Messages)
+	fmt.Fprintf(e.out, "\nMailbox: %s (%d messages)\n", folder.Name, folder.Messages)
+
+	// Answer from the local index when it mirrors this mailbox. The index
+	// doesn't know attachments or sizes.
+	if e.imapClient != nil && e.index != nil && !intent.HasAttachmentFilter() && intent.LargerThan == 0 && e.index.Covers(folder.Name, folder.UIDValidity) {
+		if messages, ok := e.searchIndex(intent, e.imapClient.Mailbox()); ok {
+			total := len(messages)
+			messages = e.paginate(intent, messages)
 
-	// Build IMAP search criteria
-	criteria := e.buildSearchCriteria(intent)
+			fmt.Fprintf(e.out, "✓ Found %d matching messages (local index)\n\n", total)
+			if total == 0 {
+				fmt.Fprintln(e.out, "No messages found matching your criteria.")
+			} else {
+				fmt.Fprint(e.out, "=== Search Results ===\n\n")
+			}
+			threads := e.printThreads(messages)
+			e.printPage(intent, len(messages), DefaultPageSize)
+
+			return &Result{Command: CommandSearch, Count: total, Messages: messages, Threads: threads}, nil
+		}
+	}
 
-	fmt.Println("\nSearching...")
+	fmt.Fprintln(e.out, "\nSearching...")
 
-	// Perform search
-	seqNums, err := e.imapClient.Search(criteria)
+	// The backend finds the matches in the order shown, and returns the
+	// page shown
+	messages, total, err := e.backend.Search(intent)
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
+		return nil, err
 	}
+	e.remember(intent, total)
 
-	fmt.Printf("✓ Found %d matching messages\n\n", len(seqNums))
+	fmt.Fprintf(e.out, "✓ Found %d matching messages\n\n", total)
 
-	if len(seqNums) == 0 {
-		fmt.Println("No messages found matching your criteria.")
-		return map[string]interface{}{
-			"command": "search",
-			"count":   0,
-			"results": []map[string]string{},
-		}, nil
+	if total == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+		return &Result{Command: CommandSearch}, nil
 	}
 
-	// Fetch message details
-	messages := e.fetchMessages(seqNums)
-
 	// Display results
-	fmt.Println("=== Search Results ===\n")
-	results := []map[string]string{}
+	fmt.Fprint(e.out, "=== Search Results ===\n\n")
+	threads := e.printThreads(messages)
+	e.printPage(intent, len(messages), DefaultPageSize)
 
-	for i, msg := range messages {
-		fmt.Printf("[%d] From: %s\n", i+1, msg.From)
-		fmt.Printf("    Subject: %s\n", msg.Subject)
-		fmt.Printf("    Date: %s\n", msg.Date.Format("2006-01-02 15:04:05"))
-		fmt.Println()
-
-		results = append(results, map[string]string{
-			"from":    msg.From,
-			"subject": msg.Subject,
-			"date":    msg.Date.Format("2006-01-02 15:04:05"),
-		})
+	return &Result{Command: CommandSearch, Count: total, Messages: messages, Threads: threads}, nil
+}
+
+// printDateRange prints the intent's date range, if any
+func (e *Executor) printDateRange(intent *Intent) {
+	if intent.DateRange == nil {
+		return
 	}
+	r := intent.DateRange
+
+	switch {
+	case r.Start.IsZero():
+		fmt.Fprintf(e.out, "Date Range: before %s\n", formatBound(r.End))
+	case r.End.IsZero():
+		fmt.Fprintf(e.out, "Date Range: since %s\n", formatBound(r.Start))
+	case isMidnight(r.Start) && isMidnight(r.End):
+		// Whole days: show the last day included rather than the bound
+		fmt.Fprintf(e.out, "Date Range: %s to %s\n", r.Start.Format("2006-01-02"), r.End.AddDate(0, 0, -1).Format("2006-01-02"))
+	default:
+		fmt.Fprintf(e.out, "Date Range: %s to %s\n", formatBound(r.Start), formatBound(r.End))
+	}
+}
 
-	return map[string]interface{}{
-		"command": "search",
-		"count":   len(messages),
-		"results": results,
-	}, nil
+// formatBound formats a range bound as a date, with the time when it
+// isn't midnight
+func formatBound(t time.Time) string {
+	if isMidnight(t) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04 MST")
 }
 
-// executeListen sets up a listener/watcher for emails
+func isMidnight(t time.Time) bool {
+	return t.Equal(startOfDay(t))
+}
 
-func (e *Executor) executeListen(intent *Intent) (interface{}, error) {
-	fmt.Println("\n=== LISTENING  ===")
-	fmt.Println("Watching for emails from:", intent.Sender)
+// inRange keeps the messages whose date falls within r
+func inRange(messages []Email, r *DateRange) []Email {
+	if r == nil {
+		return messages
+	}
 
-	mbox, err := e.imapClient.Select("[Gmail]/All Mail", false)
-	if err != nil {
-		return nil, err
+	kept := messages[:0]
+	for _, msg := range messages {
+		if r.Contains(msg.Date) {
+			kept = append(kept, msg)
+		}
 	}
+	return kept
+}
 
-	lastUID := mbox.UidNext - 1
+// printResults prints a numbered list of messages
+func (e *Executor) printResults(messages []Email) {
+	for i, msg := range messages {
+		fmt.Fprintf(e.out, "[%d] From: %s\n", i+1, msg.From)
+		fmt.Fprintf(e.out, "    Subject: %s\n", msg.Subject)
+		fmt.Fprintf(e.out, "    Date: %s\n", msg.Date.Format("2006-01-02 15:04:05"))
+		if msg.Mailbox != "" && msg.Mailbox != "INBOX" {
+			fmt.Fprintf(e.out, "    Folder: %s\n", msg.Mailbox)
+		}
+		if names := attachmentNames(msg); names != "" {
+			fmt.Fprintf(e.out, "    Attachments: %s\n", names)
+		}
+		fmt.Fprintln(e.out)
+	}
+}
 
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
+// executeListen sets up a listener/watcher for emails
+
+func (e *Executor) executeListen(intent *Intent) (*Result, error) {
+	return nil, e.Listen(context.Background(), intent)
+}
 
-	for {
-		<-ticker.C
+// Listen watches for new mail matching a listen intent until ctx is done
+func (e *Executor) Listen(ctx context.Context, intent *Intent) error {
+	fmt.Fprintln(e.out, "\n=== LISTENING  ===")
+	fmt.Fprintln(e.out, "Watching for emails from:", intent.Sender)
 
-		mbox, err := e.imapClient.Select("[Gmail]/All Mail", false)
+	var auto *responder.AutoResponder
+	if intent.Template != "" {
+		tmpl, err := responder.LoadTemplate(templateDir, intent.Template)
 		if err != nil {
-			log.Println("Select error:", err)
-			continue
+			return err
 		}
-
-		if mbox.UidNext <= lastUID+1 {
-			continue // nothing new
+		auto, err = responder.NewAutoResponder(e.responder, tmpl, autoReplyLog)
+		if err != nil {
+			return err
 		}
+		fmt.Fprintln(e.out, "Auto-responding with:", intent.Template)
+	}
 
-		// Fetch ONLY new messages
-		set := new(imap.SeqSet)
-		set.AddRange(lastUID+1, mbox.UidNext-1)
-
-		messages := make(chan *imap.Message, 10)
-		go func() {
-			_ = e.imapClient.UidFetch(set, []imap.FetchItem{
-				imap.FetchUid,
-				imap.FetchEnvelope,
-				imap.FetchInternalDate,
-			}, messages)
-		}()
-
-		for msg := range messages {
-			lastUID = msg.Uid
+	// Listeners watch the same folder searches and actions default to
+	watched := intent.Folder()
+	fmt.Fprintln(e.out, "Folder:", watched)
 
-			if msg.Envelope == nil || len(msg.Envelope.From) == 0 {
+	return e.backend.Watch(ctx, watched, func(arrived []Email) {
+		var matched []uint32
+		for _, msg := range arrived {
+			if !strings.Contains(strings.ToLower(msg.From), strings.ToLower(intent.Sender)) {
 				continue
 			}
+			fmt.Fprintln(e.out, "📧 NEW EMAIL RECEIVED!")
+			fmt.Fprintf(e.out, "   From: %s\n", msg.From)
+			fmt.Fprintf(e.out, "   Subject: %s\n", msg.Subject)
+			fmt.Fprintf(e.out, "   Date: %s\n\n", msg.Date)
+			matched = append(matched, msg.UID)
+
+			if e.onMatch != nil {
+				e.onMatch(msg)
+			}
+		}
 
-			addr := msg.Envelope.From[0]
-			from := fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+		// Answer once the batch is in, the connection is free again
+		if auto != nil {
+			for _, uid := range matched {
+				e.autoRespond(auto, uid)
+			}
+		}
 
-			if strings.Contains(strings.ToLower(from), strings.ToLower(intent.Sender)) {
-				fmt.Println("📧 NEW EMAIL RECEIVED!")
-				fmt.Printf("   From: %s\n", from)
-				fmt.Printf("   Subject: %s\n", msg.Envelope.Subject)
-				fmt.Printf("   Date: %s\n\n", msg.InternalDate)
+		// Keep the local index current with what just arrived
+		if e.imapClient != nil && e.index != nil && e.index.LastUID > 0 {
+			if _, _, err := e.syncIndex(false); err != nil {
+				log.Println("Index sync error:", err)
 			}
 		}
-	}
+	})
 }
 
-// func (e *Executor) executeListen(intent *Intent) (interface{}, error) {
-// 	fmt.Println("\n=== Executing LISTEN ===")
-// 	fmt.Println("Watching for emails from:", intent.Sender)
-// 	if intent.AllFromSender {
-// 		fmt.Println("Mode: ALL emails from sender domain")
-// 	}
-//
-// 	// Select INBOX
-// 	_, err := e.imapClient.Select("INBOX", false)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to select INBOX: %w", err)
-// 	}
-//
-// 	fmt.Println("\n✓ Listening... (Press Ctrl+C to stop)")
-// 	fmt.Println("Checking for new messages periodically...\n")
-//
-// 	// Keep track of seen messages
-// 	seenMsgs := make(map[uint32]bool)
-//
-// 	// Build criteria for the sender
-// 	criteria := imap.NewSearchCriteria()
-// 	if intent.AllFromSender {
-// 		// For wildcard, we'll check all messages and filter in code
-// 		criteria.WithoutFlags = []string{imap.SeenFlag}
-// 	} else {
-// 		criteria.Header.Set("From", intent.Sender)
-// 		criteria.WithoutFlags = []string{imap.SeenFlag}
-// 	}
-//
-// 	// Polling loop
-// 	ticker := time.NewTicker(5 * time.Second)
-// 	defer ticker.Stop()
-//
-// 	for {
-// 		select {
-// 		case <-ticker.C:
-// 			// Search for new messages
-// 			seqNums, err := e.imapClient.Search(criteria)
-// 			if err != nil {
-// 				log.Printf("Search error: %v", err)
-// 				continue
-// 			}
-//
-// 			// Filter out already seen messages
-// 			var newMsgs []uint32
-// 			for _, num := range seqNums {
-// 				if !seenMsgs[num] {
-// 					newMsgs = append(newMsgs, num)
-// 					seenMsgs[num] = true
-// 				}
-// 			}
-//
-// 			if len(newMsgs) > 0 {
-// 				messages := e.fetchMessages(newMsgs)
-//
-// 				for _, msg := range messages {
-// 					// If wildcard, filter by domain
-// 					if intent.AllFromSender {
-// 						if !strings.Contains(strings.ToLower(msg.From), strings.ToLower(intent.Sender)) {
-// 							continue
-// 						}
-// 					}
-//
-// 					fmt.Println("📧 NEW EMAIL RECEIVED!")
-// 					fmt.Printf("   From: %s\n", msg.From)
-// 					fmt.Printf("   Subject: %s\n", msg.Subject)
-// 					fmt.Printf("   Date: %s\n\n", msg.Date.Format("2006-01-02 15:04:05"))
-// 				}
-// 			}
-// 		}
-// 	}
-// } // executeListen sets up a listener/watcher for emails
-//
-// executeListen sets up a listener/watcher for ALL emails
+// autoRespond runs the auto-responder on a newly received message
+func (e *Executor) autoRespond(auto *responder.AutoResponder, uid uint32) {
+	raw, err := e.fetchRaw(uid)
+	if err != nil {
+		log.Println("Auto-respond error:", err)
+		return
+	}
+
+	orig, err := responder.ParseOriginal(raw)
+	if err != nil {
+		log.Println("Auto-respond error:", err)
+		return
+	}
+
+	sent, reason, err := auto.Respond(orig)
+	switch {
+	case err != nil:
+		log.Println("Auto-respond error:", err)
+	case sent:
+		fmt.Fprintf(e.out, "   ↩ Auto-replied to %s\n\n", orig.From.Address)
+	default:
+		fmt.Fprintf(e.out, "   ↩ Not auto-replying: %s\n\n", reason)
+	}
+}
 
 // buildSearchCriteria builds IMAP search criteria from intent
-func (e *Executor) buildSearchCriteria(intent *Intent) *imap.SearchCriteria {
+func buildSearchCriteria(intent *Intent) *imap.SearchCriteria {
 	criteria := imap.NewSearchCriteria()
 
-	// Add sender filter
+	// Add sender filter. IMAP FROM matches substrings, so a wildcard
+	// sender narrows the search to its domain
 	if intent.Sender != "" {
-		if intent.AllFromSender {
-			// For wildcard, we search all and filter afterwards
-			// IMAP doesn't support wildcard domains directly
-		} else {
-			criteria.Header.Set("From", intent.Sender)
-		}
+		criteria.Header.Set("From", intent.Sender)
 	}
 
-	// Add date range filter
+	// Add date range filter. SINCE and BEFORE compare INTERNALDATE by
+	// day only, in the server's time zone, so the window is widened by a
+	// day on each side and results are trimmed with DateRange.Contains
 	if intent.DateRange != nil {
-		criteria.Since = intent.DateRange.Start
-		criteria.Before = intent.DateRange.End
+		if !intent.DateRange.Start.IsZero() {
+			criteria.Since = startOfDay(intent.DateRange.Start).AddDate(0, 0, -1)
+		}
+		if !intent.DateRange.End.IsZero() {
+			// The day holding the last included instant, plus one
+			last := intent.DateRange.End.Add(-time.Nanosecond)
+			criteria.Before = nextDay(last).AddDate(0, 0, 1)
+		}
 	}
 
-	// Note: IMAP SEARCH doesn't support OR for text terms easily
-	// For keywords, we'll do multiple searches or filter in code
-	// For now, if keywords exist, we'll search for them in subject/body
+	// A message matches when it holds any of the keywords
 	if len(intent.Keywords) > 0 {
-		// Search for first keyword in text
-		// Gmail supports X-GM-RAW for more complex queries
-		criteria.Text = []string{intent.Keywords[0]}
+		keywords := anyText(intent.Keywords)
+		criteria.Text, criteria.Or = keywords.Text, keywords.Or
+	}
+
+	if intent.LargerThan > 0 {
+		criteria.Larger = uint32(intent.LargerThan)
 	}
 
 	return criteria
 }
 
-// fetchMessages retrieves full message details for given sequence numbers
-func (e *Executor) fetchMessages(seqNums []uint32) []Email {
-	if len(seqNums) == 0 {
+// anyText builds criteria matching text holding any of the keywords, as
+// nested ORs since IMAP's OR takes two keys
+func anyText(keywords []string) *imap.SearchCriteria {
+	first := &imap.SearchCriteria{Text: keywords[:1]}
+	if len(keywords) == 1 {
+		return first
+	}
+	return &imap.SearchCriteria{Or: [][2]*imap.SearchCriteria{{first, anyText(keywords[1:])}}}
+}
+
+// fetchMessages retrieves full message details for given sequence numbers,
+// or for UIDs when uid is set
+func (e *Executor) fetchMessages(ids []uint32, uid bool) []Email {
+	return fetchFrom(e.imapClient, ids, uid)
+}
+
+// senderOf formats an envelope's sender as "Name <address>"
+func senderOf(env *imap.Envelope) string {
+	if len(env.From) == 0 {
+		return "Unknown"
+	}
+	addr := env.From[0]
+	if addr.PersonalName != "" {
+		return fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName)
+	}
+	return fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+}
+
+// fetchFrom fetches messages from the mailbox selected on c
+func fetchFrom(c *client.Client, ids []uint32, uid bool) []Email {
+	if len(ids) == 0 {
 		return []Email{}
 	}
 
 	// Create sequence set
 	seqSet := new(imap.SeqSet)
-	seqSet.AddNum(seqNums...)
+	seqSet.AddNum(ids...)
 
 	// Fetch envelope and date
-	messages := make(chan *imap.Message, len(seqNums))
-	section := &imap.BodySectionName{}
+	// Peek so that listing results doesn't mark them as read
+	messages := make(chan *imap.Message, len(ids))
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{
+		imap.FetchUid,
+		imap.FetchEnvelope,
+		imap.FetchInternalDate,
+		imap.FetchFlags,
+		imap.FetchRFC822Size,
+		section.FetchItem(),
+	}
+	// Gmail knows each message's conversation
+	if gmail, _ := c.Support("X-GM-EXT-1"); gmail {
+		items = append(items, "X-GM-THRID")
+	}
 
 	done := make(chan error, 1)
 	go func() {
-		done <- e.imapClient.Fetch(seqSet, []imap.FetchItem{
-			imap.FetchEnvelope,
-			imap.FetchInternalDate,
-			section.FetchItem(),
-		}, messages)
+		if uid {
+			done <- c.UidFetch(seqSet, items, messages)
+		} else {
+			done <- c.Fetch(seqSet, items, messages)
+		}
 	}()
 
+	mailbox := ""
+	if mbox := c.Mailbox(); mbox != nil {
+		mailbox = mbox.Name
+	}
+
 	var emails []Email
 	for msg := range messages {
 		if msg.Envelope == nil {
 			continue
 		}
 
-		// Extract sender
-		from := "Unknown"
-		if len(msg.Envelope.From) > 0 {
-			addr := msg.Envelope.From[0]
-			if addr.PersonalName != "" {
-				from = fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName)
-			} else {
-				from = fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+		// Keep the readable text; enmime strips HTML when there is no text part
+		body := ""
+		var references []string
+		var attachments []Attachment
+		if r := msg.GetBody(section); r != nil {
+			if env, err := enmime.ReadEnvelope(r); err == nil {
+				body = env.Text
+				references = strings.Fields(env.GetHeader("References"))
+				attachments = attachmentsOf(env)
 			}
 		}
 
+		threadID := ""
+		if id, ok := msg.Items["X-GM-THRID"]; ok && id != nil {
+			threadID = fmt.Sprint(id)
+		}
+
 		emails = append(emails, Email{
-			ID:      fmt.Sprintf("%d", msg.SeqNum),
-			From:    from,
-			Subject: msg.Envelope.Subject,
-			Date:    msg.InternalDate,
-			Body:    "", // Body fetching can be added if needed
+			ID:        fmt.Sprintf("%d", msg.SeqNum),
+			UID:       msg.Uid,
+			MessageID: msg.Envelope.MessageId,
+			From:      senderOf(msg.Envelope),
+			Subject:   msg.Envelope.Subject,
+			Date:      msg.InternalDate,
+			Flags:     msg.Flags,
+			Body:      body,
+			Mailbox:   mailbox,
+			Size:      msg.Size,
+
+			Attachments: attachments,
+
+			ThreadID:   threadID,
+			InReplyTo:  msg.Envelope.InReplyTo,
+			References: references,
 		})
 	}
 
@@ -345,7 +557,7 @@ func (e *Executor) FilterEmails(emails []Email, intent *Intent) []Email {
 	var filtered []Email
 
 	for _, email := range emails {
-		if e.matchesIntent(email, intent) {
+		if matchesIntent(email, intent) {
 			filtered = append(filtered, email)
 		}
 	}
@@ -353,22 +565,38 @@ func (e *Executor) FilterEmails(emails []Email, intent *Intent) []Email {
 	return filtered
 }
 
+// matchesSender reports whether the address in from is the sender's. A
+// wildcard or a bare domain matches that exact domain, an address matches
+// itself, and a bare name matches the part before the @; all ignore case.
+// Server searches match senders as substrings, so this keeps bulk actions
+// off look-alike domains and addresses.
+func matchesSender(from, sender string, wildcard bool) bool {
+	addr := senderAddress(from)
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		addr = strings.ToLower(parsed.Address)
+	}
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return false
+	}
+	local, domain := addr[:at], addr[at+1:]
+
+	sender = strings.ToLower(sender)
+	switch {
+	case strings.Contains(sender, "@"):
+		return addr == sender
+	case wildcard || strings.Contains(sender, "."):
+		return domain == sender
+	default:
+		return local == sender
+	}
+}
+
 // matchesIntent checks if an email matches the intent criteria
-func (e *Executor) matchesIntent(email Email, intent *Intent) bool {
+func matchesIntent(email Email, intent *Intent) bool {
 	// Check sender filter
-	if intent.Sender != "" {
-		if intent.AllFromSender {
-			// Check if email is from the domain
-			if !strings.HasSuffix(strings.ToLower(email.From), "@"+strings.ToLower(intent.Sender)) &&
-				!strings.Contains(strings.ToLower(email.From), strings.ToLower(intent.Sender)) {
-				return false
-			}
-		} else {
-			// Exact sender match
-			if !strings.Contains(strings.ToLower(email.From), strings.ToLower(intent.Sender)) {
-				return false
-			}
-		}
+	if intent.Sender != "" && !matchesSender(email.From, intent.Sender, intent.AllFromSender) {
+		return false
 	}
 
 	// Check keywords (match in subject or body)
@@ -389,13 +617,11 @@ func (e *Executor) matchesIntent(email Email, intent *Intent) bool {
 	}
 
 	// Check date range
-	if intent.DateRange != nil {
-		if email.Date.Before(intent.DateRange.Start) || email.Date.After(intent.DateRange.End) {
-			return false
-		}
+	if intent.DateRange != nil && !intent.DateRange.Contains(email.Date) {
+		return false
 	}
 
-	return true
+	return matchesAttachments(email, intent)
 }
 
 // Validate validates an intent before execution
@@ -404,11 +630,98 @@ func (e *Executor) Validate(intent *Intent) error {
 		return fmt.Errorf("intent cannot be nil")
 	}
 
+	// Without IMAP only archive searches, backend searches, listeners,
+	// actions and undo, and macro and schedule definitions run
+	if e.imapClient == nil {
+		switch {
+		case intent.Command == CommandSearch && intent.Archive != "":
+		case e.backend != nil && intent.Command == CommandSearch && intent.About == "" && !intent.AllFolders:
+		case e.backend != nil && intent.Command == CommandListen && intent.Template == "":
+		case e.backend != nil && (intent.Command.IsAction() || intent.Command == CommandUndo):
+		case intent.Command == CommandSave || intent.Command == CommandDefine || intent.Command == CommandSchedule:
+		case intent.Command == CommandExpand:
+		case intent.Command == CommandNext && e.lastSearch != nil:
+		default:
+			return fmt.Errorf("%s is not available without an IMAP connection", intent.Command)
+		}
+	}
+
 	switch intent.Command {
 	case CommandSearch:
-		// Search requires either keywords or sender
-		if len(intent.Keywords) == 0 && intent.Sender == "" {
-			return fmt.Errorf("search requires at least keywords or sender")
+		if intent.About != "" {
+			if e.embedder == nil {
+				return fmt.Errorf("search about requires an embedder")
+			}
+			break
+		}
+		// Search requires keywords, a sender or an attachment or size filter
+		if len(intent.Keywords) == 0 && intent.Sender == "" && !intent.HasAttachmentFilter() && intent.LargerThan == 0 {
+			return fmt.Errorf("search requires at least keywords, sender, or an attachment or size filter")
+		}
+	case CommandFolders:
+	case CommandExpand:
+		if intent.Result < 1 || intent.Result > len(e.threads) {
+			return fmt.Errorf("no conversation %d, run a search first", intent.Result)
+		}
+	case CommandExport:
+		// Export requires keywords, a sender or an attachment or size filter
+		if len(intent.Keywords) == 0 && intent.Sender == "" && !intent.HasAttachmentFilter() && intent.LargerThan == 0 {
+			return fmt.Errorf("export requires at least keywords, sender, or an attachment or size filter")
+		}
+		if strings.TrimSpace(intent.Target) == "" {
+			return fmt.Errorf("export requires a destination")
+		}
+	case CommandAttachments, CommandSaveAttachments:
+		if intent.Result < 1 || intent.Result > len(e.lastResults) {
+			return fmt.Errorf("no search result %d, run a search first", intent.Result)
+		}
+		if intent.Command == CommandSaveAttachments && strings.TrimSpace(intent.Target) == "" {
+			return fmt.Errorf("save attachments requires a directory")
+		}
+	case CommandNext:
+		if e.lastSearch == nil {
+			return fmt.Errorf("no search to continue, run a search first")
+		}
+		pageSize := DefaultPageSize
+		if e.lastSearch.About != "" {
+			pageSize = semanticResults
+		}
+		offset, size := pageBounds(e.lastSearch, pageSize)
+		if offset+size >= e.lastTotal {
+			return fmt.Errorf("no more results")
+		}
+	case CommandSave, CommandDefine:
+		if e.macros == nil {
+			return fmt.Errorf("%s requires a macros file", intent.Command)
+		}
+	case CommandSchedule:
+		if e.schedule == nil {
+			return fmt.Errorf("schedule requires a schedule file")
+		}
+	case CommandSync:
+		if e.index == nil {
+			return fmt.Errorf("sync requires a local index")
+		}
+	case CommandUndo:
+		if e.journal == nil {
+			return fmt.Errorf("undo requires a journal")
+		}
+	case CommandReply:
+		if e.responder == nil {
+			return fmt.Errorf("reply requires a responder")
+		}
+		if intent.Template != "" {
+			// Template replies go to a whole search, so it must be narrowed
+			if len(intent.Keywords) == 0 && intent.Sender == "" {
+				return fmt.Errorf("reply with a template requires keywords or a sender")
+			}
+			break
+		}
+		if intent.Result < 1 || intent.Result > len(e.lastResults) {
+			return fmt.Errorf("no search result %d, run a search first", intent.Result)
+		}
+		if strings.TrimSpace(intent.Text) == "" {
+			return fmt.Errorf("reply text cannot be empty")
 		}
 	case CommandListen:
 		// Listen requires a sender
@@ -419,8 +732,20 @@ func (e *Executor) Validate(intent *Intent) error {
 		if len(intent.Keywords) > 0 {
 			return fmt.Errorf("listen command does not support keywords")
 		}
+		if intent.Template != "" && e.responder == nil {
+			return fmt.Errorf("respond with requires a responder")
+		}
 	default:
-		return fmt.Errorf("unknown command type: %s", intent.Command)
+		if !intent.Command.IsAction() {
+			return fmt.Errorf("unknown command type: %s", intent.Command)
+		}
+		// Actions require a sender so they never touch the whole mailbox
+		if intent.Sender == "" {
+			return fmt.Errorf("%s requires a sender", intent.Command)
+		}
+		if (intent.Command == CommandLabel || intent.Command == CommandMove) && intent.Target == "" {
+			return fmt.Errorf("%s requires a target", intent.Command)
+		}
 	}
 
 	return nil
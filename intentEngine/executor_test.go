@@ -0,0 +1,297 @@
+package intentengine
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestExecutor returns an executor over an in-memory store with the
+// folders actions use, and a journal in a temporary directory
+func newTestExecutor(t *testing.T) (*Executor, *MemoryBackend) {
+	t.Helper()
+	store := NewMemoryBackend("INBOX", allMailMailbox, trashMailbox, "Jobs")
+	e := NewExecutor(nil)
+	e.SetBackend(store)
+	e.SetJournal(NewJournal(filepath.Join(t.TempDir(), "journal.jsonl"), "me@example.com"))
+	return e, store
+}
+
+// run parses and executes a command, failing the test on any error
+func run(t *testing.T, e *Executor, command string) *Result {
+	t.Helper()
+	intent, err := NewParser().Parse(command)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", command, err)
+	}
+	if err := e.Validate(intent); err != nil {
+		t.Fatalf("Validate(%q): %v", command, err)
+	}
+	result, err := e.Execute(intent)
+	if err != nil {
+		t.Fatalf("Execute(%q): %v", command, err)
+	}
+	return result
+}
+
+func at(day int) time.Time {
+	return time.Date(2025, time.March, day, 9, 0, 0, 0, time.UTC)
+}
+
+func TestSearch(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{MessageID: "<1@acme.com>", From: "hr@acme.com", Subject: "Offer letter", Date: at(1)})
+	store.Add("INBOX", Email{MessageID: "<2@acme.com>", From: "hr@acme.com", Subject: "Interview", Date: at(2)})
+	store.Add("INBOX", Email{MessageID: "<3@other.com>", From: "news@other.com", Subject: "Offer inside", Date: at(3)})
+	store.Add("INBOX", Email{MessageID: "<4@acme.com>", From: "hr@acme.com", Subject: "Your offer", Date: at(4)})
+
+	result := run(t, e, `search for "offer" from "acme.com"`)
+
+	var subjects []string
+	for _, msg := range result.Messages {
+		subjects = append(subjects, msg.Subject)
+	}
+	if want := []string{"Your offer", "Offer letter"}; !slices.Equal(subjects, want) {
+		t.Errorf("found %q, want %q newest first", subjects, want)
+	}
+}
+
+func TestActionIsJournaledAndUndone(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{MessageID: "<1@a.com>", From: "alice@a.com", Subject: "one", Date: at(1)})
+	store.Add("INBOX", Email{MessageID: "<2@a.com>", From: "alice@a.com", Subject: "two", Date: at(2), Flags: []string{"\\Flagged"}})
+	store.Add("INBOX", Email{MessageID: "<3@b.com>", From: "bob@b.com", Subject: "three", Date: at(3)})
+
+	run(t, e, `star from "alice@a.com"`)
+
+	flagged := func() []bool {
+		var got []bool
+		for _, msg := range store.Messages("INBOX") {
+			got = append(got, hasFlag(msg.Flags, "\\Flagged"))
+		}
+		return got
+	}
+	if got := flagged(); !slices.Equal(got, []bool{true, true, false}) {
+		t.Fatalf("after star, flagged = %v", got)
+	}
+
+	entries, err := e.journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Operation != CommandStar || len(entries[0].Messages) != 2 {
+		t.Fatalf("journal = %+v, want one star of 2 messages", entries)
+	}
+
+	run(t, e, `undo`)
+
+	// The message that was starred before keeps its star
+	if got := flagged(); !slices.Equal(got, []bool{false, true, false}) {
+		t.Errorf("after undo, flagged = %v", got)
+	}
+	if _, err := e.journal.Undoable(""); err == nil {
+		t.Error("the undone entry is still undoable")
+	}
+}
+
+func TestUndoMove(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{MessageID: "<1@news.com>", From: "letters@news.com", Subject: "Weekly", Date: at(1)})
+	store.Add("INBOX", Email{MessageID: "<2@a.com>", From: "alice@a.com", Subject: "Lunch", Date: at(2)})
+
+	run(t, e, `archive from "news.com"`)
+	if n := len(store.Messages("INBOX")); n != 1 {
+		t.Fatalf("INBOX has %d messages after archive, want 1", n)
+	}
+
+	run(t, e, `undo`)
+	if n := len(store.Messages("INBOX")); n != 2 {
+		t.Errorf("INBOX has %d messages after undo, want 2", n)
+	}
+	if n := len(store.Messages(allMailMailbox)); n != 0 {
+		t.Errorf("All Mail has %d messages after undo, want 0", n)
+	}
+}
+
+func TestUndoLabelDeletesOnlyTheCopies(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{MessageID: "<1@r.com>", From: "jobs@r.com", Subject: "Role", Date: at(1)})
+	store.Add("INBOX", Email{MessageID: "<2@r.com>", From: "jobs@r.com", Subject: "Another role", Date: at(2)})
+	// Already in the folder: the same message, and one marked deleted
+	store.Add("Jobs", Email{MessageID: "<1@r.com>", From: "jobs@r.com", Subject: "Role", Date: at(1)})
+	store.Add("Jobs", Email{MessageID: "<9@x.com>", From: "x@x.com", Subject: "Old", Date: at(1), Flags: []string{"\\Deleted"}})
+
+	run(t, e, `label "Jobs" from "r.com"`)
+	if n := len(store.Messages("Jobs")); n != 4 {
+		t.Fatalf("Jobs has %d messages after label, want 4", n)
+	}
+
+	entry, err := e.journal.Undoable("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.TargetUIDValidity == 0 || entry.Messages[0].CopyUID == 0 || entry.Messages[1].CopyUID == 0 {
+		t.Fatalf("copies weren't journaled: %+v", entry)
+	}
+
+	run(t, e, `undo`)
+
+	var left []uint32
+	for _, msg := range store.Messages("Jobs") {
+		left = append(left, msg.UID)
+	}
+	if !slices.Equal(left, []uint32{1, 2}) {
+		t.Errorf("Jobs keeps UIDs %v, want the two that were there before [1 2]", left)
+	}
+	if n := len(store.Messages("INBOX")); n != 2 {
+		t.Errorf("INBOX has %d messages after undo, want 2", n)
+	}
+}
+
+func TestUndoLabelWithoutCopiesRefuses(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{MessageID: "<1@r.com>", From: "jobs@r.com", Subject: "Role", Date: at(1)})
+	store.Add("Jobs", Email{MessageID: "<1@r.com>", From: "jobs@r.com", Subject: "Role", Date: at(1)})
+
+	// An entry journaled before copies were recorded
+	if err := e.journal.Append(&JournalEntry{
+		Operation:   CommandLabel,
+		Mailbox:     "INBOX",
+		Target:      "Jobs",
+		UIDValidity: 1,
+		Messages:    []JournalMessage{{UID: 1, MessageID: "<1@r.com>"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	intent, _ := NewParser().Parse(`undo`)
+	if _, err := e.Execute(intent); err == nil {
+		t.Error("undo of an unrecorded label copy succeeded")
+	}
+	if n := len(store.Messages("Jobs")); n != 1 {
+		t.Errorf("Jobs has %d messages, want 1 left alone", n)
+	}
+}
+
+func TestUndoGmailLabel(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.SetLabels(true)
+	store.Add("INBOX", Email{MessageID: "<1@r.com>", From: "jobs@r.com", Date: at(1)})
+	store.Add("INBOX", Email{MessageID: "<2@r.com>", From: "jobs@r.com", Date: at(2), Labels: []string{"Jobs"}})
+
+	run(t, e, `label "Jobs" from "r.com"`)
+	run(t, e, `undo`)
+
+	messages := store.Messages("INBOX")
+	if hasLabel(messages[0].Labels, "Jobs") || !hasLabel(messages[1].Labels, "Jobs") {
+		t.Errorf("labels after undo = %v, %v; want only the second labelled", messages[0].Labels, messages[1].Labels)
+	}
+	if n := len(store.Messages("Jobs")); n != 0 {
+		t.Errorf("Jobs folder has %d copies, want none", n)
+	}
+}
+
+func TestMatchesSender(t *testing.T) {
+	tests := []struct {
+		from, sender string
+		wildcard     bool
+		want         bool
+	}{
+		{"hr@acme.com", "acme.com", true, true},
+		{`"HR Team" <HR@Acme.com>`, "acme.com", true, true},
+		{"x@notacme.com", "acme.com", true, false},
+		{"x@acme.com.evil.io", "acme.com", true, false},
+		{"x@notacme.com", "acme.com", false, false},
+		{"bob@x.com", "bob@x.com", false, true},
+		{"Bob <BOB@X.com>", "bob@x.com", false, true},
+		{"jimbob@x.com", "bob@x.com", false, false},
+		{"bob@x.com.evil.io", "bob@x.com", false, false},
+		{"noreply@company.com", "noreply", false, true},
+		{"noreply-jobs@company.com", "noreply", false, false},
+	}
+	for _, tt := range tests {
+		if got := matchesSender(tt.from, tt.sender, tt.wildcard); got != tt.want {
+			t.Errorf("matchesSender(%q, %q, %v) = %v, want %v", tt.from, tt.sender, tt.wildcard, got, tt.want)
+		}
+	}
+}
+
+func TestActionSkipsLookAlikeSenders(t *testing.T) {
+	e, store := newTestExecutor(t)
+	store.Add("INBOX", Email{From: "news@acme.com", Date: at(1)})
+	store.Add("INBOX", Email{From: "news@notacme.com", Date: at(2)})
+	store.Add("INBOX", Email{From: "news@acme.com.evil.io", Date: at(3)})
+
+	run(t, e, `trash from "*@acme.com"`)
+	trashed := store.Messages(trashMailbox)
+	if len(trashed) != 1 || trashed[0].From != "news@acme.com" {
+		t.Errorf("trashed %+v, want only acme.com", trashed)
+	}
+}
+
+func TestBulkActionNeedsConfirmation(t *testing.T) {
+	e, store := newTestExecutor(t)
+	for i := 1; i <= DefaultConfirmThreshold+1; i++ {
+		store.Add("INBOX", Email{From: "bulk@spam.com", Date: at(i)})
+	}
+
+	intent, _ := NewParser().Parse(`trash from "spam.com"`)
+	if _, err := e.Execute(intent); err == nil {
+		t.Fatal("bulk trash ran without confirmation")
+	}
+	if n := len(store.Messages(trashMailbox)); n != 0 {
+		t.Errorf("%d messages trashed without confirmation", n)
+	}
+
+	e.SetConfirm(func(string) bool { return true }, DefaultConfirmThreshold)
+	if _, err := e.Execute(intent); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.Messages(trashMailbox)); n != DefaultConfirmThreshold+1 {
+		t.Errorf("%d messages trashed, want %d", n, DefaultConfirmThreshold+1)
+	}
+}
+
+func TestListenWatchesInboxByDefault(t *testing.T) {
+	e, store := newTestExecutor(t)
+
+	matched := make(chan Email, 4)
+	e.SetListenHook(func(msg Email) { matched <- msg })
+
+	intent, err := NewParser().Parse(`listen from "acme.com"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Listen(ctx, intent) }()
+
+	// Wait for the listener to start before anything arrives
+	for !store.Watching() {
+		time.Sleep(time.Millisecond)
+	}
+	store.Add("Jobs", Email{From: "hr@acme.com", Subject: "Elsewhere", Date: at(1)})
+	store.Add("INBOX", Email{From: "news@other.com", Subject: "Weekly", Date: at(1)})
+	store.Add("INBOX", Email{From: "hr@acme.com", Subject: "Interview", Date: at(2)})
+
+	select {
+	case msg := <-matched:
+		if msg.Subject != "Interview" || msg.Mailbox != "INBOX" {
+			t.Errorf("listener matched %q in %s", msg.Subject, msg.Mailbox)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't report the new message")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Listen: %v", err)
+	}
+	select {
+	case msg := <-matched:
+		t.Errorf("listener also matched %q in %s", msg.Subject, msg.Mailbox)
+	default:
+	}
+}
@@ -0,0 +1,499 @@
+package intentengine
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/jhillyerd/enmime"
+)
+
+// Export formats, chosen by the destination's extension
+const (
+	exportMbox     = "mbox"
+	exportEML      = "eml"
+	exportMarkdown = "markdown"
+	exportHTML     = "html"
+)
+
+// exportBatch is how many messages are downloaded per round trip
+const exportBatch = 50
+
+// exportFormat picks the format for a destination: a directory of .eml
+// files when it ends in a slash or has no extension
+func exportFormat(dest string) (string, error) {
+	if strings.HasSuffix(dest, "/") || strings.HasSuffix(dest, string(filepath.Separator)) {
+		return exportEML, nil
+	}
+	switch strings.ToLower(filepath.Ext(dest)) {
+	case "":
+		return exportEML, nil
+	case ".mbox":
+		return exportMbox, nil
+	case ".md", ".markdown":
+		return exportMarkdown, nil
+	case ".html", ".htm":
+		return exportHTML, nil
+	}
+	return "", fmt.Errorf("export writes a .mbox, .md or .html file, or a directory/ of .eml files")
+}
+
+// exporter writes messages to an export as they are downloaded
+type exporter interface {
+	// add writes one message, given its full RFC 822 source
+	add(msg *imap.Message, raw io.Reader) error
+	// close finishes the export
+	close() error
+	// abort removes what a failed export wrote
+	abort()
+}
+
+// executeExport writes every message matching the intent to a file or
+// directory, oldest first. Raw messages are downloaded in batches and
+// written as they arrive, so exports of any size fit in memory.
+func (e *Executor) executeExport(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing EXPORT ===")
+	if len(intent.Keywords) > 0 {
+		fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	}
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	e.printDateRange(intent)
+
+	dest, err := expandHome(intent.Target)
+	if err != nil {
+		return nil, err
+	}
+	format, err := exportFormat(intent.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read-only, so exporting leaves messages unread
+	if _, err := e.imapClient.Select(intent.Folder(), true); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", intent.Folder(), err)
+	}
+
+	uids, err := e.exportMatches(intent)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(e.out, "✓ Found %d matching messages\n\n", len(uids))
+	if len(uids) == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+		return &Result{Command: CommandExport}, nil
+	}
+
+	var w exporter
+	switch format {
+	case exportMbox:
+		w, err = newMboxExporter(dest)
+	case exportEML:
+		w, err = newEMLExporter(dest)
+	default:
+		w, err = newReportExporter(dest, format, intent.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchInternalDate, section.FetchItem()}
+
+	count := 0
+	for start := 0; start < len(uids); start += exportBatch {
+		set := new(imap.SeqSet)
+		set.AddNum(uids[start:min(start+exportBatch, len(uids))]...)
+
+		// Each message holds its whole body, so only one waits at a time
+		messages := make(chan *imap.Message, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- e.imapClient.UidFetch(set, items, messages)
+		}()
+
+		var addErr error
+		for msg := range messages {
+			if addErr != nil {
+				continue
+			}
+			body := msg.GetBody(section)
+			if body == nil {
+				addErr = fmt.Errorf("server returned no body for UID %d", msg.Uid)
+				continue
+			}
+			if msg.Envelope == nil {
+				msg.Envelope = &imap.Envelope{}
+			}
+			if addErr = w.add(msg, body); addErr == nil {
+				count++
+			}
+		}
+		if err := <-done; err != nil && addErr == nil {
+			addErr = fmt.Errorf("fetch failed: %w", err)
+		}
+		if addErr != nil {
+			w.abort()
+			return nil, fmt.Errorf("export failed after %d messages: %w", count, addErr)
+		}
+		fmt.Fprintf(e.out, "Exported %d of %d...\n", count, len(uids))
+	}
+
+	if err := w.close(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	fmt.Fprintf(e.out, "✓ Exported %d messages to %s (%s)\n", count, dest, format)
+
+	return &Result{Command: CommandExport, Count: count, Format: format, Path: dest}, nil
+}
+
+// exportMatches returns the UIDs of the messages to export, oldest first.
+// As with actions, the server's keyword match is kept but everything else
+// is re-checked locally, from envelopes and structures alone.
+func (e *Executor) exportMatches(intent *Intent) ([]uint32, error) {
+	uids, err := e.imapClient.UidSearch(buildSearchCriteria(intent))
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	if len(uids) == 0 {
+		return uids, nil
+	}
+
+	local := *intent
+	local.Keywords = nil
+
+	candidates, err := fetchEnvelopes(e.imapClient, uids, intent.HasAttachmentFilter())
+	if err != nil {
+		return nil, err
+	}
+	var matched []uint32
+	for _, msg := range candidates {
+		if matchesIntent(msg, &local) {
+			matched = append(matched, msg.UID)
+		}
+	}
+
+	// UIDs ascend with arrival
+	sort.Slice(matched, func(i, j int) bool { return matched[i] < matched[j] })
+	return matched, nil
+}
+
+// createExclusive creates a temporary file next to path. It fails early
+// when path already exists, and commit fails if it appears meanwhile, so
+// an export never replaces earlier evidence.
+func createExclusive(path string) (*os.File, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// commit closes a temporary file and links it into place, which unlike a
+// rename fails when path exists
+func commit(f *os.File, w *bufio.Writer, path string) error {
+	err := w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Link(f.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	os.Remove(f.Name())
+	return nil
+}
+
+// mboxExporter writes messages to an mbox file in mboxrd form: each
+// starts with a "From " line, and body lines that look like one are
+// escaped with a ">". The archive package reads it back.
+type mboxExporter struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func newMboxExporter(path string) (*mboxExporter, error) {
+	f, err := createExclusive(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mboxExporter{path: path, f: f, w: bufio.NewWriterSize(f, 64*1024)}, nil
+}
+
+func (m *mboxExporter) add(msg *imap.Message, raw io.Reader) error {
+	sender := "MAILER-DAEMON"
+	if len(msg.Envelope.From) > 0 && msg.Envelope.From[0].Address() != "" {
+		sender = msg.Envelope.From[0].Address()
+	}
+	fmt.Fprintf(m.w, "From %s %s\n", sender, msg.InternalDate.UTC().Format(time.ANSIC))
+
+	r := bufio.NewReader(raw)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				m.w.WriteString(">")
+			}
+			m.w.WriteString(line)
+			m.w.WriteString("\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := m.w.WriteString("\n")
+	return err
+}
+
+func (m *mboxExporter) close() error {
+	return commit(m.f, m.w, m.path)
+}
+
+func (m *mboxExporter) abort() {
+	m.f.Close()
+	os.Remove(m.f.Name())
+}
+
+// emlExporter writes each message to its own .eml file in a directory,
+// named by date and subject
+type emlExporter struct {
+	dir string
+}
+
+func newEMLExporter(dir string) (*emlExporter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", dir, err)
+	}
+	return &emlExporter{dir: dir}, nil
+}
+
+func (m *emlExporter) add(msg *imap.Message, raw io.Reader) error {
+	subject := msg.Envelope.Subject
+	if subject == "" {
+		subject = "no subject"
+	}
+	name := msg.InternalDate.Format("2006-01-02 150405") + " " + subject
+	if len(name) > 120 {
+		name = strings.ToValidUTF8(name[:120], "")
+	}
+
+	f, err := createFile(m.dir, sanitizeFilename(name, "", 0)+".eml")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, raw)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to write %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// Files already written are complete messages, so they are kept
+func (m *emlExporter) close() error { return nil }
+func (m *emlExporter) abort()       {}
+
+// reportExporter renders messages into one Markdown or HTML file, with
+// their attachments saved to a directory next to it and linked
+type reportExporter struct {
+	path   string
+	format string
+	f      *os.File
+	w      *bufio.Writer
+	files  string // Attachment directory, created with the first attachment
+	n      int
+}
+
+// reportMessage is what a report shows of one message
+type reportMessage struct {
+	N           int
+	Subject     string
+	Headers     [][2]string
+	Body        string
+	Attachments []reportAttachment
+}
+
+// reportAttachment links a saved attachment, relative to the report
+type reportAttachment struct {
+	Name string
+	Link string
+	Type string
+	Size string
+}
+
+// reportHTML renders HTML reports. Bodies are shown as plain text, so no
+// script or remote content from a message runs when the report is opened.
+var reportHTML = template.Must(template.New("head").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; }
+article { border-top: 1px solid #ccc; padding: 1em 0; }
+th { text-align: left; padding-right: 1em; vertical-align: top; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Exported {{.Date}}</p>
+`))
+
+func init() {
+	template.Must(reportHTML.New("message").Parse(`<article id="m{{.N}}">
+<h2>{{.N}}. {{.Subject}}</h2>
+<table>
+{{range .Headers}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Attachments}}<p>Attachments:</p>
+<ul>
+{{range .Attachments}}<li><a href="{{.Link}}">{{.Name}}</a> ({{.Type}}, {{.Size}})</li>
+{{end}}</ul>
+{{end}}<pre>{{.Body}}</pre>
+</article>
+`))
+	template.Must(reportHTML.New("foot").Parse("</body>\n</html>\n"))
+}
+
+func newReportExporter(path, format, query string) (*reportExporter, error) {
+	f, err := createExclusive(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &reportExporter{
+		path:   path,
+		format: format,
+		f:      f,
+		w:      bufio.NewWriterSize(f, 64*1024),
+		files:  strings.TrimSuffix(path, filepath.Ext(path)) + "_files",
+	}
+
+	date := time.Now().Format("2006-01-02 15:04")
+	if format == exportHTML {
+		err = reportHTML.ExecuteTemplate(r.w, "head", map[string]string{"Title": query, "Date": date})
+	} else {
+		_, err = fmt.Fprintf(r.w, "# %s\n\nExported %s\n\n", query, date)
+	}
+	if err != nil {
+		r.abort()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *reportExporter) add(msg *imap.Message, raw io.Reader) error {
+	env, err := enmime.ReadEnvelope(raw)
+	if err != nil {
+		return fmt.Errorf("unable to parse message UID %d: %w", msg.Uid, err)
+	}
+	r.n++
+
+	m := reportMessage{N: r.n, Subject: msg.Envelope.Subject, Body: strings.TrimSpace(env.Text)}
+	for _, h := range []string{"From", "To", "Cc", "Date", "Message-ID"} {
+		if v := env.GetHeader(h); v != "" {
+			m.Headers = append(m.Headers, [2]string{h, v})
+		}
+	}
+
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines, env.OtherParts} {
+		for _, part := range parts {
+			if part.FileName == "" {
+				continue
+			}
+			if err := os.MkdirAll(r.files, 0755); err != nil {
+				return fmt.Errorf("unable to create %s: %w", r.files, err)
+			}
+			contentType := sniffType(part.ContentType, part.Content)
+			name := fmt.Sprintf("%d-%s", r.n, sanitizeFilename(part.FileName, contentType, 0))
+			file, err := saveFile(r.files, name, part.Content)
+			if err != nil {
+				return err
+			}
+
+			link := &url.URL{Path: filepath.Base(r.files) + "/" + filepath.Base(file)}
+			m.Attachments = append(m.Attachments, reportAttachment{
+				Name: baseName(part.FileName),
+				Link: link.String(),
+				Type: contentType,
+				Size: formatSize(int64(len(part.Content))),
+			})
+		}
+	}
+
+	if r.format == exportHTML {
+		return reportHTML.ExecuteTemplate(r.w, "message", m)
+	}
+	return writeMarkdown(r.w, m)
+}
+
+// markdownEscaper escapes the characters Markdown would read as markup,
+// such as the angle brackets around addresses
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// writeMarkdown writes one message as a Markdown section. The body goes in
+// a fence longer than any run of backticks inside it.
+func writeMarkdown(w io.Writer, m reportMessage) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %d. %s\n\n", m.N, markdownEscaper.Replace(m.Subject))
+	for _, h := range m.Headers {
+		fmt.Fprintf(&b, "- **%s:** %s\n", h[0], markdownEscaper.Replace(h[1]))
+	}
+	if len(m.Attachments) > 0 {
+		b.WriteString("- **Attachments:**\n")
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "  - [%s](<%s>) (%s, %s)\n", markdownEscaper.Replace(a.Name), a.Link, a.Type, a.Size)
+		}
+	}
+
+	fence := "```"
+	for strings.Contains(m.Body, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(&b, "\n%stext\n%s\n%s\n\n---\n\n", fence, m.Body, fence)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (r *reportExporter) close() error {
+	if r.format == exportHTML {
+		if err := reportHTML.ExecuteTemplate(r.w, "foot", nil); err != nil {
+			return err
+		}
+	}
+	return commit(r.f, r.w, r.path)
+}
+
+// abort removes the partial report. Saved attachments are kept, as they
+// are complete files.
+func (r *reportExporter) abort() {
+	r.f.Close()
+	os.Remove(r.f.Name())
+}
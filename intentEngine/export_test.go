@@ -0,0 +1,47 @@
+package intentengine
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitNeverReplaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "case.mbox")
+
+	f, err := createExclusive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("export\n")
+	if err := commit(f, w, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createExclusive(path); err == nil {
+		t.Error("createExclusive accepted an existing export")
+	}
+
+	// An export that appears while another is written is kept
+	f, err = createExclusive(filepath.Join(dir, "late.mbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "late.mbox"), []byte("earlier\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := commit(f, bufio.NewWriter(f), filepath.Join(dir, "late.mbox")); err == nil {
+		t.Error("commit replaced a file that appeared meanwhile")
+	}
+	os.Remove(f.Name())
+	if b, _ := os.ReadFile(filepath.Join(dir, "late.mbox")); string(b) != "earlier\n" {
+		t.Errorf("late.mbox = %q, want the earlier file", b)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("%d files left, want the two exports only", len(entries))
+	}
+}
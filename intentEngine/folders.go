@@ -0,0 +1,220 @@
+package intentengine
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// DefaultFolderWorkers is how many connections a search over all folders
+// uses when extra connections can be dialed
+const DefaultFolderWorkers = 4
+
+// skippedFolders are never searched by IN ALL: they hold nothing
+// searchable, or mail the user has thrown away
+var skippedFolders = []string{imap.NoSelectAttr, imap.TrashAttr, imap.JunkAttr}
+
+// SetDialer lets searches over several folders open up to workers-1 extra
+// connections, so folders are searched concurrently
+func (e *Executor) SetDialer(dial func() (*client.Client, error), workers int) {
+	e.dial = dial
+	e.folderWorkers = workers
+}
+
+// executeFolders lists every mailbox with its message and unread counts
+func (e *Executor) executeFolders(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing FOLDERS ===")
+
+	mailboxes, err := e.listFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []FolderStatus
+	for _, info := range mailboxes {
+		if hasAttr(info, imap.NoSelectAttr) {
+			continue
+		}
+
+		status, err := e.imapClient.Status(info.Name, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen})
+		if err != nil {
+			log.Printf("Status error for %s: %v", info.Name, err)
+			continue
+		}
+
+		fmt.Fprintf(e.out, "  %-30s %6d messages  %5d unread\n", info.Name, status.Messages, status.Unseen)
+		folders = append(folders, FolderStatus{Name: info.Name, Messages: status.Messages, Unread: status.Unseen})
+	}
+
+	return &Result{Command: CommandFolders, Count: len(folders), Folders: folders}, nil
+}
+
+// listFolders returns every mailbox on the server, sorted by name
+func (e *Executor) listFolders() ([]*imap.MailboxInfo, error) {
+	ch := make(chan *imap.MailboxInfo, 20)
+	done := make(chan error, 1)
+	go func() {
+		done <- e.imapClient.List("", "*", ch)
+	}()
+
+	var mailboxes []*imap.MailboxInfo
+	for info := range ch {
+		mailboxes = append(mailboxes, info)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("list failed: %w", err)
+	}
+
+	sort.Slice(mailboxes, func(i, j int) bool {
+		return mailboxes[i].Name < mailboxes[j].Name
+	})
+	return mailboxes, nil
+}
+
+// executeFolderSearch runs the search in every folder and merges the
+// results. Gmail shows a message in each of its labels, so copies are
+// dropped by Message-ID.
+func (e *Executor) executeFolderSearch(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing SEARCH (all folders) ===")
+	fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	e.printDateRange(intent)
+
+	mailboxes, err := e.listFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []string
+	for _, info := range mailboxes {
+		skip := false
+		for _, attr := range skippedFolders {
+			skip = skip || hasAttr(info, attr)
+		}
+		if !skip {
+			folders = append(folders, info.Name)
+		}
+	}
+
+	clients := e.folderClients(len(folders))
+	shared := clients[0] == e.imapClient
+	previous := e.imapClient.Mailbox()
+	fmt.Fprintf(e.out, "\nSearching %d folders with %d connections...\n", len(folders), len(clients))
+
+	// Each worker owns one connection and takes folders from the queue
+	criteria := buildSearchCriteria(intent)
+	found := make([][]Email, len(folders))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *client.Client) {
+			defer wg.Done()
+			for i := range queue {
+				messages, err := searchFolder(c, folders[i], criteria)
+				if err != nil {
+					log.Printf("Search error in %s: %v", folders[i], err)
+					continue
+				}
+				for _, msg := range inRange(messages, intent.DateRange) {
+					if matchesAttachments(msg, intent) {
+						found[i] = append(found[i], msg)
+					}
+				}
+			}
+		}(c)
+	}
+	for i := range folders {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	if shared {
+		// Put the executor's connection back on the mailbox it had, rather
+		// than leave it examining the last folder searched
+		if previous != nil {
+			if _, err := e.imapClient.Select(previous.Name, previous.ReadOnly); err != nil {
+				return nil, fmt.Errorf("failed to select %s: %w", previous.Name, err)
+			}
+		}
+	} else {
+		for _, c := range clients {
+			c.Logout()
+		}
+	}
+
+	// Keep the first copy, in folder order
+	seen := make(map[string]bool)
+	var messages []Email
+	for _, list := range found {
+		for _, msg := range list {
+			if id := normalizeMessageID(msg.MessageID); id != "" {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			messages = append(messages, msg)
+		}
+	}
+	total := len(messages)
+	messages = e.paginate(intent, messages)
+
+	fmt.Fprintf(e.out, "✓ Found %d matching messages\n\n", total)
+	if total == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+	} else {
+		fmt.Fprint(e.out, "=== Search Results ===\n\n")
+	}
+	threads := e.printThreads(messages)
+	e.printPage(intent, len(messages), DefaultPageSize)
+
+	return &Result{Command: CommandSearch, Count: total, Messages: messages, Threads: threads}, nil
+}
+
+// folderClients returns the connections a folder search uses: extra ones
+// when a dialer is set, so the executor's own keeps its mailbox selected,
+// or else the executor's own
+func (e *Executor) folderClients(folders int) []*client.Client {
+	var clients []*client.Client
+	for e.dial != nil && len(clients) < e.folderWorkers && len(clients) < folders {
+		c, err := e.dial()
+		if err != nil {
+			log.Printf("Extra connection failed, continuing with %d: %v", len(clients), err)
+			break
+		}
+		clients = append(clients, c)
+	}
+	if len(clients) == 0 {
+		return []*client.Client{e.imapClient}
+	}
+	return clients
+}
+
+// searchFolder searches one folder on c without changing any flags
+func searchFolder(c *client.Client, folder string, criteria *imap.SearchCriteria) ([]Email, error) {
+	if _, err := c.Select(folder, true); err != nil {
+		return nil, err
+	}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+	return fetchFrom(c, uids, true), nil
+}
+
+// hasAttr reports whether a mailbox has the given attribute
+func hasAttr(info *imap.MailboxInfo, attr string) bool {
+	for _, a := range info.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
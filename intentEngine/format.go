@@ -0,0 +1,281 @@
+package intentengine
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlantingTrees/intent/schedule"
+)
+
+// IntentVersion is the version of the JSON form of an Intent
+const IntentVersion = 1
+
+// IntentSchema is the JSON Schema of the JSON form of an Intent
+//
+//go:embed intent.schema.json
+var IntentSchema []byte
+
+// String returns the intent as query text in canonical form, so that
+// Parse(i.String()) gives back an equal intent. Relative dates are kept as
+// written and resolved again when the text is parsed.
+func (i *Intent) String() string {
+	var b strings.Builder
+
+	switch i.Command {
+	case CommandSave:
+		return "save " + quote(i.Target) + " as " + i.Text
+	case CommandDefine:
+		b.WriteString("define " + i.Target)
+		for _, param := range i.Params {
+			b.WriteString(" $" + param)
+		}
+		return b.String() + " = " + i.Text
+	case CommandSchedule:
+		return schedule.Job{Spec: i.Target, Query: i.Text, Notify: i.Notify}.String()
+	case CommandLabel:
+		b.WriteString("label " + quote(i.Target))
+	case CommandMove:
+		b.WriteString("move to " + quote(i.Target))
+	case CommandUndo:
+		b.WriteString("undo")
+		if i.Target != "" {
+			b.WriteString(" " + i.Target)
+		}
+	case CommandExpand:
+		return "expand " + strconv.Itoa(i.Result)
+	case CommandAttachments:
+		return "attachments " + strconv.Itoa(i.Result)
+	case CommandSaveAttachments:
+		return "save attachments " + strconv.Itoa(i.Result) + " to " + quote(i.Target)
+	case CommandReply:
+		if i.Template != "" {
+			b.WriteString("reply with " + quote(i.Template) + " to search")
+		} else {
+			b.WriteString("reply to " + strconv.Itoa(i.Result) + " " + quote(i.Text))
+		}
+	default:
+		b.WriteString(string(i.Command))
+	}
+
+	if i.About != "" {
+		b.WriteString(" about " + quote(i.About))
+	}
+	if len(i.Keywords) > 0 {
+		b.WriteString(" for " + quote(strings.Join(i.Keywords, ", ")))
+	}
+	if i.Sender != "" {
+		sender := i.Sender
+		if i.AllFromSender {
+			sender = "*@" + sender
+		}
+		b.WriteString(" from " + quote(sender))
+	}
+	if i.DateRange != nil {
+		if expr := i.DateRange.String(); expr != "" {
+			b.WriteString(" [" + expr + "]")
+		}
+	}
+	if i.Archive != "" {
+		b.WriteString(" in archive " + quote(i.Archive))
+	}
+	if i.Mailbox != "" {
+		b.WriteString(" in " + quote(i.Mailbox))
+	}
+	if i.AllFolders {
+		b.WriteString(" in all")
+	}
+	if i.HasAttachment {
+		b.WriteString(" has:attachment")
+	}
+	if i.Filename != "" {
+		b.WriteString(" filename:" + quote(i.Filename))
+	}
+	if i.LargerThan > 0 {
+		b.WriteString(" larger than " + formatSize(i.LargerThan))
+	}
+	if i.Sort != "" {
+		b.WriteString(" sort by " + string(i.Sort))
+	}
+	if i.Limit > 0 {
+		b.WriteString(" limit " + strconv.Itoa(i.Limit))
+	}
+	if i.Page > 0 {
+		b.WriteString(" page " + strconv.Itoa(i.Page))
+	}
+	if i.Command == CommandExport {
+		b.WriteString(" to " + quote(i.Target))
+	}
+	if i.Command == CommandListen && i.Template != "" {
+		b.WriteString(" respond with " + quote(i.Template))
+	}
+	if i.DryRun {
+		b.WriteString(" --dry-run")
+	}
+	if i.Draft {
+		b.WriteString(" --draft")
+	}
+
+	return b.String()
+}
+
+// formatSize writes a byte count in the largest unit that divides it
+// evenly, e.g. 5MB
+func formatSize(n int64) string {
+	for _, unit := range []string{"G", "M", "K"} {
+		if size := sizeUnits[strings.ToLower(unit)]; n%size == 0 {
+			return strconv.FormatInt(n/size, 10) + unit + "B"
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// quote wraps a value in the grammar's double quotes. Values can't contain
+// quotes themselves.
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+// String returns the expression the range was parsed from, or an
+// equivalent one in whole days for ranges built in code
+func (r *DateRange) String() string {
+	if r.Expr != "" {
+		return r.Expr
+	}
+
+	var expr string
+	loc := r.Start.Location()
+	switch {
+	case r.Start.IsZero() && r.End.IsZero():
+		return ""
+	case r.End.IsZero():
+		expr = "since " + r.Start.Format("2006-01-02")
+	case r.Start.IsZero():
+		loc = r.End.Location()
+		expr = "before " + r.End.Format("2006-01-02")
+	case nextDay(r.Start).Equal(r.End):
+		expr = r.Start.Format("2006-01-02")
+	default:
+		expr = r.Start.Format("2006-01-02") + " to " + r.End.Add(-time.Nanosecond).Format("2006-01-02")
+	}
+
+	// Dates are parsed in local time unless a zone is given
+	if name := loc.String(); loc != time.Local && name != "" && name != "Local" {
+		expr += " tz:" + name
+	}
+	return expr
+}
+
+// dateRangeJSON leaves out unbounded ends instead of writing zero times.
+// RFC 3339 keeps only the offset, so the zone is written by name.
+type dateRangeJSON struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+	Expr  string     `json:"expr,omitempty"`
+	TZ    string     `json:"tz,omitempty"`
+}
+
+// MarshalJSON writes the range's bounds as RFC 3339 times
+func (r DateRange) MarshalJSON() ([]byte, error) {
+	v := dateRangeJSON{Expr: r.Expr}
+	if !r.Start.IsZero() {
+		v.Start = &r.Start
+		v.TZ = r.Start.Location().String()
+	}
+	if !r.End.IsZero() {
+		v.End = &r.End
+		v.TZ = r.End.Location().String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON reads a range written by MarshalJSON
+func (r *DateRange) UnmarshalJSON(data []byte) error {
+	var v dateRangeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	loc := time.Local
+	if v.TZ != "" {
+		var err error
+		if loc, err = loadLocation(v.TZ); err != nil {
+			return err
+		}
+	}
+
+	*r = DateRange{Expr: v.Expr}
+	if v.Start != nil {
+		r.Start = v.Start.In(loc)
+	}
+	if v.End != nil {
+		r.End = v.End.In(loc)
+	}
+	return nil
+}
+
+// intentJSON has the fields of Intent without its methods, so they can be
+// embedded next to the version
+type intentJSON Intent
+
+// MarshalJSON writes the intent with its schema version
+func (i *Intent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		*intentJSON
+	}{IntentVersion, (*intentJSON)(i)})
+}
+
+// UnmarshalJSON reads an intent, rejecting versions newer than this one
+func (i *Intent) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Version int `json:"version"`
+		*intentJSON
+	}{intentJSON: (*intentJSON)(i)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if v.Version < 1 || v.Version > IntentVersion {
+		return fmt.Errorf("unsupported intent version %d", v.Version)
+	}
+	if i.Keywords == nil {
+		i.Keywords = make([]string, 0)
+	}
+	return nil
+}
+
+// Digest formats a command's result as Markdown, for scheduled runs.
+// Searches list what they found; actions only list it on a dry run.
+func Digest(result *Result) string {
+	if result == nil {
+		return "Done."
+	}
+
+	threads := result.Threads
+	if len(threads) == 0 && (result.DryRun || !result.Command.IsAction()) {
+		for _, msg := range result.Messages {
+			threads = append(threads, Thread{Messages: []Email{msg}})
+		}
+	}
+	if len(threads) == 0 {
+		return fmt.Sprintf("%d messages.", result.Count)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d messages:\n\n", result.Count)
+	for _, t := range threads {
+		latest := t.Latest()
+		// Conversations show how many messages they hold
+		count := ""
+		if len(t.Messages) > 1 {
+			count = fmt.Sprintf(" (%d)", len(t.Messages))
+		}
+		fmt.Fprintf(&b, "- %s · %s%s · %s\n", latest.Date.Format("2006-01-02 15:04:05"),
+			strings.Join(t.Participants(), ", "), count, t.Messages[0].Subject)
+	}
+	return b.String()
+}
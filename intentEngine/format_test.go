@@ -0,0 +1,75 @@
+package intentengine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixedParser resolves relative dates against a fixed time, so that an
+// intent parsed twice is equal
+func fixedParser(t testing.TB) *Parser {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tz data: %v", err)
+	}
+	p := NewParser()
+	p.SetClock(func() time.Time { return time.Date(2025, 3, 12, 15, 30, 0, 0, loc) })
+	return p
+}
+
+// roundTripQueries are seeds and cases that once didn't round-trip
+var roundTripQueries = []string{
+	`search from "*" [today]`,
+	`search from "*@acme.com" [last 7 days tz:Asia/Tokyo]`,
+	`search for "offer, interview" from "hr@acme.com" [2025-01-01 to 2025-01-31] in "Jobs" limit 10 page 2`,
+	`archive from "news.com" [older than 30 days] --dry-run`,
+	`move to "Receipts" from "billing@shop.com" [before 2025-03-01 tz:UTC]`,
+	`save attachments 1 to "`,
+}
+
+func FuzzParseString(f *testing.F) {
+	for _, query := range append(ParseExamples(), roundTripQueries...) {
+		f.Add(query)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		p := fixedParser(t)
+		intent, err := p.Parse(query)
+		if err != nil {
+			return
+		}
+		text := intent.String()
+		again, err := p.Parse(text)
+		if err != nil {
+			t.Fatalf("%q printed as %q, which doesn't parse: %v", query, text, err)
+		}
+		if !reflect.DeepEqual(intent, again) {
+			t.Errorf("%q printed as %q, which parses to %+v, want %+v", query, text, again, intent)
+		}
+	})
+}
+
+func TestIntentJSONRoundTrip(t *testing.T) {
+	p := fixedParser(t)
+	for _, query := range append(ParseExamples(), roundTripQueries...) {
+		intent, err := p.Parse(query)
+		if err != nil {
+			// Examples that run macros need one to be defined
+			continue
+		}
+		data, err := json.Marshal(intent)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+
+		var decoded Intent
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%q: unable to decode %s: %v", query, data, err)
+		}
+		if !reflect.DeepEqual(intent, &decoded) {
+			t.Errorf("%q decoded from %s as %+v, want %+v", query, data, &decoded, intent)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package intentengine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlantingTrees/intent/mailsync"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+)
+
+// imapBackend runs the executor's commands over an IMAP connection
+type imapBackend struct {
+	c *client.Client
+}
+
+// Open selects the folder
+func (b *imapBackend) Open(folder string, readOnly bool) (*Folder, error) {
+	mbox, err := b.c.Select(folder, readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+	return &Folder{Name: mbox.Name, Messages: mbox.Messages, UIDValidity: mbox.UidValidity}, nil
+}
+
+// Search finds the matches in the intent's order, then fetches only the
+// page shown
+func (b *imapBackend) Search(intent *Intent) ([]Email, int, error) {
+	seqNums, err := b.sortedSearch(intent, buildSearchCriteria(intent))
+	if err != nil {
+		return nil, 0, fmt.Errorf("search failed: %w", err)
+	}
+	// SEARCH dates are whole days, so the exact range is checked against
+	// each match's arrival time before counting and paging
+	if intent.DateRange != nil {
+		if seqNums, err = b.filterByDate(seqNums, intent.DateRange); err != nil {
+			return nil, 0, err
+		}
+	}
+	// IMAP can't search attachments, so they're read from each match's
+	// structure
+	if intent.HasAttachmentFilter() {
+		if seqNums, err = b.filterByStructure(seqNums, intent); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Fetch only the page shown
+	page := pageOf(seqNums, intent, DefaultPageSize)
+	return inOrder(fetchFrom(b.c, page, false), page), len(seqNums), nil
+}
+
+// filterByDate keeps the messages whose INTERNALDATE falls in r, in order
+func (b *imapBackend) filterByDate(seqNums []uint32, r *DateRange) ([]uint32, error) {
+	if len(seqNums) == 0 {
+		return seqNums, nil
+	}
+	set := new(imap.SeqSet)
+	set.AddNum(seqNums...)
+
+	messages := make(chan *imap.Message, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.c.Fetch(set, []imap.FetchItem{imap.FetchInternalDate}, messages)
+	}()
+
+	keep := make(map[uint32]bool)
+	for msg := range messages {
+		keep[msg.SeqNum] = r.Contains(msg.InternalDate)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+
+	var filtered []uint32
+	for _, n := range seqNums {
+		if keep[n] {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered, nil
+}
+
+// Matches searches on the server, then re-checks sender and date locally,
+// so a loose server-side match never widens a bulk action. Keywords were
+// already matched against the full text by the server.
+func (b *imapBackend) Matches(intent *Intent) ([]Email, error) {
+	uids, err := b.c.UidSearch(buildSearchCriteria(intent))
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	local := *intent
+	local.Keywords = nil
+
+	// Envelopes are enough to re-check, so no body is downloaded
+	candidates, err := fetchEnvelopes(b.c, uids, intent.HasAttachmentFilter())
+	if err != nil {
+		return nil, err
+	}
+	var messages []Email
+	for _, msg := range candidates {
+		if matchesIntent(msg, &local) {
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	matched := make([]uint32, len(messages))
+	for i, msg := range messages {
+		matched[i] = msg.UID
+	}
+	labels, err := b.fetchLabels(uidSet(matched))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch labels: %w", err)
+	}
+	for i := range messages {
+		messages[i].Labels = labels[messages[i].UID]
+	}
+	return messages, nil
+}
+
+// fetchEnvelopes fetches the envelope, flags, arrival time and size of
+// the given UIDs in the selected mailbox, and their structure too when
+// structure is set, to re-check matches without downloading bodies
+func fetchEnvelopes(c *client.Client, uids []uint32, structure bool) ([]Email, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchInternalDate, imap.FetchRFC822Size}
+	if structure {
+		items = append(items, imap.FetchBodyStructure)
+	}
+
+	mailbox := ""
+	if mbox := c.Mailbox(); mbox != nil {
+		mailbox = mbox.Name
+	}
+
+	messages := make(chan *imap.Message, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(set, items, messages)
+	}()
+
+	var emails []Email
+	for msg := range messages {
+		if msg.Envelope == nil {
+			continue
+		}
+		emails = append(emails, Email{
+			UID:         msg.Uid,
+			MessageID:   msg.Envelope.MessageId,
+			From:        senderOf(msg.Envelope),
+			Subject:     msg.Envelope.Subject,
+			Date:        msg.InternalDate,
+			Flags:       msg.Flags,
+			Mailbox:     mailbox,
+			Size:        msg.Size,
+			InReplyTo:   msg.Envelope.InReplyTo,
+			Attachments: structureAttachments(msg.BodyStructure),
+		})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	return emails, nil
+}
+
+// fetchLabels returns the Gmail labels of the given UIDs, keyed by UID.
+// It returns nothing on servers without X-GM-EXT-1.
+func (b *imapBackend) fetchLabels(set *imap.SeqSet) (map[uint32][]string, error) {
+	labels := make(map[uint32][]string)
+
+	gmail, err := b.c.Support("X-GM-EXT-1")
+	if err != nil || !gmail {
+		return labels, err
+	}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.c.UidFetch(set, []imap.FetchItem{imap.FetchUid, "X-GM-LABELS"}, messages)
+	}()
+
+	for msg := range messages {
+		if list, err := imap.ParseStringList(msg.Items["X-GM-LABELS"]); err == nil {
+			labels[msg.Uid] = list
+		}
+	}
+
+	return labels, <-done
+}
+
+// Fetch fetches one message by UID
+func (b *imapBackend) Fetch(uid uint32) (*Email, error) {
+	messages := fetchFrom(b.c, []uint32{uid}, true)
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no message with UID %d: %w", uid, ErrNotFound)
+	}
+	return &messages[0], nil
+}
+
+// FindMessageID searches the Message-Id header
+func (b *imapBackend) FindMessageID(id string) ([]uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Set("Message-Id", id)
+	uids, err := b.c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", id, err)
+	}
+	return uids, nil
+}
+
+// Store runs UID STORE
+func (b *imapBackend) Store(uids []uint32, flag string, add bool) error {
+	var op imap.FlagsOp = imap.RemoveFlags
+	if add {
+		op = imap.AddFlags
+	}
+	return b.c.UidStore(uidSet(uids), imap.FormatFlagsOp(op, true), []interface{}{flag}, nil)
+}
+
+// Label changes X-GM-LABELS, on Gmail only
+func (b *imapBackend) Label(uids []uint32, label string, add bool) error {
+	gmail, err := b.c.Support("X-GM-EXT-1")
+	if err != nil {
+		return err
+	}
+	if !gmail {
+		return errNoLabels
+	}
+	item := imap.StoreItem("-X-GM-LABELS.SILENT")
+	if add {
+		item = imap.StoreItem("+X-GM-LABELS.SILENT")
+	}
+	return b.c.UidStore(uidSet(uids), item, label, nil)
+}
+
+// Copy runs UID COPY and reads the copies' UIDs from its COPYUID code
+func (b *imapBackend) Copy(uids []uint32, dest string) (*Copied, error) {
+	status, err := b.c.Execute(&commands.Uid{Cmd: &commands.Copy{SeqSet: uidSet(uids), Mailbox: dest}}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return copyUID(status), nil
+}
+
+// copyUID reads the COPYUID code of a COPY response (RFC 4315): the
+// destination's UIDVALIDITY, then the original and the copies' UIDs in
+// matching order. It returns nil when there is none.
+func copyUID(status *imap.StatusResp) *Copied {
+	if status == nil || !strings.EqualFold(string(status.Code), "COPYUID") || len(status.Arguments) != 3 {
+		return nil
+	}
+	validity, err := imap.ParseNumber(status.Arguments[0])
+	if err != nil {
+		return nil
+	}
+	src, err := uidList(status.Arguments[1])
+	if err != nil {
+		return nil
+	}
+	dst, err := uidList(status.Arguments[2])
+	if err != nil || len(src) != len(dst) {
+		return nil
+	}
+
+	copied := &Copied{UIDValidity: validity, UIDs: make(map[uint32]uint32, len(src))}
+	for i, uid := range src {
+		copied.UIDs[uid] = dst[i]
+	}
+	return copied
+}
+
+// uidList expands a UID set such as "4,7:9" in the order it is written,
+// which go-imap's SeqSet doesn't keep
+func uidList(field interface{}) ([]uint32, error) {
+	s, err := imap.ParseString(field)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, ":")
+		start, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		stop := start
+		if isRange {
+			if stop, err = strconv.ParseUint(last, 10, 32); err != nil {
+				return nil, err
+			}
+		}
+		// Ranges may run downwards
+		for uid := start; ; {
+			uids = append(uids, uint32(uid))
+			if uid == stop {
+				break
+			}
+			if stop > start {
+				uid++
+			} else {
+				uid--
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Move runs UID MOVE. Without MOVE it copies, then expunges just the
+// originals, which needs UIDPLUS: a plain EXPUNGE would also remove every
+// other message marked \Deleted.
+func (b *imapBackend) Move(uids []uint32, dest string) error {
+	ok, err := b.c.Support("MOVE")
+	if err != nil {
+		return err
+	}
+	if ok {
+		return b.c.UidMove(uidSet(uids), dest)
+	}
+
+	if err := b.checkUIDPlus(); err != nil {
+		return err
+	}
+	if _, err := b.Copy(uids, dest); err != nil {
+		return err
+	}
+	return b.Delete(uids)
+}
+
+// Delete marks the messages \Deleted and removes them with UID EXPUNGE,
+// which leaves other deleted messages alone. Servers without UIDPLUS are
+// refused before anything is marked.
+func (b *imapBackend) Delete(uids []uint32) error {
+	if err := b.checkUIDPlus(); err != nil {
+		return err
+	}
+
+	set := uidSet(uids)
+	if err := b.c.UidStore(set, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return err
+	}
+	status, err := b.c.Execute(&commands.Uid{Cmd: &mailsync.RawCommand{Name: "EXPUNGE", Args: []interface{}{set}}}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	return err
+}
+
+// checkUIDPlus fails on servers that can only expunge every deleted
+// message at once
+func (b *imapBackend) checkUIDPlus() error {
+	ok, err := b.c.Support("UIDPLUS")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the server has no UIDPLUS, so single messages can't be removed without expunging every message marked deleted")
+	}
+	return nil
+}
+
+// Watch polls the folder for new UIDs
+func (b *imapBackend) Watch(ctx context.Context, folder string, found func([]Email)) error {
+	mbox, err := b.c.Select(folder, false)
+	if err != nil {
+		return err
+	}
+
+	lastUID := mbox.UidNext - 1
+
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		mbox, err := b.c.Select(folder, false)
+		if err != nil {
+			log.Println("Select error:", err)
+			continue
+		}
+
+		if mbox.UidNext <= lastUID+1 {
+			continue // nothing new
+		}
+
+		// Fetch ONLY new messages
+		set := new(imap.SeqSet)
+		set.AddRange(lastUID+1, mbox.UidNext-1)
+
+		messages := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- b.c.UidFetch(set, []imap.FetchItem{
+				imap.FetchUid,
+				imap.FetchEnvelope,
+				imap.FetchInternalDate,
+			}, messages)
+		}()
+
+		var arrived []Email
+		for msg := range messages {
+			lastUID = max(lastUID, msg.Uid)
+			if msg.Envelope == nil || len(msg.Envelope.From) == 0 {
+				continue
+			}
+			arrived = append(arrived, Email{
+				UID:       msg.Uid,
+				MessageID: msg.Envelope.MessageId,
+				From:      senderOf(msg.Envelope),
+				Subject:   msg.Envelope.Subject,
+				Date:      msg.InternalDate,
+				Mailbox:   mbox.Name,
+			})
+		}
+		if err := <-done; err != nil {
+			log.Println("Fetch error:", err)
+		}
+
+		// Hand them over once the fetch is drained, the connection is free again
+		if len(arrived) > 0 {
+			found(arrived)
+		}
+	}
+}
+
+// uidSet builds a set from a list of UIDs
+func uidSet(uids []uint32) *imap.SeqSet {
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	return set
+}
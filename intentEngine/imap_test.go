@@ -0,0 +1,219 @@
+package intentengine
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlantingTrees/intent/index"
+	"github.com/PlantingTrees/intent/responder"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+// newIMAPBackend signs in to an in-memory IMAP server, whose INBOX starts
+// with one message dated now
+func newIMAPBackend(t *testing.T) *imapBackend {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	c, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Logout() })
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	return &imapBackend{c: c}
+}
+
+// appendAt delivers a message from hr@acme.com that arrived at date
+func appendAt(t *testing.T, b *imapBackend, subject string, date time.Time) {
+	t.Helper()
+	appendFrom(t, b, "hr@acme.com", subject, date)
+}
+
+// appendFrom delivers a message from sender that arrived at date
+func appendFrom(t *testing.T, b *imapBackend, sender, subject string, date time.Time) {
+	t.Helper()
+	msg := fmt.Sprintf("From: %s\r\nSubject: %s\r\nDate: %s\r\n\r\nHello\r\n", sender, subject, date.Format(time.RFC1123Z))
+	if err := b.c.Append("INBOX", nil, date, bytes.NewBufferString(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIMAPSearchPagesExactRange(t *testing.T) {
+	b := newIMAPBackend(t)
+	day := func(d, hour int) time.Time { return time.Date(2025, time.March, d, hour, 0, 0, 0, time.UTC) }
+	appendAt(t, b, "Too early", day(10, 8))
+	appendAt(t, b, "First", day(10, 13))
+	appendAt(t, b, "Second", day(10, 18))
+	appendAt(t, b, "Third", day(11, 9))
+	appendAt(t, b, "Too late", day(11, 15))
+	if _, err := b.Open("INBOX", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// SEARCH widens the range to whole days, which take in all five
+	intent := &Intent{Command: CommandSearch, DateRange: &DateRange{Start: day(10, 12), End: day(11, 12)}, Limit: 2}
+	messages, total, err := b.Search(intent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(messages) != 2 || messages[0].Subject != "Third" || messages[1].Subject != "Second" {
+		t.Errorf("page 1 = %d of %d: %+v", len(messages), total, messages)
+	}
+
+	intent.Page = 2
+	if messages, total, err = b.Search(intent); err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(messages) != 1 || messages[0].Subject != "First" {
+		t.Errorf("page 2 = %d of %d: %+v", len(messages), total, messages)
+	}
+}
+
+func TestIMAPMatchesEveryKeyword(t *testing.T) {
+	b := newIMAPBackend(t)
+	appendFrom(t, b, "hr@acme.com", "Alpha report", at(1))
+	appendFrom(t, b, "hr@acme.com", "Beta report", at(2))
+	appendFrom(t, b, "hr@acme.com", "Gamma report", at(3))
+	appendFrom(t, b, "hr@notacme.com", "Alpha report", at(4))
+	if _, err := b.Open("INBOX", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server matches text case-sensitively, unlike most servers
+	intent := &Intent{Command: CommandTrash, Keywords: []string{"Alpha", "Beta"}}
+	intent.SetSender("acme.com", true)
+	messages, err := b.Matches(intent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, msg := range messages {
+		subjects = append(subjects, msg.Subject)
+		if msg.Body != "" {
+			t.Errorf("%s was downloaded to re-check it", msg.Subject)
+		}
+	}
+	if want := []string{"Alpha report", "Beta report"}; !slices.Equal(subjects, want) {
+		t.Errorf("matched %q, want %q", subjects, want)
+	}
+}
+
+func TestTemplateReplyAnswersMatchesOnly(t *testing.T) {
+	b := newIMAPBackend(t)
+	appendFrom(t, b, "hr@acme.com", "Opportunity at Acme", at(1))
+	appendFrom(t, b, "hr@notacme.com", "Opportunity elsewhere", at(2))
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, templateDir), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, templateDir, "thanks.tmpl"), []byte("Thanks, {{.SenderName}}."), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	// Nothing is confirmed, so the replies are only previewed
+	var out bytes.Buffer
+	e := NewExecutor(b.c)
+	e.SetOutput(&out)
+	e.SetResponder(responder.New(responder.GmailSMTP, "me@example.com", nil))
+	e.SetConfirm(func(string) bool { return false }, DefaultConfirmThreshold)
+
+	intent, err := NewParser().Parse(`reply with "thanks" to search for "Opportunity" from "acme.com"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(intent); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Rendered 1 replies") || !strings.Contains(out.String(), "Re: Opportunity at Acme") {
+		t.Errorf("output doesn't preview one reply to Acme:\n%s", out.String())
+	}
+}
+
+func TestIndexSearchStaysCurrent(t *testing.T) {
+	b := newIMAPBackend(t)
+	appendAt(t, b, "Alpha report", at(1))
+	appendAt(t, b, "Beta report", at(2))
+	appendAt(t, b, "Gamma report", at(3))
+
+	ix, err := index.Open(filepath.Join(t.TempDir(), "index.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	e := NewExecutor(b.c)
+	e.SetOutput(&out)
+	e.SetIndex(ix)
+	if _, err := e.Execute(NewIntent(CommandSync)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expunged on the server after the sync
+	uidOf := func(subject string) uint32 {
+		criteria := imap.NewSearchCriteria()
+		criteria.Header.Set("Subject", subject)
+		uids, err := b.c.UidSearch(criteria)
+		if err != nil || len(uids) != 1 {
+			t.Fatalf("finding %s: %v %v", subject, uids, err)
+		}
+		return uids[0]
+	}
+	set := new(imap.SeqSet)
+	set.AddNum(uidOf("Beta report"))
+	if err := b.c.UidStore(set, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.c.Expunge(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) []string {
+		t.Helper()
+		out.Reset()
+		intent, err := NewParser().Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Execute(intent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var subjects []string
+		for _, msg := range result.Messages {
+			subjects = append(subjects, msg.Subject)
+		}
+		return subjects
+	}
+
+	if got, want := search(`search from "acme.com"`), []string{"Gamma report", "Alpha report"}; !slices.Equal(got, want) || !strings.Contains(out.String(), "local index") {
+		t.Errorf("index search found %q, want %q from the index", got, want)
+	}
+
+	// Dates before the oldest indexed message go to the server
+	ix.Remove(uidOf("Alpha report"))
+	if got, want := search(`search from "acme.com" [2025-03-01 to 2025-03-31]`), []string{"Gamma report", "Alpha report"}; !slices.Equal(got, want) || strings.Contains(out.String(), "local index") {
+		t.Errorf("search before the index found %q, want %q from the server", got, want)
+	}
+}
@@ -10,21 +10,118 @@ type CommandType string
 const (
 	CommandSearch CommandType = "search"
 	CommandListen CommandType = "listen"
+
+	// Message actions operate on every message matching the intent
+	CommandArchive    CommandType = "archive"
+	CommandMarkRead   CommandType = "mark read"
+	CommandMarkUnread CommandType = "mark unread"
+	CommandStar       CommandType = "star"
+	CommandUnstar     CommandType = "unstar"
+	CommandLabel      CommandType = "label"
+	CommandMove       CommandType = "move"
+	CommandTrash      CommandType = "trash"
+
+	// CommandUndo reverses a journaled action
+	CommandUndo CommandType = "undo"
+
+	// CommandReply answers a message from the last search results
+	CommandReply CommandType = "reply"
+
+	// CommandSync mirrors the mailbox into the local search index
+	CommandSync CommandType = "sync"
+
+	// CommandFolders lists the mailboxes with their message counts
+	CommandFolders CommandType = "folders"
+
+	// CommandExpand lists the messages of a conversation from the last search
+	CommandExpand CommandType = "expand"
+
+	// CommandNext shows the next page of the last search
+	CommandNext CommandType = "next"
+
+	// CommandAttachments lists the attachments of a message from the last
+	// search, and CommandSaveAttachments saves them to a directory
+	CommandAttachments     CommandType = "attachments"
+	CommandSaveAttachments CommandType = "save attachments"
+
+	// CommandExport writes the messages matching the intent to a file or
+	// directory
+	CommandExport CommandType = "export"
+
+	// CommandSave and CommandDefine store a command as a named macro
+	CommandSave   CommandType = "save"
+	CommandDefine CommandType = "define"
+
+	// CommandSchedule runs a command on a recurring schedule
+	CommandSchedule CommandType = "schedule"
+)
+
+// SortOrder is the order search results are shown in
+type SortOrder string
+
+const (
+	SortDate      SortOrder = "date"      // Newest first
+	SortSender    SortOrder = "sender"    // By sender address, then newest first
+	SortRelevance SortOrder = "relevance" // Best match first, where the search can rank
 )
 
-// DateRange represents a time range for filtering
+// DefaultPageSize is how many results a search shows without a limit
+const DefaultPageSize = 50
+
+// HasAttachmentFilter reports whether the intent filters on attachments,
+// which needs each message's structure
+func (i *Intent) HasAttachmentFilter() bool {
+	return i.HasAttachment || i.Filename != ""
+}
+
+// IsAction reports whether the command modifies the matched messages
+func (c CommandType) IsAction() bool {
+	switch c {
+	case CommandArchive, CommandMarkRead, CommandMarkUnread, CommandStar,
+		CommandUnstar, CommandLabel, CommandMove, CommandTrash:
+		return true
+	}
+	return false
+}
+
+// DateRange is the half-open time range [Start, End). A zero Start or End
+// leaves that side unbounded.
 type DateRange struct {
 	Start time.Time
 	End   time.Time
+	Expr  string // The expression it was parsed from, e.g. "last 7 days"
+}
+
+// Contains reports whether t falls within the range
+func (r *DateRange) Contains(t time.Time) bool {
+	return (r.Start.IsZero() || !t.Before(r.Start)) && (r.End.IsZero() || t.Before(r.End))
 }
 
 // Intent represents a parsed user intent
 type Intent struct {
-	Command       CommandType
-	Keywords      []string   // What to search for (e.g., "updates", "invite", "assessment")
-	Sender        string     // Email sender to filter by
-	DateRange     *DateRange // Optional date range
-	AllFromSender bool       // True if user wants ALL emails from sender (*)
+	Command       CommandType `json:"command"`
+	Keywords      []string    `json:"keywords,omitempty"`        // What to search for (e.g., "updates", "invite", "assessment")
+	About         string      `json:"about,omitempty"`           // Semantic query, ranked by meaning (SEARCH ABOUT)
+	Sender        string      `json:"sender,omitempty"`          // Email sender to filter by
+	DateRange     *DateRange  `json:"date_range,omitempty"`      // Optional date range
+	AllFromSender bool        `json:"all_from_sender,omitempty"` // True if user wants ALL emails from sender (*)
+	Target        string      `json:"target,omitempty"`          // Label or mailbox for LABEL / MOVE actions, journal ID for UNDO, macro name for SAVE / DEFINE, schedule for SCHEDULE, directory for SAVE ATTACHMENTS, destination for EXPORT
+	DryRun        bool        `json:"dry_run,omitempty"`         // List the affected messages without changing them
+	Result        int         `json:"result,omitempty"`          // 1-based index into the last search results (REPLY, EXPAND, ATTACHMENTS)
+	Text          string      `json:"text,omitempty"`            // Reply body (REPLY), command a macro or schedule runs
+	Draft         bool        `json:"draft,omitempty"`           // Save the reply to Drafts instead of sending it
+	Template      string      `json:"template,omitempty"`        // Reply template name (REPLY WITH, LISTEN ... RESPOND WITH)
+	Archive       string      `json:"archive,omitempty"`         // Local mbox file or Maildir to search instead of the server
+	Mailbox       string      `json:"mailbox,omitempty"`         // Folder to work in (IN "folder"), INBOX when empty
+	AllFolders    bool        `json:"all_folders,omitempty"`     // Search every folder (IN ALL)
+	Params        []string    `json:"params,omitempty"`          // Macro parameter names, without the $ (DEFINE)
+	Notify        string      `json:"notify,omitempty"`          // Where scheduled results go: stdout or file:path (SCHEDULE)
+	Sort          SortOrder   `json:"sort,omitempty"`            // Result order (SORT BY), by relevance for ABOUT, else newest first, when empty
+	Limit         int         `json:"limit,omitempty"`           // Results per page (LIMIT), DefaultPageSize when 0
+	Page          int         `json:"page,omitempty"`            // 1-based page of results (PAGE), the first when 0
+	HasAttachment bool        `json:"has_attachment,omitempty"`  // Only messages with attachments (HAS:ATTACHMENT)
+	Filename      string      `json:"filename,omitempty"`        // Only messages with an attachment whose name matches this glob (FILENAME:)
+	LargerThan    int64       `json:"larger_than,omitempty"`     // Only messages larger than this many bytes (LARGER THAN)
 }
 
 // NewIntent creates a new Intent
@@ -46,6 +143,20 @@ func (i *Intent) SetSender(sender string, all bool) {
 	i.AllFromSender = all
 }
 
+// Folder returns the mailbox the intent works in. Searches, actions and
+// listeners all default to INBOX.
+func (i *Intent) Folder() string {
+	if i.Mailbox == "" {
+		return "INBOX"
+	}
+	return i.Mailbox
+}
+
+// SetTarget sets the label or mailbox an action applies to
+func (i *Intent) SetTarget(target string) {
+	i.Target = target
+}
+
 // SetDateRange sets the date range filter
 func (i *Intent) SetDateRange(start, end time.Time) {
 	i.DateRange = &DateRange{
@@ -53,15 +164,3 @@ func (i *Intent) SetDateRange(start, end time.Time) {
 		End:   end,
 	}
 }
-
-// SetRecentRange sets the date range to "recent" (yesterday to today)
-func (i *Intent) SetRecentRange() {
-	now := time.Now()
-	yesterday := now.AddDate(0, 0, -1)
-
-	// Set to start of yesterday and end of today
-	start := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-	end := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-
-	i.SetDateRange(start, end)
-}
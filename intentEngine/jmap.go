@@ -0,0 +1,418 @@
+package intentengine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PlantingTrees/intent/jmap"
+)
+
+// jmapBackend runs the executor's commands against a JMAP server. JMAP ids
+// are strings, so each email gets a number for the session; the numbers
+// don't outlive it, so folders report no UIDVALIDITY.
+type jmapBackend struct {
+	c *jmap.Client
+
+	mailboxes []jmap.Mailbox // Loaded on first use
+	open      *jmap.Mailbox
+
+	ids     []string          // Email id by number - 1
+	numbers map[string]uint32 // Number by email id
+}
+
+// newJMAPBackend creates a backend for a JMAP account
+func newJMAPBackend(c *jmap.Client) *jmapBackend {
+	return &jmapBackend{c: c, numbers: make(map[string]uint32)}
+}
+
+// number returns the session number of an email id
+func (b *jmapBackend) number(id string) uint32 {
+	if n, ok := b.numbers[id]; ok {
+		return n
+	}
+	b.ids = append(b.ids, id)
+	b.numbers[id] = uint32(len(b.ids))
+	return uint32(len(b.ids))
+}
+
+// emailIDs turns session numbers back into email ids
+func (b *jmapBackend) emailIDs(uids []uint32) []string {
+	ids := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		if uid >= 1 && int(uid) <= len(b.ids) {
+			ids = append(ids, b.ids[uid-1])
+		}
+	}
+	return ids
+}
+
+// mailbox finds a mailbox by name, or by role for the names the executor
+// uses for Gmail's system folders
+func (b *jmapBackend) mailbox(name string) (*jmap.Mailbox, error) {
+	if b.mailboxes == nil {
+		mailboxes, err := b.c.Mailboxes()
+		if err != nil {
+			return nil, err
+		}
+		b.mailboxes = mailboxes
+	}
+
+	roles := map[string][]string{
+		"INBOX":        {"inbox"},
+		allMailMailbox: {"all", "archive"},
+		trashMailbox:   {"trash"},
+	}[name]
+	for _, role := range roles {
+		for i := range b.mailboxes {
+			if b.mailboxes[i].Role == role {
+				return &b.mailboxes[i], nil
+			}
+		}
+	}
+	for i := range b.mailboxes {
+		if b.mailboxes[i].Name == name {
+			return &b.mailboxes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no mailbox %s", name)
+}
+
+// email converts a JMAP email and numbers it
+func (b *jmapBackend) email(m *jmap.Email) Email {
+	email := jmapEmail(m)
+	email.UID = b.number(m.ID)
+	if b.open != nil && m.MailboxIDs[b.open.ID] {
+		email.Mailbox = b.open.Name
+	}
+	return email
+}
+
+// Open finds the mailbox. JMAP has no read-only mode; nothing is marked
+// read by fetching.
+func (b *jmapBackend) Open(folder string, readOnly bool) (*Folder, error) {
+	mailbox, err := b.mailbox(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+	b.open = mailbox
+	return &Folder{Name: mailbox.Name, Messages: uint32(mailbox.TotalEmails)}, nil
+}
+
+// Search runs Email/query and Email/get in a single request, so every
+// keyword is matched by the server instead of only the first, and only
+// the page shown is fetched
+func (b *jmapBackend) Search(intent *Intent) ([]Email, int, error) {
+	if b.open == nil {
+		return nil, 0, fmt.Errorf("no mailbox open")
+	}
+
+	// JMAP has no relevance sort, so relevance falls back to newest first
+	var order []jmap.Comparator
+	if intent.Sort == SortSender {
+		order = []jmap.Comparator{{Property: "from", IsAscending: true}, {Property: "receivedAt"}}
+	}
+	offset, size := pageBounds(intent, DefaultPageSize)
+	if intent.Filename != "" {
+		// JMAP can't match attachment names, so the server's matches are
+		// filtered and paged here
+		offset, size = 0, 0
+	}
+	found, total, err := b.c.Search(jmapFilter(intent, b.open.ID), order, offset, size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search failed: %w", err)
+	}
+
+	var messages []Email
+	for i := range found {
+		messages = append(messages, b.email(&found[i]))
+	}
+	if intent.Filename != "" {
+		var named []Email
+		for _, msg := range messages {
+			if matchesAttachments(msg, intent) {
+				named = append(named, msg)
+			}
+		}
+		return pageOf(named, intent, DefaultPageSize), len(named), nil
+	}
+	return messages, total, nil
+}
+
+// Matches fetches every match, then re-checks sender, date and attachments
+// locally, so a loose server-side match never widens a bulk action. Each
+// email's mailboxes are its labels.
+func (b *jmapBackend) Matches(intent *Intent) ([]Email, error) {
+	if b.open == nil {
+		return nil, fmt.Errorf("no mailbox open")
+	}
+	found, _, err := b.c.Search(jmapFilter(intent, b.open.ID), nil, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	local := *intent
+	local.Keywords = nil
+
+	var messages []Email
+	for i := range found {
+		email := b.email(&found[i])
+		if !matchesIntent(email, &local) {
+			continue
+		}
+		for _, mailbox := range b.mailboxes {
+			if found[i].MailboxIDs[mailbox.ID] {
+				email.Labels = append(email.Labels, mailbox.Name)
+			}
+		}
+		messages = append(messages, email)
+	}
+	return messages, nil
+}
+
+// Fetch fetches one email by its number
+func (b *jmapBackend) Fetch(uid uint32) (*Email, error) {
+	ids := b.emailIDs([]uint32{uid})
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no message %d: %w", uid, ErrNotFound)
+	}
+	found, _, err := b.c.Get(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no message %d: %w", uid, ErrNotFound)
+	}
+	email := b.email(&found[0])
+	return &email, nil
+}
+
+// FindMessageID queries the Message-ID header in the open mailbox
+func (b *jmapBackend) FindMessageID(id string) ([]uint32, error) {
+	if b.open == nil {
+		return nil, fmt.Errorf("no mailbox open")
+	}
+	ids, err := b.c.Query(jmap.FilterCondition{InMailbox: b.open.ID, Header: []string{"Message-ID", id}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", id, err)
+	}
+	uids := make([]uint32, len(ids))
+	for i, id := range ids {
+		uids[i] = b.number(id)
+	}
+	return uids, nil
+}
+
+// Store sets or clears the keyword for an IMAP flag
+func (b *jmapBackend) Store(uids []uint32, flag string, add bool) error {
+	return b.patch(uids, "keywords/"+jmapKeyword(flag), add)
+}
+
+// Label adds emails to a mailbox, or takes them out of it
+func (b *jmapBackend) Label(uids []uint32, label string, add bool) error {
+	mailbox, err := b.mailbox(label)
+	if err != nil {
+		return err
+	}
+	return b.patch(uids, "mailboxIds/"+mailbox.ID, add)
+}
+
+// Copy isn't needed: an email is put in another mailbox with Label
+func (b *jmapBackend) Copy(uids []uint32, dest string) (*Copied, error) {
+	return nil, fmt.Errorf("copying is not supported over JMAP")
+}
+
+// Move takes emails out of the open mailbox and puts them in dest, leaving
+// any other mailboxes they are in alone
+func (b *jmapBackend) Move(uids []uint32, dest string) error {
+	if b.open == nil {
+		return fmt.Errorf("no mailbox open")
+	}
+	mailbox, err := b.mailbox(dest)
+	if err != nil {
+		return err
+	}
+	patches := make(map[string]map[string]interface{})
+	for _, id := range b.emailIDs(uids) {
+		patches[id] = map[string]interface{}{
+			"mailboxIds/" + b.open.ID:  nil,
+			"mailboxIds/" + mailbox.ID: true,
+		}
+	}
+	return b.c.Update(patches)
+}
+
+// Delete destroys exactly these emails
+func (b *jmapBackend) Delete(uids []uint32) error {
+	return b.c.Destroy(b.emailIDs(uids))
+}
+
+// patch sets or clears one boolean property path on every email
+func (b *jmapBackend) patch(uids []uint32, path string, set bool) error {
+	var value interface{}
+	if set {
+		value = true
+	}
+	patches := make(map[string]map[string]interface{})
+	for _, id := range b.emailIDs(uids) {
+		patches[id] = map[string]interface{}{path: value}
+	}
+	return b.c.Update(patches)
+}
+
+// Watch waits for push notifications instead of polling, then fetches
+// only the emails created in folder since the last known state. All Mail
+// watches every mailbox.
+func (b *jmapBackend) Watch(ctx context.Context, folder string, found func([]Email)) error {
+	var mailbox *jmap.Mailbox
+	if folder != allMailMailbox {
+		var err error
+		if mailbox, err = b.mailbox(folder); err != nil {
+			return err
+		}
+	}
+
+	// An empty Email/get returns the current state to diff against
+	_, state, err := b.c.Get([]string{})
+	if err != nil {
+		return err
+	}
+
+	err = b.c.Watch(ctx, func(newState string) error {
+		if newState == state {
+			return nil
+		}
+
+		created, next, err := b.c.Changes(state)
+		if err != nil {
+			return err
+		}
+		state = next
+		if len(created) == 0 {
+			return nil
+		}
+
+		emails, _, err := b.c.Get(created)
+		if err != nil {
+			return err
+		}
+		var arrived []Email
+		for i := range emails {
+			if mailbox == nil || emails[i].MailboxIDs[mailbox.ID] {
+				email := b.email(&emails[i])
+				if mailbox != nil {
+					email.Mailbox = mailbox.Name
+				}
+				arrived = append(arrived, email)
+			}
+		}
+		if len(arrived) > 0 {
+			found(arrived)
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// jmapFilter compiles the intent into an Email/query filter: all conditions
+// must hold, and any one keyword is enough
+func jmapFilter(intent *Intent, mailbox string) interface{} {
+	base := jmap.FilterCondition{InMailbox: mailbox}
+	if intent.Sender != "" {
+		base.From = intent.Sender
+	}
+	// minSize is inclusive
+	if intent.LargerThan > 0 {
+		base.MinSize = intent.LargerThan + 1
+	}
+	base.HasAttachment = intent.HasAttachmentFilter()
+	if intent.DateRange != nil {
+		if !intent.DateRange.Start.IsZero() {
+			after := intent.DateRange.Start.UTC()
+			base.After = &after
+		}
+		if !intent.DateRange.End.IsZero() {
+			before := intent.DateRange.End.UTC()
+			base.Before = &before
+		}
+	}
+
+	if len(intent.Keywords) == 0 {
+		return base
+	}
+
+	anyKeyword := jmap.FilterOperator{Operator: "OR"}
+	for _, keyword := range intent.Keywords {
+		anyKeyword.Conditions = append(anyKeyword.Conditions, jmap.FilterCondition{Text: keyword})
+	}
+	return jmap.FilterOperator{Operator: "AND", Conditions: []interface{}{base, anyKeyword}}
+}
+
+// jmapEmail converts a JMAP email to the executor's Email
+func jmapEmail(m *jmap.Email) Email {
+	email := Email{
+		ID:      m.ID,
+		From:    "Unknown",
+		Subject: m.Subject,
+		Date:    m.ReceivedAt,
+		Flags:   []string{},
+		Body:    m.Text(),
+		Size:    uint32(m.Size),
+
+		ThreadID: m.ThreadID,
+	}
+	if len(m.MessageID) > 0 {
+		email.MessageID = m.MessageID[0]
+	}
+	if len(m.From) > 0 {
+		if m.From[0].Name != "" {
+			email.From = fmt.Sprintf("%s <%s>", m.From[0].Name, m.From[0].Email)
+		} else {
+			email.From = m.From[0].Email
+		}
+	}
+	for _, part := range m.Attachments {
+		if part.Name != "" {
+			email.Attachments = append(email.Attachments, Attachment{Filename: baseName(part.Name), ContentType: part.Type, Size: part.Size})
+		}
+	}
+	for keyword, set := range m.Keywords {
+		if set {
+			email.Flags = append(email.Flags, jmapFlag(keyword))
+		}
+	}
+	return email
+}
+
+// jmapKeyword maps IMAP flag names to JMAP keywords, the reverse of jmapFlag
+func jmapKeyword(flag string) string {
+	switch strings.ToLower(flag) {
+	case `\seen`:
+		return "$seen"
+	case `\flagged`:
+		return "$flagged"
+	case `\answered`:
+		return "$answered"
+	case `\draft`:
+		return "$draft"
+	}
+	return flag
+}
+
+// jmapFlag maps JMAP keywords to IMAP flag names (RFC 8621 section 4.1.1)
+func jmapFlag(keyword string) string {
+	switch keyword {
+	case "$seen":
+		return `\Seen`
+	case "$flagged":
+		return `\Flagged`
+	case "$answered":
+		return `\Answered`
+	case "$draft":
+		return `\Draft`
+	}
+	return keyword
+}
@@ -0,0 +1,312 @@
+package intentengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PlantingTrees/intent/jmap"
+)
+
+// fakeJMAP is a JMAP server with one account, an inbox and an archive,
+// that answers the methods the backend sends and pushes state changes
+type fakeJMAP struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	emails  []*jmap.Email
+	created map[int][]string // Email ids created in each state, by state
+	state   int
+
+	connected chan struct{}   // Receives when an event stream opens
+	push      chan string     // States to send on the event stream
+	calls     map[string]bool // Methods called
+}
+
+func newFakeJMAP(t *testing.T) *fakeJMAP {
+	f := &fakeJMAP{
+		t:         t,
+		created:   make(map[int][]string),
+		connected: make(chan struct{}, 1),
+		push:      make(chan string, 1),
+		calls:     make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session", f.session)
+	mux.HandleFunc("/api", f.api)
+	mux.HandleFunc("/events", f.events)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// add stores an email in the inbox and returns its id
+func (f *fakeJMAP) add(from, subject string, at time.Time) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := fmt.Sprintf("e%d", len(f.emails)+1)
+	f.state++
+	f.created[f.state] = append(f.created[f.state], id)
+	f.emails = append(f.emails, &jmap.Email{
+		ID:         id,
+		ThreadID:   "t" + id,
+		MessageID:  []string{id + "@example.org"},
+		From:       []jmap.Address{{Email: from}},
+		Subject:    subject,
+		ReceivedAt: at,
+		Keywords:   map[string]bool{},
+		MailboxIDs: map[string]bool{"inbox": true},
+	})
+	return id
+}
+
+func (f *fakeJMAP) email(id string) *jmap.Email {
+	for _, m := range f.emails {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (f *fakeJMAP) session(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jmap.Session{
+		APIURL:          f.srv.URL + "/api",
+		EventSourceURL:  f.srv.URL + "/events?types={types}&closeafter={closeafter}&ping={ping}",
+		PrimaryAccounts: map[string]string{jmap.MailCapability: "a1"},
+	})
+}
+
+func (f *fakeJMAP) api(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MethodCalls [][]json.RawMessage `json:"methodCalls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("bad request: %v", err)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var responses [][]interface{}
+	var queried []string
+	for _, call := range req.MethodCalls {
+		var name, id string
+		var args map[string]json.RawMessage
+		json.Unmarshal(call[0], &name)
+		json.Unmarshal(call[1], &args)
+		json.Unmarshal(call[2], &id)
+		f.calls[name] = true
+
+		var result interface{}
+		switch name {
+		case "Mailbox/get":
+			result = map[string]interface{}{"list": []jmap.Mailbox{
+				{ID: "inbox", Name: "Inbox", Role: "inbox"},
+				{ID: "archive", Name: "Archive", Role: "archive"},
+			}}
+		case "Email/query":
+			queried = f.query(args["filter"])
+			result = map[string]interface{}{"ids": queried, "total": len(queried)}
+		case "Email/get":
+			var ids []string
+			if _, ok := args["#ids"]; ok {
+				ids = queried
+			} else {
+				json.Unmarshal(args["ids"], &ids)
+			}
+			list := []*jmap.Email{}
+			for _, id := range ids {
+				if m := f.email(id); m != nil {
+					list = append(list, m)
+				}
+			}
+			result = map[string]interface{}{"list": list, "state": strconv.Itoa(f.state)}
+		case "Email/changes":
+			var since string
+			json.Unmarshal(args["sinceState"], &since)
+			from, _ := strconv.Atoi(since)
+			created := []string{}
+			for s := from + 1; s <= f.state; s++ {
+				created = append(created, f.created[s]...)
+			}
+			result = map[string]interface{}{"newState": strconv.Itoa(f.state), "created": created}
+		case "Email/set":
+			var update map[string]map[string]interface{}
+			json.Unmarshal(args["update"], &update)
+			for id, patch := range update {
+				m := f.email(id)
+				for path, value := range patch {
+					key, name, _ := strings.Cut(path, "/")
+					set := map[string]map[string]bool{"keywords": m.Keywords, "mailboxIds": m.MailboxIDs}[key]
+					if value == true {
+						set[name] = true
+					} else {
+						delete(set, name)
+					}
+				}
+			}
+			result = map[string]interface{}{}
+		default:
+			f.t.Errorf("unexpected method %s", name)
+		}
+		responses = append(responses, []interface{}{name, result, id})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"methodResponses": responses})
+}
+
+// query matches an inMailbox, from and header filter, or the first
+// condition of an operator, newest first
+func (f *fakeJMAP) query(raw json.RawMessage) []string {
+	var filter struct {
+		jmap.FilterCondition
+		Conditions []jmap.FilterCondition `json:"conditions"`
+	}
+	json.Unmarshal(raw, &filter)
+	cond := filter.FilterCondition
+	if len(filter.Conditions) > 0 {
+		cond = filter.Conditions[0]
+	}
+
+	ids := []string{}
+	for i := len(f.emails) - 1; i >= 0; i-- {
+		m := f.emails[i]
+		switch {
+		case cond.InMailbox != "" && !m.MailboxIDs[cond.InMailbox]:
+		case cond.From != "" && !strings.Contains(m.From[0].Email, cond.From):
+		case len(cond.Header) == 2 && normalizeMessageID(cond.Header[1]) != m.MessageID[0]:
+		default:
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+func (f *fakeJMAP) events(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("types") != "Email" {
+		f.t.Errorf("event source types = %q", r.URL.Query().Get("types"))
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	f.connected <- struct{}{}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case state := <-f.push:
+			fmt.Fprintf(w, "event: state\ndata: {\"changed\":{\"a1\":{\"Email\":%q}}}\n\n", state)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func newJMAPExecutor(t *testing.T) (*Executor, *fakeJMAP) {
+	f := newFakeJMAP(t)
+	e := NewExecutor(nil)
+	e.SetJMAP(jmap.New(f.srv.URL+"/session", "token"))
+	return e, f
+}
+
+func TestJMAPSearchAndAction(t *testing.T) {
+	e, f := newJMAPExecutor(t)
+	e.SetJournal(NewJournal(t.TempDir()+"/journal.jsonl", "me@example.org"))
+	f.add("hr@acme.com", "Interview", at(1))
+	f.add("news@other.com", "Weekly", at(2))
+	f.add("hr@acme.com", "Offer", at(3))
+
+	result := run(t, e, `search from "acme.com"`)
+	var subjects []string
+	for _, msg := range result.Messages {
+		subjects = append(subjects, msg.Subject)
+	}
+	if strings.Join(subjects, ",") != "Offer,Interview" {
+		t.Errorf("found %v", subjects)
+	}
+
+	run(t, e, `star from "acme.com"`)
+	if !f.email("e1").Keywords["$flagged"] || !f.email("e3").Keywords["$flagged"] || f.email("e2").Keywords["$flagged"] {
+		t.Error("star didn't set $flagged on exactly the matches")
+	}
+
+	run(t, e, `undo`)
+	if f.email("e1").Keywords["$flagged"] || f.email("e3").Keywords["$flagged"] {
+		t.Error("undo left $flagged set")
+	}
+
+	run(t, e, `archive from "other.com"`)
+	if m := f.email("e2").MailboxIDs; m["inbox"] || !m["archive"] {
+		t.Errorf("archived email is in %v", m)
+	}
+
+	for _, method := range []string{"Email/query", "Email/get", "Email/set"} {
+		if !f.calls[method] {
+			t.Errorf("%s was never called", method)
+		}
+	}
+}
+
+func TestJMAPListen(t *testing.T) {
+	e, f := newJMAPExecutor(t)
+	f.add("hr@acme.com", "Old", at(1))
+
+	matched := make(chan Email, 4)
+	e.SetListenHook(func(msg Email) { matched <- msg })
+
+	intent, err := NewParser().Parse(`listen from "acme.com"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Validate(intent); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Listen(ctx, intent) }()
+
+	select {
+	case <-f.connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener never opened the event source")
+	}
+
+	f.add("news@other.com", "Weekly", at(2))
+	f.add("hr@acme.com", "New role", at(3))
+	f.push <- strconv.Itoa(f.state)
+
+	select {
+	case msg := <-matched:
+		if msg.Subject != "New role" {
+			t.Errorf("listener matched %q", msg.Subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't report the new email")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Listen: %v", err)
+	}
+	if !f.calls["Email/changes"] {
+		t.Error("Email/changes was never called")
+	}
+	select {
+	case msg := <-matched:
+		t.Errorf("listener also matched %q", msg.Subject)
+	default:
+	}
+}
@@ -0,0 +1,154 @@
+package intentengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// JournalMessage is the state of one message before a mutation
+type JournalMessage struct {
+	UID       uint32   `json:"uid"`
+	MessageID string   `json:"message_id"`
+	Flags     []string `json:"flags"`
+	Labels    []string `json:"labels,omitempty"`
+	CopyUID   uint32   `json:"copy_uid,omitempty"` // UID of the copy a label made in the target folder
+}
+
+// JournalEntry records one mutation applied to a mailbox
+type JournalEntry struct {
+	ID          string      `json:"id"`
+	Time        time.Time   `json:"time"`
+	Account     string      `json:"account"`
+	Operation   CommandType `json:"operation"`
+	Query       string      `json:"query,omitempty"`  // The command, in canonical form
+	Mailbox     string      `json:"mailbox"`          // Mailbox the messages were in
+	Target      string      `json:"target,omitempty"` // Label or mailbox the action applied
+	UIDValidity uint32      `json:"uid_validity"`
+	// UIDVALIDITY of the target folder when copies were recorded
+	TargetUIDValidity uint32           `json:"target_uid_validity,omitempty"`
+	Messages          []JournalMessage `json:"messages,omitempty"`
+	Undoes            string           `json:"undoes,omitempty"` // ID of the entry an undo reversed
+}
+
+// Journal is an append-only log of mailbox mutations, one JSON entry per line
+type Journal struct {
+	path    string
+	account string
+}
+
+// NewJournal creates a journal stored at path for the given account
+func NewJournal(path, account string) *Journal {
+	return &Journal{
+		path:    path,
+		account: account,
+	}
+}
+
+// DefaultJournalPath is where the journal is kept unless told otherwise,
+// so every session undoes from the same one wherever it was started
+func DefaultJournalPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "intent", "journal.jsonl"), nil
+}
+
+// Append assigns the entry an ID and appends it to the journal. The
+// journal is locked from reading the last ID to writing the entry, so
+// sessions sharing it never hand out the same ID.
+func (j *Journal) Append(entry *JournalEntry) error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return fmt.Errorf("unable to create journal directory: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %w", err)
+	}
+	defer f.Close()
+	unlock, err := lockFile(f)
+	if err != nil {
+		return fmt.Errorf("unable to lock journal: %w", err)
+	}
+	defer unlock()
+
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+
+	entry.ID = strconv.Itoa(len(entries) + 1)
+	entry.Account = j.account
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// Entries reads every entry in the journal, oldest first
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal: %w", err)
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt journal entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Undoable returns the entry with the given ID, or the most recent entry
+// that hasn't been undone yet when id is empty
+func (j *Journal) Undoable(id string) (*JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	undone := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Undoes != "" {
+			undone[entry.Undoes] = true
+		}
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Undoes != "" || entry.Account != j.account {
+			continue
+		}
+		if id != "" && entry.ID != id {
+			continue
+		}
+		if undone[entry.ID] {
+			if id != "" {
+				return nil, fmt.Errorf("journal entry %s was already undone", id)
+			}
+			continue
+		}
+		return &entry, nil
+	}
+
+	if id != "" {
+		return nil, fmt.Errorf("no journal entry %s", id)
+	}
+	return nil, fmt.Errorf("nothing to undo")
+}
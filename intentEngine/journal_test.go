@@ -0,0 +1,43 @@
+package intentengine
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJournalIDsAreUniqueAcrossSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intent", "journal.jsonl")
+
+	// Each session opens its own journal on the shared file
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j := NewJournal(path, "me@example.com")
+			for n := 0; n < 25; n++ {
+				if err := j.Append(&JournalEntry{Operation: CommandStar, Mailbox: "INBOX"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := NewJournal(path, "me@example.com").Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			t.Errorf("ID %s handed out twice", entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+	if len(entries) != 100 {
+		t.Errorf("%d entries, want 100", len(entries))
+	}
+}
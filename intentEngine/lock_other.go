@@ -0,0 +1,11 @@
+//go:build !unix
+
+package intentengine
+
+import "os"
+
+// lockFile does nothing where flock isn't available; sessions there
+// shouldn't write one journal at the same time
+func lockFile(f *os.File) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,254 @@
+package intentengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// macroName is what saved commands may be called; verbs are reserved
+var macroName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// reservedNames can't be used as macro names
+var reservedNames = []string{"run", "save", "define", "help", "examples", "quit", "exit"}
+
+// Macro is a saved command, optionally with parameters
+type Macro struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params,omitempty"` // Parameter names, without the $
+	Query  string   `json:"query"`            // Command text, with $name where each argument goes
+}
+
+// macroParam is a $name where a macro argument goes
+var macroParam = regexp.MustCompile(`\$\w+`)
+
+// Expand returns the macro's command with the arguments filled in. It is
+// done in one pass, so an argument holding $name is kept as written, and
+// $company stays whole when only $co is a parameter.
+func (m Macro) Expand(args []string) (string, error) {
+	if len(args) != len(m.Params) {
+		return "", fmt.Errorf("%s takes %d arguments, got %d", m.Name, len(m.Params), len(args))
+	}
+
+	values := make(map[string]string, len(m.Params))
+	for i, param := range m.Params {
+		if strings.Contains(args[i], `"`) {
+			return "", fmt.Errorf("argument %d can't contain quotes", i+1)
+		}
+		values[param] = args[i]
+	}
+	return macroParam.ReplaceAllStringFunc(m.Query, func(token string) string {
+		if value, ok := values[token[1:]]; ok {
+			return value
+		}
+		return token
+	}), nil
+}
+
+// String shows how the macro is used and what it runs
+func (m Macro) String() string {
+	usage := m.Name
+	for _, param := range m.Params {
+		usage += " $" + param
+	}
+	return usage + " = " + m.Query
+}
+
+// Macros are the user's saved commands, kept in a JSON file. The file is
+// read again when another process changes it.
+type Macros struct {
+	path     string
+	mu       sync.Mutex
+	macros   map[string]Macro
+	modified time.Time // Modification time and size of the file last read
+	size     int64
+}
+
+// DefaultMacrosPath is where macros are kept unless told otherwise
+func DefaultMacrosPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "intent", "macros.json"), nil
+}
+
+// LoadMacros reads the macros saved at path. A missing file has none.
+func LoadMacros(path string) (*Macros, error) {
+	m := &Macros{
+		path:   path,
+		macros: make(map[string]Macro),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load reads the file if it changed since it was last read, and forgets
+// every macro if it was deleted. The caller holds the lock, or has the
+// only reference.
+func (m *Macros) load() error {
+	info, err := os.Stat(m.path)
+	if os.IsNotExist(err) {
+		m.macros = make(map[string]Macro)
+		m.modified, m.size = time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read macros: %w", err)
+	}
+	// A rewrite within the clock's resolution keeps the time, so the size
+	// is compared too
+	if info.ModTime().Equal(m.modified) && info.Size() == m.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("unable to read macros: %w", err)
+	}
+	var list []Macro
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("corrupt macros file: %w", err)
+	}
+
+	m.macros = make(map[string]Macro)
+	for _, macro := range list {
+		m.macros[macro.Name] = macro
+	}
+	m.modified, m.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Get returns the macro with the given name
+func (m *Macros) Get(name string) (Macro, bool) {
+	if m == nil {
+		return Macro{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		log.Printf("Macros not reloaded: %v", err)
+	}
+	macro, ok := m.macros[strings.ToLower(name)]
+	return macro, ok
+}
+
+// List returns every macro, sorted by name
+func (m *Macros) List() []Macro {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		log.Printf("Macros not reloaded: %v", err)
+	}
+	list := make([]Macro, 0, len(m.macros))
+	for _, macro := range m.macros {
+		list = append(list, macro)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Names returns the name of every macro
+func (m *Macros) Names() []string {
+	var names []string
+	for _, macro := range m.List() {
+		names = append(names, macro.Name)
+	}
+	return names
+}
+
+// Set adds or replaces a macro and writes the file
+func (m *Macros) Set(macro Macro) error {
+	if err := checkMacroName(macro.Name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Start from the file, so macros saved elsewhere aren't lost
+	if err := m.load(); err != nil {
+		return err
+	}
+	m.macros[macro.Name] = macro
+	list := make([]Macro, 0, len(m.macros))
+	for _, macro := range m.macros {
+		list = append(list, macro)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o700); err != nil {
+		return fmt.Errorf("unable to write macros: %w", err)
+	}
+
+	// Write then rename, so a crash never leaves a half-written file
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write macros: %w", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("unable to write macros: %w", err)
+	}
+	if info, err := os.Stat(m.path); err == nil {
+		m.modified, m.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// checkMacroName rejects names that would shadow a command
+func checkMacroName(name string) error {
+	if !macroName.MatchString(name) {
+		return fmt.Errorf("invalid name %q: use lowercase letters, digits, - and _", name)
+	}
+	for _, reserved := range append(verbTokens, reservedNames...) {
+		if name == reserved {
+			return fmt.Errorf("%q is a command and can't be used as a name", name)
+		}
+	}
+	return nil
+}
+
+// SetMacros sets where save and define store their macros
+func (e *Executor) SetMacros(m *Macros) {
+	e.macros = m
+}
+
+// executeSave stores a saved search or macro
+func (e *Executor) executeSave(intent *Intent) (*Result, error) {
+	macro := Macro{
+		Name:   intent.Target,
+		Params: intent.Params,
+		Query:  intent.Text,
+	}
+	if err := e.macros.Set(macro); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(e.out, "✓ Saved %s\n", macro)
+	return &Result{Command: intent.Command, Macro: &macro}, nil
+}
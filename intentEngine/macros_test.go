@@ -0,0 +1,53 @@
+package intentengine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMacrosReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macros.json")
+	m, err := LoadMacros(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(Macro{Name: "jobs", Query: `search from "*@acme.com"`}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewritten elsewhere with the same modification time
+	other := `[{"name":"jobs","query":"search from \"*@acme.com\""},{"name":"news","query":"search from \"*@news.com\""}]`
+	if err := os.WriteFile(path, []byte(other), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get("news"); !ok {
+		t.Error("a rewrite with the same modification time wasn't reloaded")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.Names(); len(names) != 0 {
+		t.Errorf("macros %v are still defined after the file was deleted", names)
+	}
+}
+
+func TestMacroExpandOnce(t *testing.T) {
+	m := Macro{Name: "pair", Params: []string{"co", "b"}, Query: `search for "$b $company" from "*@$co.com"`}
+	query, err := m.Expand([]string{"$b", "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `search for "acme $company" from "*@$b.com"`; query != want {
+		t.Errorf("Expand = %q, want %q", query, want)
+	}
+}
@@ -0,0 +1,344 @@
+package intentengine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryBackend is a Backend that keeps its folders in memory, for tests
+// and for trying commands without a server. Folders are created as
+// messages are added to them.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	folders  map[string]*memoryFolder
+	open     *memoryFolder
+	labels   bool
+	arrived  chan struct{} // Closed and replaced whenever a message is added
+	watchers int
+}
+
+// memoryFolder is a folder of a MemoryBackend, its messages in UID order
+type memoryFolder struct {
+	name        string
+	uidValidity uint32
+	uidNext     uint32
+	messages    []Email
+}
+
+// NewMemoryBackend creates an empty store with the given folders
+func NewMemoryBackend(folders ...string) *MemoryBackend {
+	m := &MemoryBackend{
+		folders: make(map[string]*memoryFolder),
+		arrived: make(chan struct{}),
+	}
+	for _, name := range folders {
+		m.folder(name)
+	}
+	return m
+}
+
+// SetLabels makes the store keep Gmail-style labels, instead of labels
+// being copies into folders
+func (m *MemoryBackend) SetLabels(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.labels = on
+}
+
+// Add appends a message to folder and returns the UID it got
+func (m *MemoryBackend) Add(folder string, msg Email) uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid := m.folder(folder).add(msg)
+	close(m.arrived)
+	m.arrived = make(chan struct{})
+	return uid
+}
+
+// Messages returns the messages in folder, in UID order
+func (m *MemoryBackend) Messages(folder string) []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.folders[folder]
+	if !ok {
+		return nil
+	}
+	messages := make([]Email, len(f.messages))
+	for i, msg := range f.messages {
+		messages[i] = cloneEmail(msg)
+	}
+	return messages
+}
+
+// folder returns the folder with name, creating it
+func (m *MemoryBackend) folder(name string) *memoryFolder {
+	f, ok := m.folders[name]
+	if !ok {
+		f = &memoryFolder{name: name, uidValidity: uint32(len(m.folders) + 1), uidNext: 1}
+		m.folders[name] = f
+	}
+	return f
+}
+
+// add appends a copy of msg with the next UID
+func (f *memoryFolder) add(msg Email) uint32 {
+	msg = cloneEmail(msg)
+	msg.UID = f.uidNext
+	msg.ID = fmt.Sprint(msg.UID)
+	msg.Mailbox = f.name
+	if msg.Flags == nil {
+		msg.Flags = []string{}
+	}
+	f.messages = append(f.messages, msg)
+	f.uidNext++
+	return msg.UID
+}
+
+// cloneEmail copies a message's slices, so callers can't change the store
+func cloneEmail(msg Email) Email {
+	msg.Flags = slices.Clone(msg.Flags)
+	msg.Labels = slices.Clone(msg.Labels)
+	msg.Attachments = slices.Clone(msg.Attachments)
+	msg.References = slices.Clone(msg.References)
+	return msg
+}
+
+// Open makes an existing folder the open one
+func (m *MemoryBackend) Open(folder string, readOnly bool) (*Folder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.folders[folder]
+	if !ok {
+		return nil, fmt.Errorf("failed to select %s: no such folder", folder)
+	}
+	m.open = f
+	return &Folder{Name: f.name, Messages: uint32(len(f.messages)), UIDValidity: f.uidValidity}, nil
+}
+
+// Search matches every message locally, then sorts and pages them
+func (m *MemoryBackend) Search(intent *Intent) ([]Email, int, error) {
+	matched, err := m.Matches(intent)
+	if err != nil {
+		return nil, 0, err
+	}
+	sortMessages(matched, intent)
+	return pageOf(matched, intent, DefaultPageSize), len(matched), nil
+}
+
+// Matches returns the open folder's messages that match the intent
+func (m *MemoryBackend) Matches(intent *Intent) ([]Email, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.open == nil {
+		return nil, fmt.Errorf("no folder open")
+	}
+	var matched []Email
+	for _, msg := range m.open.messages {
+		if matchesIntent(msg, intent) {
+			matched = append(matched, cloneEmail(msg))
+		}
+	}
+	return matched, nil
+}
+
+// Fetch returns a message of the open folder
+func (m *MemoryBackend) Fetch(uid uint32) (*Email, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if msg := m.find(uid); msg != nil {
+		found := cloneEmail(*msg)
+		return &found, nil
+	}
+	return nil, fmt.Errorf("no message with UID %d: %w", uid, ErrNotFound)
+}
+
+// find returns the open folder's message with uid, or nil
+func (m *MemoryBackend) find(uid uint32) *Email {
+	if m.open == nil {
+		return nil
+	}
+	for i := range m.open.messages {
+		if m.open.messages[i].UID == uid {
+			return &m.open.messages[i]
+		}
+	}
+	return nil
+}
+
+// FindMessageID returns the UIDs in the open folder with a Message-ID
+func (m *MemoryBackend) FindMessageID(id string) ([]uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.open == nil {
+		return nil, fmt.Errorf("no folder open")
+	}
+	var uids []uint32
+	for _, msg := range m.open.messages {
+		if normalizeMessageID(msg.MessageID) == normalizeMessageID(id) {
+			uids = append(uids, msg.UID)
+		}
+	}
+	return uids, nil
+}
+
+// Store adds or removes a flag on messages of the open folder
+func (m *MemoryBackend) Store(uids []uint32, flag string, add bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, uid := range uids {
+		msg := m.find(uid)
+		if msg == nil {
+			continue
+		}
+		msg.Flags = slices.DeleteFunc(msg.Flags, func(f string) bool { return strings.EqualFold(f, flag) })
+		if add {
+			msg.Flags = append(msg.Flags, flag)
+		}
+	}
+	return nil
+}
+
+// Label adds or removes a label, when labels are on
+func (m *MemoryBackend) Label(uids []uint32, label string, add bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.labels {
+		return errNoLabels
+	}
+	for _, uid := range uids {
+		msg := m.find(uid)
+		if msg == nil {
+			continue
+		}
+		msg.Labels = slices.DeleteFunc(msg.Labels, func(l string) bool { return l == label })
+		if add {
+			msg.Labels = append(msg.Labels, label)
+		}
+	}
+	return nil
+}
+
+// Copy copies messages into an existing folder and reports their UIDs
+func (m *MemoryBackend) Copy(uids []uint32, dest string) (*Copied, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.copy(uids, dest)
+}
+
+func (m *MemoryBackend) copy(uids []uint32, dest string) (*Copied, error) {
+	to, ok := m.folders[dest]
+	if !ok {
+		return nil, fmt.Errorf("[TRYCREATE] no folder %s", dest)
+	}
+	copied := &Copied{UIDValidity: to.uidValidity, UIDs: make(map[uint32]uint32)}
+	for _, uid := range uids {
+		if msg := m.find(uid); msg != nil {
+			copied.UIDs[uid] = to.add(*msg)
+		}
+	}
+	return copied, nil
+}
+
+// Move copies messages into an existing folder and removes the originals
+func (m *MemoryBackend) Move(uids []uint32, dest string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.copy(uids, dest); err != nil {
+		return err
+	}
+	m.remove(uids)
+	return nil
+}
+
+// Delete removes messages from the open folder
+func (m *MemoryBackend) Delete(uids []uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(uids)
+	return nil
+}
+
+func (m *MemoryBackend) remove(uids []uint32) {
+	if m.open == nil {
+		return
+	}
+	m.open.messages = slices.DeleteFunc(m.open.messages, func(msg Email) bool {
+		return slices.Contains(uids, msg.UID)
+	})
+}
+
+// Session returns a SessionFunc whose executors all work on the store and
+// record to journal, discarding their output
+func (m *MemoryBackend) Session(journal *Journal) SessionFunc {
+	return func() (*Executor, func(), error) {
+		e := NewExecutor(nil)
+		e.SetBackend(m)
+		e.SetJournal(journal)
+		e.SetOutput(io.Discard)
+		return e, func() {}, nil
+	}
+}
+
+// Watching reports whether a Watch is running, so tests can deliver
+// messages once a listener will see them
+func (m *MemoryBackend) Watching() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.watchers > 0
+}
+
+// Watch calls found with the messages added to folder after it starts
+func (m *MemoryBackend) Watch(ctx context.Context, folder string, found func([]Email)) error {
+	m.mu.Lock()
+	f, ok := m.folders[folder]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to select %s: no such folder", folder)
+	}
+	lastUID := f.uidNext - 1
+	m.watchers++
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.watchers--
+		m.mu.Unlock()
+	}()
+
+	for {
+		m.mu.Lock()
+		arrived := m.arrived
+		var batch []Email
+		for _, msg := range f.messages {
+			if msg.UID > lastUID {
+				batch = append(batch, cloneEmail(msg))
+				lastUID = msg.UID
+			}
+		}
+		m.mu.Unlock()
+
+		if len(batch) > 0 {
+			found(batch)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-arrived:
+		}
+	}
+}
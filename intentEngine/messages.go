@@ -0,0 +1,36 @@
+package intentengine
+
+import (
+	"fmt"
+)
+
+// Message fetches one message, body included, by its UID in mailbox.
+// The mailbox is opened read-only, so the message stays unread.
+func (e *Executor) Message(mailbox string, uid uint32) (*Email, error) {
+	if e.backend == nil {
+		return nil, fmt.Errorf("fetching messages requires a mail connection")
+	}
+	if _, err := e.backend.Open(mailbox, true); err != nil {
+		return nil, err
+	}
+	return e.backend.Fetch(uid)
+}
+
+// Named returns the search result a command such as "reply to 2" names,
+// or nil if it names none
+func (e *Executor) Named(intent *Intent) *Email {
+	switch intent.Command {
+	case CommandReply, CommandAttachments, CommandSaveAttachments:
+		if intent.Template == "" && intent.Result >= 1 && intent.Result <= len(e.lastResults) {
+			msg := e.lastResults[intent.Result-1]
+			return &msg
+		}
+	}
+	return nil
+}
+
+// SetListenHook sets a function called with each new message a listener
+// matches, for front ends that stream them
+func (e *Executor) SetListenHook(fn func(Email)) {
+	e.onMatch = fn
+}
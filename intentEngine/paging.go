@@ -0,0 +1,295 @@
+package intentengine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PlantingTrees/intent/mailsync"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// pageBounds returns where the intent's page starts among all results and
+// how many results it holds, given the search's own default size
+func pageBounds(intent *Intent, defaultSize int) (offset, size int) {
+	size = intent.Limit
+	if size == 0 {
+		size = defaultSize
+	}
+	page := max(intent.Page, 1)
+	return (page - 1) * size, size
+}
+
+// pageOf returns the part of items on the intent's page
+func pageOf[T any](items []T, intent *Intent, defaultSize int) []T {
+	offset, size := pageBounds(intent, defaultSize)
+	if offset >= len(items) {
+		return nil
+	}
+	return items[offset:min(offset+size, len(items))]
+}
+
+// paginate sorts results that are already in memory and returns the page
+// the intent asks for
+func (e *Executor) paginate(intent *Intent, messages []Email) []Email {
+	sortMessages(messages, intent)
+	e.remember(intent, len(messages))
+	return pageOf(messages, intent, DefaultPageSize)
+}
+
+// sortMessages orders messages as the intent asks. Relevance keeps the
+// order the search ranked them in.
+func sortMessages(messages []Email, intent *Intent) {
+	switch intent.Sort {
+	case SortRelevance:
+		return
+	case SortSender:
+		sort.SliceStable(messages, func(i, j int) bool {
+			a, b := senderAddress(messages[i].From), senderAddress(messages[j].From)
+			if a != b {
+				return a < b
+			}
+			return messages[i].Date.After(messages[j].Date)
+		})
+	default:
+		sort.SliceStable(messages, func(i, j int) bool {
+			return messages[i].Date.After(messages[j].Date)
+		})
+	}
+}
+
+// senderAddress reduces "Name <address>" to the lowercased address
+func senderAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		from = strings.TrimSuffix(from[i+1:], ">")
+	}
+	return strings.ToLower(from)
+}
+
+// remember keeps a search and its result count, so next can page on
+func (e *Executor) remember(intent *Intent, total int) {
+	last := *intent
+	e.lastSearch = &last
+	e.lastTotal = total
+}
+
+// printPage says which results the page shows, and how to see more
+func (e *Executor) printPage(intent *Intent, shown int, defaultSize int) {
+	if e.lastTotal == 0 {
+		return
+	}
+	offset, size := pageBounds(intent, defaultSize)
+	if offset == 0 && shown >= e.lastTotal {
+		return
+	}
+	if shown == 0 {
+		fmt.Fprintf(e.out, "Page %d is past the last of %d results.\n", max(intent.Page, 1), e.lastTotal)
+		return
+	}
+	fmt.Fprintf(e.out, "Showing %d-%d of %d.", offset+1, offset+shown, e.lastTotal)
+	if offset+size < e.lastTotal {
+		fmt.Fprint(e.out, " Type 'next' for more.")
+	}
+	fmt.Fprintln(e.out)
+}
+
+// executeNext shows the page after the last one shown
+func (e *Executor) executeNext(intent *Intent) (*Result, error) {
+	next := *e.lastSearch
+	next.Page = max(next.Page, 1) + 1
+	return e.Execute(&next)
+}
+
+// sortedSearch returns the sequence numbers of the messages matching
+// criteria in the intent's order, using the server's SORT extension when
+// it has one. Without it, dates follow arrival order, and sender and
+// relevance are worked out from envelopes, so bodies are only fetched for
+// the page shown.
+func (b *imapBackend) sortedSearch(intent *Intent, criteria *imap.SearchCriteria) ([]uint32, error) {
+	keys := map[SortOrder][]string{
+		"":         {"REVERSE", "ARRIVAL"},
+		SortDate:   {"REVERSE", "ARRIVAL"},
+		SortSender: {"FROM", "REVERSE", "ARRIVAL"},
+	}[intent.Sort]
+	if ok, _ := b.c.Support("SORT"); ok && keys != nil {
+		return b.serverSort(keys, criteria)
+	}
+
+	ids, err := b.search(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Sort == SortSender || (intent.Sort == SortRelevance && len(intent.Keywords) > 0) {
+		return b.sortByEnvelope(ids, intent)
+	}
+	// Sequence numbers ascend with arrival
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids, nil
+}
+
+// search runs SEARCH, as ESEARCH when the server has it, so a large result
+// comes back as ranges instead of one number per message
+func (b *imapBackend) search(criteria *imap.SearchCriteria) ([]uint32, error) {
+	if ok, _ := b.c.Support("ESEARCH"); !ok {
+		return b.c.Search(criteria)
+	}
+
+	args := []interface{}{imap.RawString("RETURN"), []interface{}{imap.RawString("ALL")},
+		imap.RawString("CHARSET"), imap.RawString("UTF-8")}
+	res := &idsResponse{name: "ESEARCH"}
+	status, err := b.c.Execute(&mailsync.RawCommand{Name: "SEARCH", Args: append(args, criteria.Format()...)}, res)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		// Retry as a plain search, which also falls back on the charset
+		return b.c.Search(criteria)
+	}
+	return res.ids, nil
+}
+
+// serverSort runs SORT (RFC 5256) with the given sort keys
+func (b *imapBackend) serverSort(keys []string, criteria *imap.SearchCriteria) ([]uint32, error) {
+	var list []interface{}
+	for _, key := range keys {
+		list = append(list, imap.RawString(key))
+	}
+
+	args := append([]interface{}{list, imap.RawString("UTF-8")}, criteria.Format()...)
+	res := &idsResponse{name: "SORT"}
+	status, err := b.c.Execute(&mailsync.RawCommand{Name: "SORT", Args: args}, res)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sort failed: %w", err)
+	}
+	return res.ids, nil
+}
+
+// sortByEnvelope orders messages by sender, or by how many keywords their
+// subject holds, from their envelopes alone
+func (b *imapBackend) sortByEnvelope(ids []uint32, intent *Intent) ([]uint32, error) {
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	set := new(imap.SeqSet)
+	set.AddNum(ids...)
+
+	messages := make(chan *imap.Message, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.c.Fetch(set, []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate}, messages)
+	}()
+
+	var envelopes []Email
+	for msg := range messages {
+		email := Email{ID: strconv.FormatUint(uint64(msg.SeqNum), 10), Date: msg.InternalDate}
+		if msg.Envelope != nil {
+			email.Subject = msg.Envelope.Subject
+			if len(msg.Envelope.From) > 0 {
+				email.From = msg.Envelope.From[0].Address()
+			}
+		}
+		envelopes = append(envelopes, email)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+
+	if intent.Sort == SortRelevance {
+		score := func(m Email) int {
+			subject := strings.ToLower(m.Subject)
+			n := 0
+			for _, keyword := range intent.Keywords {
+				if strings.Contains(subject, strings.ToLower(keyword)) {
+					n++
+				}
+			}
+			return n
+		}
+		sort.SliceStable(envelopes, func(i, j int) bool {
+			if a, b := score(envelopes[i]), score(envelopes[j]); a != b {
+				return a > b
+			}
+			return envelopes[i].Date.After(envelopes[j].Date)
+		})
+	} else {
+		sortMessages(envelopes, intent)
+	}
+
+	sorted := make([]uint32, len(envelopes))
+	for i, m := range envelopes {
+		n, _ := strconv.ParseUint(m.ID, 10, 32)
+		sorted[i] = uint32(n)
+	}
+	return sorted, nil
+}
+
+// inOrder puts fetched messages back in the order of seqNums, which FETCH
+// doesn't keep
+func inOrder(messages []Email, seqNums []uint32) []Email {
+	bySeq := make(map[string]Email, len(messages))
+	for _, msg := range messages {
+		bySeq[msg.ID] = msg
+	}
+	ordered := make([]Email, 0, len(messages))
+	for _, n := range seqNums {
+		if msg, ok := bySeq[strconv.FormatUint(uint64(n), 10)]; ok {
+			ordered = append(ordered, msg)
+		}
+	}
+	return ordered
+}
+
+// idsResponse reads the message numbers of a SORT response, or the ALL
+// set of an ESEARCH response (RFC 4731)
+type idsResponse struct {
+	name string
+	ids  []uint32
+}
+
+func (r *idsResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != r.name {
+		return responses.ErrUnhandled
+	}
+
+	if r.name == "SORT" {
+		for _, f := range fields {
+			id, err := imap.ParseNumber(f)
+			if err != nil {
+				return err
+			}
+			r.ids = append(r.ids, id)
+		}
+		return nil
+	}
+
+	// ESEARCH: an optional (TAG "x"), an optional UID, then name-value pairs
+	for i := 0; i < len(fields)-1; i++ {
+		key, err := imap.ParseString(fields[i])
+		if err != nil || !strings.EqualFold(key, "ALL") {
+			continue
+		}
+		value, err := imap.ParseString(fields[i+1])
+		if err != nil {
+			return err
+		}
+		set, err := imap.ParseSeqSet(value)
+		if err != nil {
+			return err
+		}
+		for _, seq := range set.Set {
+			for n := seq.Start; n <= seq.Stop; n++ {
+				r.ids = append(r.ids, n)
+			}
+		}
+	}
+	return nil
+}
@@ -2,200 +2,690 @@ package intentengine
 
 import (
 	"fmt"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/PlantingTrees/intent/schedule"
 )
 
 // Parser handles parsing of user commands
 type Parser struct {
-	commandPattern *regexp.Regexp
+	verbPattern     *regexp.Regexp
+	keywordPattern  *regexp.Regexp
+	senderPattern   *regexp.Regexp
+	datePattern     *regexp.Regexp
+	dryRunPattern   *regexp.Regexp
+	draftPattern    *regexp.Regexp
+	respondPattern  *regexp.Regexp
+	aboutPattern    *regexp.Regexp
+	archivePattern  *regexp.Regexp
+	folderPattern   *regexp.Regexp
+	savePattern     *regexp.Regexp
+	definePattern   *regexp.Regexp
+	macroPattern    *regexp.Regexp
+	schedulePattern *regexp.Regexp
+	limitPattern    *regexp.Regexp
+	sortPattern     *regexp.Regexp
+	pagePattern     *regexp.Regexp
+	hasPattern      *regexp.Regexp
+	filenamePattern *regexp.Regexp
+	largerPattern   *regexp.Regexp
+	toPattern       *regexp.Regexp
+
+	now    func() time.Time // Clock for relative dates
+	macros *Macros          // Saved commands, expanded before parsing
 }
 
 // NewParser creates a new parser instance
 func NewParser() *Parser {
-	// Pattern to match: CMD (for|on) "keywords" FROM "sender" [date]
+	// Pattern to match: CMD [(for|on) "keywords"] FROM "sender" [date] [--dry-run]
 	// Examples:
 	// - search for "updates" from "noreply"
 	// - listen from "*@exonMobileHr.com"
+	// - listen from "*@school.edu" respond with "ack-template"
 	// - search for "invite" from "hr@company.com" [recent]
 	// - search on "assessment" from "noreply" [2024-01-01 to 2024-01-31]
+	// - search about "job rejection" [last 30 days]
+	// - search for "offer" from "*@company.com" in archive "~/takeout/All mail.mbox"
+	// - archive from "*@newsletter.com" [older than 30 days]
+	// - move to "Receipts" from "billing@shop.com" --dry-run
+	// - undo 3
+	// - sync
+	// - folders
+	// - expand 2
+	// - search from "*@recruiters.com" sort by sender limit 20 page 2
+	// - next
+	// - search from "*@acme.com" has:attachment filename:"*.pdf" larger than 1MB
+	// - attachments 2
+	// - save attachments 2 to "~/Offers"
+	// - export from "*@acme.com" [last year] to "acme.mbox"
+	// - export for "invoice" has:attachment to "~/Invoices/"
+	// - search for "invoice" from "billing@shop.com" in all
+	// - search for "flight" from "*@airline.com" in "Travel"
+	// - reply to 2 "Thanks, see you Monday" --draft
+	// - reply with "decline-politely" to search for "opportunity" from "*@recruiters.com" [last 7 days]
+	// - save "jobs" as search for "interview, assessment" from "*@recruiters.com" [last 7 days]
+	// - define from-co $co = search from "*@$co.com" [recent]
+	// - run jobs
+	// - from-co acme
+	// - every weekday at 08:00 run jobs notify file:~/digest.md
 
 	return &Parser{
-		commandPattern: regexp.MustCompile(`(?i)^\s*(search|listen)\s+(?:for|on)?\s*"([^"]+)"\s+from\s+"([^"]+)"(?:\s+\[([^\]]+)\])?\s*$`),
+		verbPattern:     regexp.MustCompile(`(?i)^\s*(search|listen|archive|trash|star|unstar|mark\s+read|mark\s+unread|label\s+"([^"]+)"|move\s+to\s+"([^"]+)"|undo(?:\s+(\d+))?|reply\s+(?:to\s+)?(\d+)\s+"([^"]*)"|reply\s+with\s+"([^"]+)"\s+to\s+search|sync|folders|expand\s+(\d+)|next|attachments\s+(\d+)|save\s+attachments\s+(\d+)\s+to\s+(?:"([^"]+)"|([^"\s]+))|export(?:\s+search\b)?)`),
+		keywordPattern:  regexp.MustCompile(`(?i)^\s+(?:(?:for|on)\s+)?"([^"]+)"`),
+		senderPattern:   regexp.MustCompile(`(?i)^\s+from\s+"([^"]+)"`),
+		datePattern:     regexp.MustCompile(`^\s+\[([^\]]+)\]`),
+		dryRunPattern:   regexp.MustCompile(`(?i)^\s+--dry-run`),
+		draftPattern:    regexp.MustCompile(`(?i)^\s+--draft`),
+		respondPattern:  regexp.MustCompile(`(?i)^\s+respond\s+with\s+"([^"]+)"`),
+		aboutPattern:    regexp.MustCompile(`(?i)^\s+about\s+"([^"]+)"`),
+		archivePattern:  regexp.MustCompile(`(?i)^\s+in\s+archive\s+"([^"]+)"`),
+		folderPattern:   regexp.MustCompile(`(?i)^\s+in\s+(?:"([^"]+)"|(all)\b)`),
+		savePattern:     regexp.MustCompile(`(?i)^save\s+"([^"]+)"\s+as\s+`),
+		definePattern:   regexp.MustCompile(`(?i)^define\s+(\S+)((?:\s+\$\w+)*)\s*=\s*`),
+		macroPattern:    regexp.MustCompile(`(?i)^(?:(run)\s+)?([a-z][a-z0-9_-]*)((?:\s+(?:"[^"]*"|[^\s"]+))*)$`),
+		schedulePattern: regexp.MustCompile(`(?i)^(?:(every\s+.+?)|cron\s+"([^"]+)")\s+run\s+(.+?)(?:\s+notify\s+(?:"([^"]+)"|(\S+)))?$`),
+		limitPattern:    regexp.MustCompile(`(?i)^\s+limit\s+(\d+)\b`),
+		sortPattern:     regexp.MustCompile(`(?i)^\s+sort\s+by\s+(date|sender|relevance)\b`),
+		pagePattern:     regexp.MustCompile(`(?i)^\s+page\s+(\d+)\b`),
+		hasPattern:      regexp.MustCompile(`(?i)^\s+has:attachments?\b`),
+		filenamePattern: regexp.MustCompile(`(?i)^\s+filename:(?:"([^"]+)"|([^\s"]+))`),
+		toPattern:       regexp.MustCompile(`(?i)^\s+to\s+(?:"([^"]+)"|([^\s"]+))`),
+		largerPattern:   regexp.MustCompile(`(?i)^\s+larger\s+than\s+(\d+)(?:\s*([kmg]b?|b))?\b`),
+		now:             time.Now,
 	}
 }
 
-// Parse parses a user command string into an Intent
+// Parse parses a user command string into an Intent. Failures are
+// returned as a *ParseError.
 func (p *Parser) Parse(input string) (*Intent, error) {
+	intent, err := p.parse(input)
+	if err != nil {
+		if pe, ok := err.(*ParseError); ok {
+			p.suggest(pe)
+		}
+		return nil, err
+	}
+	return intent, nil
+}
+
+// SetMacros lets commands run saved macros by name
+func (p *Parser) SetMacros(macros *Macros) {
+	p.macros = macros
+}
+
+// parse does the parsing for Parse, without looking for suggestions. Macro
+// definitions and calls are handled here; commands go to parseCommand.
+func (p *Parser) parse(input string) (*Intent, error) {
 	input = strings.TrimSpace(input)
 
-	if input == "" {
-		return nil, fmt.Errorf("empty command")
+	// save "name" as <command>: stored in canonical form
+	if m := p.savePattern.FindStringSubmatch(input); m != nil {
+		saved, err := p.parseCommand(input[len(m[0]):])
+		if err != nil {
+			return nil, within(err, input, len(m[0]))
+		}
+		intent := NewIntent(CommandSave)
+		intent.SetTarget(strings.ToLower(m[1]))
+		intent.Text = saved.String()
+		if err := checkName(input, m[1]); err != nil {
+			return nil, err
+		}
+		return intent, nil
+	}
+
+	// define name $param... = <command>: checked with placeholder arguments
+	if m := p.definePattern.FindStringSubmatch(input); m != nil {
+		intent := NewIntent(CommandDefine)
+		intent.SetTarget(strings.ToLower(m[1]))
+		intent.Text = input[len(m[0]):]
+		for _, param := range strings.Fields(m[2]) {
+			intent.Params = append(intent.Params, strings.TrimPrefix(param, "$"))
+		}
+
+		args := make([]string, len(intent.Params))
+		for i := range args {
+			args[i] = "x"
+		}
+		query, err := Macro{Params: intent.Params, Query: intent.Text}.Expand(args)
+		if err == nil {
+			_, err = p.parseCommand(query)
+		}
+		if err != nil {
+			return nil, within(err, input, len(m[0]))
+		}
+		if err := checkName(input, m[1]); err != nil {
+			return nil, err
+		}
+		return intent, nil
+	}
+
+	// every <schedule> run <command> [notify <target>]
+	if m := p.schedulePattern.FindStringSubmatch(input); m != nil {
+		intent := NewIntent(CommandSchedule)
+		intent.SetTarget(strings.TrimSpace(m[1] + m[2]))
+		intent.Text = m[3]
+		intent.Notify = m[4] + m[5]
+
+		if _, err := schedule.Parse(intent.Target); err != nil {
+			return nil, &ParseError{Input: input, Offset: strings.Index(input, intent.Target), Message: err.Error()}
+		}
+		scheduled, err := p.parse(intent.Text)
+		if err != nil {
+			return nil, within(err, input, strings.LastIndex(input, intent.Text))
+		}
+		if scheduled.Command == CommandSave || scheduled.Command == CommandDefine || scheduled.Command == CommandSchedule {
+			return nil, &ParseError{Input: input, Offset: strings.LastIndex(input, intent.Text), Message: fmt.Sprintf("%s can't be scheduled", scheduled.Command)}
+		}
+		return intent, nil
 	}
 
-	// Try full pattern match first
-	matches := p.commandPattern.FindStringSubmatch(input)
-	if matches != nil {
-		return p.parseFullCommand(matches)
+	// run name [args...], or just name [args...]
+	if m := p.macroPattern.FindStringSubmatch(input); m != nil {
+		macro, ok := p.macros.Get(m[2])
+		if ok {
+			var args []string
+			for _, arg := range macroArgPattern.FindAllString(m[3], -1) {
+				args = append(args, strings.Trim(arg, `"`))
+			}
+			query, err := macro.Expand(args)
+			if err != nil {
+				return nil, &ParseError{Input: input, Offset: len(input) - len(m[3]), Message: err.Error(), Expected: macro.Params}
+			}
+			return p.parseCommand(query)
+		}
+		if m[1] != "" {
+			offset := len(input) - len(m[2]) - len(m[3])
+			return nil, &ParseError{Input: input, Offset: offset, Message: fmt.Sprintf("no macro named %q", m[2]), Expected: p.macros.Names()}
+		}
 	}
 
-	// Try simpler patterns
-	return p.parseSimpleCommand(input)
+	return p.parseCommand(input)
 }
 
-// parseFullCommand parses a command matching the full pattern
-func (p *Parser) parseFullCommand(matches []string) (*Intent, error) {
-	if len(matches) < 4 {
-		return nil, fmt.Errorf("invalid command format")
+// sizeUnits are the multipliers of the units larger than takes, by their
+// first letter
+var sizeUnits = map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+// macroArgPattern splits macro arguments into words and quoted strings
+var macroArgPattern = regexp.MustCompile(`"[^"]*"|[^\s"]+`)
+
+// within moves a parse error in the command part of a save or define to
+// its place in the whole input
+func within(err error, input string, offset int) error {
+	pe, ok := err.(*ParseError)
+	if !ok {
+		return err
 	}
+	return &ParseError{Input: input, Offset: offset + pe.Offset, Message: pe.Message, Expected: pe.Expected}
+}
 
-	// Extract command type
-	cmdStr := strings.ToLower(matches[1])
-	var cmd CommandType
-	switch cmdStr {
-	case "search":
-		cmd = CommandSearch
-	case "listen":
-		cmd = CommandListen
-	default:
-		return nil, fmt.Errorf("unknown command: %s", cmdStr)
+// checkName reports an invalid macro name as a parse error
+func checkName(input, name string) error {
+	if err := checkMacroName(strings.ToLower(name)); err != nil {
+		return &ParseError{Input: input, Offset: strings.Index(input, name), Message: err.Error()}
 	}
+	return nil
+}
 
-	intent := NewIntent(cmd)
+// parseCommand parses a single command
+func (p *Parser) parseCommand(input string) (*Intent, error) {
+	input = strings.TrimSpace(input)
 
-	// Extract keywords
-	keywords := matches[2]
-	if keywords != "" {
-		// Split by common delimiters
-		parts := strings.FieldsFunc(keywords, func(r rune) bool {
-			return r == ',' || r == '|' || r == '&'
-		})
-		for _, part := range parts {
-			trimmed := strings.TrimSpace(part)
-			if trimmed != "" {
-				intent.AddKeyword(trimmed)
-			}
-		}
+	fail := func(offset int, expected []string, format string, args ...interface{}) (*Intent, error) {
+		return nil, &ParseError{Input: input, Offset: offset, Message: fmt.Sprintf(format, args...), Expected: expected}
+	}
+
+	if input == "" {
+		return fail(0, verbTokens, "empty command")
+	}
+
+	matches := p.verbPattern.FindStringSubmatch(input)
+	if matches == nil {
+		return fail(0, verbTokens, "unknown command %q", leadingWord(input))
+	}
+
+	intent, err := p.parseVerb(matches)
+	if err != nil {
+		return fail(0, verbTokens, "%v", err)
 	}
 
-	// Extract sender
-	sender := strings.TrimSpace(matches[3])
-	if sender != "" {
-		// Check if it's a wildcard (all emails from sender)
-		allFromSender := strings.HasPrefix(sender, "*@") || strings.HasPrefix(sender, "*")
-		if allFromSender {
-			sender = strings.TrimPrefix(sender, "*")
-			sender = strings.TrimPrefix(sender, "@")
+	// Consume the optional clauses that follow the verb, remembering where
+	// each one started for later errors
+	rest := input[len(matches[0]):]
+	at := func() int {
+		return len(input) - len(strings.TrimLeft(rest, " \t"))
+	}
+	if rest != "" {
+		switch intent.Command {
+		case CommandUndo:
+			return fail(at(), nil, "undo takes an optional journal ID only")
+		case CommandSync, CommandFolders, CommandNext:
+			return fail(at(), nil, "%s takes no arguments", intent.Command)
+		case CommandExpand:
+			return fail(at(), nil, "expand takes a conversation number only")
+		case CommandAttachments, CommandSaveAttachments:
+			return fail(at(), nil, "%s takes a result number only", intent.Command)
 		}
-		intent.SetSender(sender, allFromSender)
 	}
 
-	// Extract date range if present
-	if len(matches) > 4 && matches[4] != "" {
-		dateStr := strings.TrimSpace(matches[4])
-		if err := p.parseDateRange(intent, dateStr); err != nil {
-			return nil, fmt.Errorf("invalid date range: %w", err)
+	clauses := make(map[string]int)
+	for rest != "" {
+		start := at()
+
+		if m := p.aboutPattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandSearch {
+				return fail(start, nil, "about is only supported by search")
+			}
+			intent.About = strings.TrimSpace(m[1])
+			clauses["about"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.keywordPattern.FindStringSubmatch(rest); m != nil {
+			p.parseKeywords(intent, m[1])
+			clauses["keywords"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.senderPattern.FindStringSubmatch(rest); m != nil {
+			p.parseSender(intent, m[1])
+			clauses["from"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.datePattern.FindStringSubmatch(rest); m != nil {
+			if err := p.parseDateRange(intent, strings.TrimSpace(m[1])); err != nil {
+				// Point inside the brackets
+				return fail(start+1, dateForms, "invalid date range: %v", err)
+			}
+			clauses["date"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.dryRunPattern.FindString(rest); m != "" {
+			intent.DryRun = true
+			clauses["dry-run"] = start
+			rest = rest[len(m):]
+			continue
+		}
+
+		if m := p.respondPattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandListen {
+				return fail(start, nil, "respond with is only supported by listen")
+			}
+			intent.Template = m[1]
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.archivePattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandSearch {
+				return fail(start, nil, "in archive is only supported by search")
+			}
+			intent.Archive = strings.TrimSpace(m[1])
+			clauses["archive"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.folderPattern.FindStringSubmatch(rest); m != nil {
+			if m[2] != "" {
+				if intent.Command != CommandSearch {
+					return fail(start, nil, "in all is only supported by search")
+				}
+				intent.AllFolders = true
+			} else {
+				intent.Mailbox = strings.TrimSpace(m[1])
+			}
+			clauses["folder"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.sortPattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandSearch {
+				return fail(start, nil, "sort by is only supported by search")
+			}
+			intent.Sort = SortOrder(strings.ToLower(m[1]))
+			clauses["sort"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.limitPattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandSearch {
+				return fail(start, nil, "limit is only supported by search")
+			}
+			if intent.Limit, _ = strconv.Atoi(m[1]); intent.Limit < 1 {
+				return fail(start+len(m[0])-len(m[1]), nil, "limit must be at least 1")
+			}
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.pagePattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command != CommandSearch {
+				return fail(start, nil, "page is only supported by search")
+			}
+			if intent.Page, _ = strconv.Atoi(m[1]); intent.Page < 1 {
+				return fail(start+len(m[0])-len(m[1]), nil, "pages start at 1")
+			}
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.hasPattern.FindString(rest); m != "" {
+			if intent.Command == CommandListen {
+				return fail(start, nil, "has:attachment is not supported by listen")
+			}
+			intent.HasAttachment = true
+			clauses["attachment"] = start
+			rest = rest[len(m):]
+			continue
+		}
+
+		if m := p.filenamePattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command == CommandListen {
+				return fail(start, nil, "filename: is not supported by listen")
+			}
+			intent.Filename = m[1] + m[2]
+			if _, err := path.Match(strings.ToLower(intent.Filename), ""); err != nil {
+				return fail(start+len(" filename:"), nil, "invalid filename pattern: %v", err)
+			}
+			clauses["attachment"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.largerPattern.FindStringSubmatch(rest); m != nil {
+			if intent.Command == CommandListen {
+				return fail(start, nil, "larger than is not supported by listen")
+			}
+			n, _ := strconv.ParseInt(m[1], 10, 64)
+			intent.LargerThan = n * sizeUnits[strings.TrimSuffix(strings.ToLower(m[2]), "b")]
+			if intent.LargerThan < 1 || intent.LargerThan >= 1<<32 {
+				return fail(start, nil, "larger than takes a size from 1B to 4GB, e.g. 5MB")
+			}
+			clauses["size"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.toPattern.FindStringSubmatch(rest); m != nil && intent.Command == CommandExport {
+			intent.SetTarget(m[1] + m[2])
+			if _, err := exportFormat(intent.Target); err != nil {
+				return fail(start+len(m[0])-len(intent.Target), nil, "%v", err)
+			}
+			clauses["to"] = start
+			rest = rest[len(m[0]):]
+			continue
+		}
+
+		if m := p.draftPattern.FindString(rest); m != "" {
+			intent.Draft = true
+			clauses["draft"] = start
+			rest = rest[len(m):]
+			continue
 		}
+
+		if strings.HasPrefix(strings.TrimSpace(rest), "[") {
+			return fail(start, []string{"]"}, "unclosed date range")
+		}
+		if strings.Count(rest, `"`)%2 != 0 {
+			return fail(start+strings.Index(input[start:], `"`), nil, "unclosed quote")
+		}
+		if word := leadingWord(strings.TrimSpace(rest)); word != "" {
+			return fail(start, clauseTokens, "unexpected %q", word)
+		}
+		return fail(start, clauseTokens, "unexpected input")
 	}
 
 	// Validate LISTEN command
-	if cmd == CommandListen && len(intent.Keywords) > 0 {
-		return nil, fmt.Errorf("LISTEN command does not support keywords, it only watches for emails from sender")
+	if intent.Command == CommandListen && len(intent.Keywords) > 0 {
+		return fail(clauses["keywords"], nil, "LISTEN command does not support keywords, it only watches for emails from sender")
+	}
+
+	if intent.Command == CommandExport && intent.Target == "" {
+		return fail(len(input), []string{`to "file.mbox"`}, "export needs a destination, e.g. to \"file.mbox\"")
+	}
+
+	if intent.DryRun && !intent.Command.IsAction() {
+		return fail(clauses["dry-run"], nil, "--dry-run is only supported by message actions")
+	}
+
+	if intent.Command == CommandReply && intent.Template == "" &&
+		(len(intent.Keywords) > 0 || intent.Sender != "" || intent.DateRange != nil || intent.Mailbox != "") {
+		return fail(len(matches[0]), []string{"--draft"}, "reply takes a result number, the reply text and an optional --draft")
+	}
+
+	if intent.About != "" && intent.Sort != "" && intent.Sort != SortRelevance {
+		return fail(clauses["sort"], nil, "search about is ranked by relevance and can't be sorted by %s", intent.Sort)
+	}
+
+	if intent.Archive != "" && (intent.HasAttachmentFilter() || intent.LargerThan > 0) {
+		return fail(clauses["archive"], nil, "attachment and size filters are not supported in archives")
+	}
+
+	if intent.Archive != "" && intent.About != "" {
+		return fail(clauses["archive"], nil, "search about is not supported in archives")
+	}
+
+	if intent.Archive != "" && intent.AllFolders {
+		return fail(clauses["archive"], nil, "in archive can't be combined with in all")
+	}
+
+	if intent.Mailbox != "" && intent.AllFolders {
+		return fail(clauses["folder"], nil, "use either in \"folder\" or in all")
+	}
+
+	if intent.AllFolders && intent.About != "" {
+		return fail(clauses["folder"], nil, "search about works on one folder at a time")
+	}
+
+	if intent.Draft && intent.Command != CommandReply {
+		return fail(clauses["draft"], nil, "--draft is only supported by reply")
 	}
 
 	return intent, nil
 }
 
-// parseSimpleCommand handles simpler command formats
-func (p *Parser) parseSimpleCommand(input string) (*Intent, error) {
-	// Handle: listen from "sender"
-	listenPattern := regexp.MustCompile(`(?i)^\s*listen\s+from\s+"([^"]+)"\s*$`)
-	if matches := listenPattern.FindStringSubmatch(input); matches != nil {
-		intent := NewIntent(CommandListen)
-		sender := strings.TrimSpace(matches[1])
-		allFromSender := strings.HasPrefix(sender, "*@") || strings.HasPrefix(sender, "*")
-		if allFromSender {
-			sender = strings.TrimPrefix(sender, "*")
-			sender = strings.TrimPrefix(sender, "@")
-		}
-		intent.SetSender(sender, allFromSender)
-		return intent, nil
+// Grammar describes the accepted commands
+const Grammar = `  SEARCH for "keywords" from "sender" [date_range] [in "folder"|in all] [in archive "path"]
+  SEARCH about "meaning" [from "sender"] [date_range]
+    ... [has:attachment] [filename:"*.pdf"] [larger than 5MB]
+    ... [sort by date|sender|relevance] [limit N] [page N]
+  LISTEN from "sender" [respond with "template"]
+  ARCHIVE|TRASH|STAR|MARK READ|LABEL "x"|MOVE TO "folder" from "sender" [date_range] [--dry-run]
+  UNDO [journal_id]
+  SYNC
+  FOLDERS
+  EXPAND <conversation_number>
+  NEXT
+  ATTACHMENTS <result_number>
+  SAVE ATTACHMENTS <result_number> TO "directory"
+  EXPORT for "keywords" from "sender" [date_range] [in "folder"] TO "file.mbox"|"dir/"|"report.md"|"report.html"
+  REPLY TO <result_number> "text" [--draft]
+  REPLY WITH "template" TO SEARCH for "keywords" from "sender" [date_range] [--draft]
+  SAVE "name" AS <command>
+  DEFINE name [$param ...] = <command using $param>
+  [RUN] name [arguments]
+  EVERY day|weekday|monday...|N minutes [at HH:MM] RUN <command> [NOTIFY stdout|file:path]
+  CRON "m h dom mon dow" RUN <command> [NOTIFY stdout|file:path]`
+
+// suggest fills in a corrected command when the word at the error looks
+// like a misspelled keyword or date word. Candidates that make the whole
+// command parse are preferred.
+func (p *Parser) suggest(pe *ParseError) {
+	input := pe.Input
+	if pe.Offset >= len(input) {
+		return
 	}
 
-	return nil, fmt.Errorf("unable to parse command. Expected format:\n" +
-		"  SEARCH for \"keywords\" from \"sender\" [date_range]\n" +
-		"  LISTEN from \"sender\"")
+	var vocab []string
+	switch {
+	case pe.Offset == 0:
+		vocab = append(p.macros.Names(), verbTokens...)
+	case strings.HasPrefix(pe.Message, "invalid date range"):
+		p.suggestDate(pe)
+		return
+	case pe.Expected != nil:
+		vocab = []string{"for", "on", "from", "about", "in", "respond"}
+	default:
+		return
+	}
+
+	word := leadingWord(input[pe.Offset:])
+	candidates := closest(word, vocab)
+	for _, c := range candidates {
+		fixed := input[:pe.Offset] + c + input[pe.Offset+len(word):]
+		if _, err := p.parse(fixed); err == nil {
+			pe.Suggestion = fixed
+			return
+		}
+	}
+	if len(candidates) > 0 {
+		pe.Suggestion = input[:pe.Offset] + candidates[0] + input[pe.Offset+len(word):]
+	}
 }
 
-// parseDateRange parses date range expressions
-func (p *Parser) parseDateRange(intent *Intent, dateStr string) error {
-	dateStr = strings.ToLower(strings.TrimSpace(dateStr))
-
-	// Handle "recent" shorthand
-	if dateStr == "recent" {
-		intent.SetRecentRange()
-		return nil
-	}
-
-	// Handle "today"
-	if dateStr == "today" {
-		now := time.Now()
-		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		end := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-		intent.SetDateRange(start, end)
-		return nil
-	}
-
-	// Handle "yesterday"
-	if dateStr == "yesterday" {
-		now := time.Now()
-		yesterday := now.AddDate(0, 0, -1)
-		start := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-		end := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 23, 59, 59, 0, yesterday.Location())
-		intent.SetDateRange(start, end)
-		return nil
-	}
-
-	// Handle "last N days"
-	lastDaysPattern := regexp.MustCompile(`last\s+(\d+)\s+days?`)
-	if matches := lastDaysPattern.FindStringSubmatch(dateStr); matches != nil {
-		days := 0
-		fmt.Sscanf(matches[1], "%d", &days)
-		now := time.Now()
-		start := now.AddDate(0, 0, -days)
-		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
-		end := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-		intent.SetDateRange(start, end)
-		return nil
-	}
-
-	// Handle range: "YYYY-MM-DD to YYYY-MM-DD"
-	rangePattern := regexp.MustCompile(`(\d{4}-\d{2}-\d{2})\s+to\s+(\d{4}-\d{2}-\d{2})`)
-	if matches := rangePattern.FindStringSubmatch(dateStr); matches != nil {
-		start, err := time.Parse("2006-01-02", matches[1])
-		if err != nil {
-			return fmt.Errorf("invalid start date: %w", err)
+// suggestDate corrects misspelled words inside a date range, e.g.
+// "[yesterdy]" or "[last 3 dyas]", when the result is a valid range
+func (p *Parser) suggestDate(pe *ParseError) {
+	input := pe.Input
+	end := strings.Index(input[pe.Offset:], "]")
+	if end < 0 {
+		return
+	}
+	expr := input[pe.Offset : pe.Offset+end]
+
+	words := strings.Fields(expr)
+	changed := false
+	for i, word := range words {
+		if strings.HasPrefix(strings.ToLower(word), "tz:") {
+			continue
 		}
-		end, err := time.Parse("2006-01-02", matches[2])
-		if err != nil {
-			return fmt.Errorf("invalid end date: %w", err)
+		if c := closest(word, dateWords); len(c) > 0 {
+			words[i] = c[0]
+			changed = true
 		}
-		// Set to end of end day
-		end = time.Date(end.Year(), end.Month(), end.Day(), 23, 59, 59, 0, end.Location())
-		intent.SetDateRange(start, end)
-		return nil
+	}
+	if !changed {
+		return
 	}
 
-	// Handle single date
-	if singleDate, err := time.Parse("2006-01-02", dateStr); err == nil {
-		start := time.Date(singleDate.Year(), singleDate.Month(), singleDate.Day(), 0, 0, 0, 0, singleDate.Location())
-		end := time.Date(singleDate.Year(), singleDate.Month(), singleDate.Day(), 23, 59, 59, 0, singleDate.Location())
-		intent.SetDateRange(start, end)
-		return nil
+	fixed := strings.Join(words, " ")
+	if _, _, err := resolveRange(strings.ToLower(fixed), p.now()); err == nil {
+		pe.Suggestion = input[:pe.Offset] + fixed + input[pe.Offset+end:]
 	}
+}
 
-	return fmt.Errorf("unrecognized date format: %s", dateStr)
+// parseVerb creates the intent for the leading command verb
+func (p *Parser) parseVerb(matches []string) (*Intent, error) {
+	verb := strings.Join(strings.Fields(strings.ToLower(matches[1])), " ")
+
+	switch {
+	case verb == "search":
+		return NewIntent(CommandSearch), nil
+	case verb == "listen":
+		return NewIntent(CommandListen), nil
+	case verb == "sync":
+		return NewIntent(CommandSync), nil
+	case verb == "folders":
+		return NewIntent(CommandFolders), nil
+	case verb == "archive":
+		return NewIntent(CommandArchive), nil
+	case verb == "trash":
+		return NewIntent(CommandTrash), nil
+	case verb == "star":
+		return NewIntent(CommandStar), nil
+	case verb == "unstar":
+		return NewIntent(CommandUnstar), nil
+	case verb == "mark read":
+		return NewIntent(CommandMarkRead), nil
+	case verb == "mark unread":
+		return NewIntent(CommandMarkUnread), nil
+	case strings.HasPrefix(verb, "label"):
+		intent := NewIntent(CommandLabel)
+		intent.SetTarget(matches[2])
+		return intent, nil
+	case strings.HasPrefix(verb, "move"):
+		intent := NewIntent(CommandMove)
+		intent.SetTarget(matches[3])
+		return intent, nil
+	case strings.HasPrefix(verb, "undo"):
+		intent := NewIntent(CommandUndo)
+		intent.SetTarget(matches[4])
+		return intent, nil
+	case verb == "next":
+		return NewIntent(CommandNext), nil
+	case strings.HasPrefix(verb, "export"):
+		return NewIntent(CommandExport), nil
+	case strings.HasPrefix(verb, "attachments"):
+		intent := NewIntent(CommandAttachments)
+		intent.Result, _ = strconv.Atoi(matches[9])
+		return intent, nil
+	case strings.HasPrefix(verb, "save attachments"):
+		intent := NewIntent(CommandSaveAttachments)
+		intent.Result, _ = strconv.Atoi(matches[10])
+		intent.SetTarget(matches[11] + matches[12])
+		return intent, nil
+	case strings.HasPrefix(verb, "expand"):
+		intent := NewIntent(CommandExpand)
+		intent.Result, _ = strconv.Atoi(matches[8])
+		return intent, nil
+	case strings.HasPrefix(verb, "reply with"):
+		intent := NewIntent(CommandReply)
+		intent.Template = matches[7]
+		return intent, nil
+	case strings.HasPrefix(verb, "reply"):
+		intent := NewIntent(CommandReply)
+		intent.Result, _ = strconv.Atoi(matches[5])
+		intent.Text = matches[6]
+		return intent, nil
+	default:
+		return nil, fmt.Errorf("unknown command: %s", verb)
+	}
+}
+
+// parseKeywords splits a keyword list by common delimiters
+func (p *Parser) parseKeywords(intent *Intent, keywords string) {
+	parts := strings.FieldsFunc(keywords, func(r rune) bool {
+		return r == ',' || r == '|' || r == '&'
+	})
+	for _, part := range parts {
+		trimmed := strings.TrimSpace(part)
+		if trimmed != "" {
+			intent.AddKeyword(trimmed)
+		}
+	}
+}
+
+// parseSender sets the sender filter, detecting wildcard senders
+func (p *Parser) parseSender(intent *Intent, sender string) {
+	sender = strings.TrimSpace(sender)
+	if sender == "" {
+		return
+	}
+
+	// Check if it's a wildcard (all emails from sender)
+	allFromSender := strings.HasPrefix(sender, "*@") || strings.HasPrefix(sender, "*")
+	if allFromSender {
+		sender = strings.TrimPrefix(sender, "*")
+		sender = strings.TrimPrefix(sender, "@")
+	}
+	// A bare "*" matches every sender, the same as no filter
+	if sender == "" {
+		return
+	}
+	intent.SetSender(sender, allFromSender)
 }
 
 // ParseExamples returns example commands for user reference
@@ -206,8 +696,35 @@ func ParseExamples() []string {
 		`search for "assessment" from "noreply" [yesterday]`,
 		`search for "updates" from "noreply" [last 7 days]`,
 		`search for "job" from "careers@company.com" [2024-01-01 to 2024-01-31]`,
+		`search for "standup" from "*@company.com" [since monday]`,
+		`search for "alert" from "monitoring@company.com" [last 3 hours tz:America/New_York]`,
+		`search for "statement" from "bank.com" [in march]`,
 		`listen from "hr@exonMobile.com"`,
 		`listen from "*@exonMobileHr.com"`,
+		`listen from "*@school.edu" respond with "ack-template"`,
 		`search for "interview, assessment" from "*@recruiters.com" [recent]`,
+		`search about "job rejection" [last 30 days]`,
+		`search for "offer" from "*@company.com" in archive "~/takeout/All mail.mbox"`,
+		`search for "invoice" from "billing@shop.com" in all`,
+		`folders`,
+		`expand 1`,
+		`search from "*@recruiters.com" sort by sender limit 20`,
+		`next`,
+		`search from "*@acme.com" has:attachment filename:"*.pdf"`,
+		`attachments 1`,
+		`save attachments 1 to "~/Downloads"`,
+		`export from "*@acme.com" [last year] to "acme.mbox"`,
+		`export for "invoice" has:attachment to "invoices.html"`,
+		`archive from "*@newsletter.com" [older than 30 days]`,
+		`label "Jobs" from "*@recruiters.com" --dry-run`,
+		`move to "Receipts" from "billing@shop.com"`,
+		`undo`,
+		`reply to 1 "Thanks, I'll be there" --draft`,
+		`reply with "decline-politely" to search for "opportunity" from "*@recruiters.com" [last 7 days]`,
+		`save "jobs" as search for "interview, assessment" from "*@recruiters.com" [last 7 days]`,
+		`define from-co $co = search from "*@$co.com" [recent]`,
+		`run jobs`,
+		`from-co acme`,
+		`every weekday at 08:00 run jobs notify file:~/digest.md`,
 	}
 }
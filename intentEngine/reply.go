@@ -0,0 +1,218 @@
+package intentengine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PlantingTrees/intent/responder"
+	"github.com/emersion/go-imap"
+)
+
+// templateDir holds the reply templates, one <name>.tmpl file each
+const templateDir = "templates"
+
+// autoReplyLog records every reply sent by a listener's auto-responder
+const autoReplyLog = "responses.jsonl"
+
+// executeReply replies to a message from the last search results, sending it
+// over SMTP or saving it to Drafts
+func (e *Executor) executeReply(intent *Intent) (*Result, error) {
+	if intent.Template != "" {
+		return e.executeTemplateReply(intent)
+	}
+
+	target := e.lastResults[intent.Result-1]
+
+	fmt.Fprintln(e.out, "\n=== Executing REPLY ===")
+	fmt.Fprintf(e.out, "Replying to [%d] %s: %s\n", intent.Result, target.From, target.Subject)
+
+	out, err := e.buildReply(target.Mailbox, target.UID, intent.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.deliver(intent.Draft, []outgoing{out})
+}
+
+// DraftReply saves a reply to the message with uid in mailbox to Drafts.
+// Nothing is sent, so there is no preview or confirmation.
+func (e *Executor) DraftReply(mailbox string, uid uint32, text string) error {
+	if e.imapClient == nil || e.responder == nil {
+		return fmt.Errorf("drafting replies requires IMAP and a responder")
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("reply text cannot be empty")
+	}
+
+	out, err := e.buildReply(mailbox, uid, text)
+	if err != nil {
+		return err
+	}
+	return e.responder.SaveDraft(e.imapClient, out.msg)
+}
+
+// buildReply builds a reply with the given body to a message in mailbox
+func (e *Executor) buildReply(mailbox string, uid uint32, text string) (outgoing, error) {
+	if _, err := e.imapClient.Select(mailbox, false); err != nil {
+		return outgoing{}, fmt.Errorf("failed to select %s: %w", mailbox, err)
+	}
+
+	raw, err := e.fetchRaw(uid)
+	if err != nil {
+		return outgoing{}, err
+	}
+
+	orig, err := responder.ParseOriginal(raw)
+	if err != nil {
+		return outgoing{}, err
+	}
+
+	msg, err := responder.BuildReply(e.responder.Account(), orig, text)
+	if err != nil {
+		return outgoing{}, err
+	}
+	return outgoing{rcpt: orig.From.Address, msg: msg}, nil
+}
+
+// executeTemplateReply renders a reply template for every message matching
+// the intent's search
+func (e *Executor) executeTemplateReply(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing REPLY WITH TEMPLATE ===")
+	fmt.Fprintln(e.out, "Template:", intent.Template)
+	fmt.Fprintln(e.out, "Keywords:", strings.Join(intent.Keywords, ", "))
+	fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	e.printDateRange(intent)
+
+	tmpl, err := responder.LoadTemplate(templateDir, intent.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := e.imapClient.Select(intent.Folder(), false); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", intent.Folder(), err)
+	}
+
+	uids, err := e.imapClient.UidSearch(buildSearchCriteria(intent))
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	// As with actions, keep the server's keyword match but re-check sender
+	// and date locally before mailing anyone. Envelopes are enough for
+	// that, so only the messages answered are downloaded.
+	local := *intent
+	local.Keywords = nil
+	candidates, err := fetchEnvelopes(e.imapClient, uids, intent.HasAttachmentFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []outgoing
+	for _, email := range candidates {
+		if !matchesIntent(email, &local) {
+			continue
+		}
+
+		raw, err := e.fetchRaw(email.UID)
+		if err != nil {
+			return nil, err
+		}
+		orig, err := responder.ParseOriginal(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := responder.Render(tmpl, responder.VarsFor(orig))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", email.Subject, err)
+		}
+
+		msg, err := responder.BuildReply(e.responder.Account(), orig, body)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, outgoing{rcpt: orig.From.Address, msg: msg})
+	}
+
+	fmt.Fprintf(e.out, "✓ Rendered %d replies\n", len(msgs))
+	if len(msgs) == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+		return &Result{Command: CommandReply}, nil
+	}
+
+	return e.deliver(intent.Draft, msgs)
+}
+
+// outgoing is a built reply and the address it goes to
+type outgoing struct {
+	rcpt string
+	msg  []byte
+}
+
+// deliver previews replies and, once confirmed, sends them or saves them
+// as drafts
+func (e *Executor) deliver(draft bool, msgs []outgoing) (*Result, error) {
+	verb := "Send"
+	if draft {
+		verb = "Save as draft"
+	}
+
+	for i, out := range msgs {
+		fmt.Fprintf(e.out, "\n--- Preview %d/%d ---\n", i+1, len(msgs))
+		fmt.Fprintln(e.out, string(bytes.ReplaceAll(out.msg, []byte("\r\n"), []byte("\n"))))
+	}
+
+	if e.confirm == nil || !e.confirm(fmt.Sprintf("%s %d message(s)?", verb, len(msgs))) {
+		fmt.Fprintln(e.out, "Cancelled.")
+		return &Result{Command: CommandReply, Draft: draft}, nil
+	}
+
+	for _, out := range msgs {
+		var err error
+		if draft {
+			err = e.responder.SaveDraft(e.imapClient, out.msg)
+		} else {
+			err = e.responder.Send([]string{out.rcpt}, out.msg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if draft {
+		fmt.Fprintf(e.out, "✓ Saved %d draft(s)\n", len(msgs))
+	} else {
+		fmt.Fprintf(e.out, "✓ Sent %d message(s)\n", len(msgs))
+	}
+
+	return &Result{Command: CommandReply, Count: len(msgs), Draft: draft}, nil
+}
+
+// fetchRaw fetches the full RFC 822 source of a message in the selected
+// mailbox without marking it as read
+func (e *Executor) fetchRaw(uid uint32) (io.Reader, error) {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- e.imapClient.UidFetch(set, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var body imap.Literal
+	for msg := range messages {
+		body = msg.GetBody(section)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	if body == nil {
+		return nil, fmt.Errorf("server returned no body for UID %d", uid)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,41 @@
+package intentengine
+
+import (
+	"github.com/PlantingTrees/intent/schedule"
+)
+
+// Result is what a command did. Each command fills in the fields that
+// apply to it.
+type Result struct {
+	Command CommandType `json:"command"`
+	Count   int         `json:"count"` // Matches before paging, or the messages, attachments, files or folders handled
+	DryRun  bool        `json:"dry_run,omitempty"`
+
+	// Messages shown, or matched by an action, in the order shown.
+	// Searches also group them into the conversations printed.
+	Messages []Email   `json:"messages,omitempty"`
+	Threads  []Thread  `json:"threads,omitempty"`
+	Scores   []float64 `json:"scores,omitempty"` // Relevance of each message, for searches by meaning
+
+	JournalID string `json:"journal_id,omitempty"` // Entry an action was recorded in, or the one undone
+	Recorded  int    `json:"recorded,omitempty"`   // Messages in the undone entry
+
+	Attachments []Attachment   `json:"attachments,omitempty"`
+	Files       []string       `json:"files,omitempty"` // Attachments saved
+	Path        string         `json:"path,omitempty"`  // Where an export was written
+	Format      string         `json:"format,omitempty"`
+	Folders     []FolderStatus `json:"folders,omitempty"`
+	Added       int            `json:"added,omitempty"` // Messages indexed and dropped by sync
+	Removed     int            `json:"removed,omitempty"`
+	Draft       bool           `json:"draft,omitempty"` // Replies were saved as drafts instead of sent
+
+	Macro *Macro        `json:"macro,omitempty"`
+	Job   *schedule.Job `json:"job,omitempty"`
+}
+
+// FolderStatus is a mailbox and its message counts
+type FolderStatus struct {
+	Name     string `json:"name"`
+	Messages uint32 `json:"messages"`
+	Unread   uint32 `json:"unread"`
+}
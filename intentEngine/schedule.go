@@ -0,0 +1,28 @@
+package intentengine
+
+import (
+	"fmt"
+
+	"github.com/PlantingTrees/intent/schedule"
+)
+
+// SetSchedule sets where scheduled commands are stored
+func (e *Executor) SetSchedule(s *schedule.Store) {
+	e.schedule = s
+}
+
+// executeSchedule adds a job for the scheduler to run
+func (e *Executor) executeSchedule(intent *Intent) (*Result, error) {
+	job, err := e.schedule.Add(schedule.Job{
+		Spec:   intent.Target,
+		Query:  intent.Text,
+		Notify: intent.Notify,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(e.out, "✓ Scheduled job %s: %s\n", job.ID, job)
+	fmt.Fprintln(e.out, "  Runs while 'intent schedule run -wait' is running, or from system cron with 'intent schedule run'")
+	return &Result{Command: intent.Command, Job: &job}, nil
+}
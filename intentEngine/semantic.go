@@ -0,0 +1,93 @@
+package intentengine
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/PlantingTrees/intent/semantic"
+)
+
+// Limits for SEARCH ABOUT: how many recent messages are ranked, how many
+// are shown, and how much of each body is embedded
+const (
+	semanticCandidates = 200
+	semanticResults    = 10
+	semanticTextLimit  = 2000
+)
+
+// executeSemanticSearch ranks the messages matching the intent's other
+// filters by similarity to its About query
+func (e *Executor) executeSemanticSearch(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing SEARCH ABOUT ===")
+	fmt.Fprintln(e.out, "About:", intent.About)
+	if intent.Sender != "" {
+		fmt.Fprintln(e.out, "Sender:", intent.Sender)
+	}
+	e.printDateRange(intent)
+
+	if _, err := e.imapClient.Select(intent.Folder(), false); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", intent.Folder(), err)
+	}
+
+	uids, err := e.imapClient.UidSearch(buildSearchCriteria(intent))
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	// UIDs ascend with arrival, so the newest candidates are at the end
+	if len(uids) > semanticCandidates {
+		uids = uids[len(uids)-semanticCandidates:]
+	}
+
+	fmt.Fprintf(e.out, "\nRanking %d messages with %s...\n", len(uids), e.embedder.Model())
+
+	var candidates []Email
+	for _, msg := range inRange(e.fetchMessages(uids, true), intent.DateRange) {
+		if matchesAttachments(msg, intent) {
+			candidates = append(candidates, msg)
+		}
+	}
+	docs := make([]semantic.Doc, len(candidates))
+	for i, msg := range candidates {
+		text := msg.Subject + "\n" + msg.Body
+		if len(text) > semanticTextLimit {
+			text = text[:semanticTextLimit]
+		}
+		docs[i] = semantic.Doc{ID: msg.MessageID, Text: text}
+	}
+
+	ranked, err := semantic.Rank(e.embedder, e.vectors, intent.About, docs)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.vectors.Save(); err != nil {
+		log.Printf("Vector cache error: %v", err)
+	}
+
+	e.remember(intent, len(ranked))
+	ranked = pageOf(ranked, intent, semanticResults)
+
+	messages := make([]Email, len(ranked))
+	for i, r := range ranked {
+		messages[i] = candidates[r.Index]
+	}
+	e.lastResults = messages
+
+	fmt.Fprintf(e.out, "✓ Top %d of %d messages\n\n", len(messages), len(candidates))
+	if len(messages) == 0 {
+		fmt.Fprintln(e.out, "No messages found matching your criteria.")
+	}
+
+	scores := make([]float64, len(messages))
+	for i, msg := range messages {
+		fmt.Fprintf(e.out, "[%d] (%.2f) From: %s\n", i+1, ranked[i].Score, msg.From)
+		fmt.Fprintf(e.out, "    Subject: %s\n", msg.Subject)
+		fmt.Fprintf(e.out, "    Date: %s\n", msg.Date.Format("2006-01-02 15:04:05"))
+		fmt.Fprintln(e.out)
+
+		scores[i] = float64(ranked[i].Score)
+	}
+	e.printPage(intent, len(messages), semanticResults)
+
+	return &Result{Command: CommandSearch, Count: len(messages), Messages: messages, Scores: scores}, nil
+}
@@ -0,0 +1,180 @@
+package intentengine
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/PlantingTrees/intent/index"
+	"github.com/emersion/go-imap"
+)
+
+// syncBatch is how many messages are fetched per round trip while syncing
+const syncBatch = 100
+
+// executeSync mirrors INBOX into the local index
+func (e *Executor) executeSync(intent *Intent) (*Result, error) {
+	fmt.Fprintln(e.out, "\n=== Executing SYNC ===")
+
+	added, removed, err := e.syncIndex(true)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(e.out, "✓ Index up to date: %d added, %d removed, %d messages total\n",
+		added, removed, len(e.index.UIDs()))
+
+	return &Result{Command: CommandSync, Added: added, Removed: removed}, nil
+}
+
+// syncIndex brings the index up to date with INBOX: it rebuilds it when
+// UIDVALIDITY changed, adds new messages, and drops expunged ones when
+// full is set
+func (e *Executor) syncIndex(full bool) (int, int, error) {
+	mbox, err := e.imapClient.Select("INBOX", false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select INBOX: %w", err)
+	}
+
+	if e.index.Mailbox != mbox.Name || e.index.UIDValidity != mbox.UidValidity {
+		if e.index.LastUID > 0 {
+			fmt.Fprintln(e.out, "Mailbox UIDVALIDITY changed, rebuilding index...")
+		}
+		e.index.Reset(mbox.Name, mbox.UidValidity)
+	}
+
+	added, err := e.indexNew(mbox)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	if full {
+		if removed, err = e.dropVanished(); err != nil {
+			return added, 0, err
+		}
+	}
+
+	if added > 0 || removed > 0 {
+		if err := e.index.Save(); err != nil {
+			return added, removed, err
+		}
+	}
+
+	return added, removed, nil
+}
+
+// dropVanished removes the messages that are no longer in the selected
+// mailbox from the index. Only UIDs are fetched to find them.
+func (e *Executor) dropVanished() (int, error) {
+	uids, err := e.imapClient.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return 0, fmt.Errorf("search failed: %w", err)
+	}
+	present := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		present[uid] = true
+	}
+
+	removed := 0
+	for _, uid := range e.index.UIDs() {
+		if !present[uid] {
+			e.index.Remove(uid)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// indexNew fetches and indexes every message above the index's last UID
+// in the selected mailbox
+func (e *Executor) indexNew(mbox *imap.MailboxStatus) (int, error) {
+	lastUID := e.index.LastUID
+	if mbox.UidNext <= lastUID+1 {
+		return 0, nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(lastUID+1, 0)
+
+	found, err := e.imapClient.UidSearch(criteria)
+	if err != nil {
+		return 0, fmt.Errorf("search failed: %w", err)
+	}
+
+	// "n:*" always includes the highest UID, even when it is below n
+	var uids []uint32
+	for _, uid := range found {
+		if uid > lastUID {
+			uids = append(uids, uid)
+		}
+	}
+
+	for start := 0; start < len(uids); start += syncBatch {
+		end := start + syncBatch
+		if end > len(uids) {
+			end = len(uids)
+		}
+		for _, msg := range e.fetchMessages(uids[start:end], true) {
+			e.index.Add(index.Document{
+				UID:       msg.UID,
+				MessageID: msg.MessageID,
+				From:      msg.From,
+				Subject:   msg.Subject,
+				Date:      msg.Date,
+				Body:      msg.Body,
+			})
+		}
+		if len(uids) > syncBatch {
+			fmt.Fprintf(e.out, "  indexed %d/%d\n", end, len(uids))
+		}
+	}
+
+	return len(uids), nil
+}
+
+// searchIndex answers a search from the local index, first indexing any
+// messages that arrived since the last sync and dropping those that are
+// gone. It reports false, for the server to answer, when the index can't
+// be brought up to date or the date range reaches back before it.
+func (e *Executor) searchIndex(intent *Intent, mbox *imap.MailboxStatus) ([]Email, bool) {
+	added, err := e.indexNew(mbox)
+	removed := 0
+	if err == nil {
+		removed, err = e.dropVanished()
+	}
+	if err != nil {
+		log.Printf("Index update error: %v", err)
+		return nil, false
+	}
+	if added > 0 || removed > 0 {
+		if err := e.index.Save(); err != nil {
+			log.Printf("Index save error: %v", err)
+		}
+	}
+
+	if r := intent.DateRange; r != nil && (r.Start.IsZero() || r.Start.Before(e.index.Oldest())) {
+		return nil, false
+	}
+
+	// Keywords are ranked by the index; sender and date are checked here
+	local := *intent
+	local.Keywords = nil
+	keep := func(m *index.Meta) bool {
+		return matchesIntent(Email{From: m.From, Subject: m.Subject, Date: m.Date}, &local)
+	}
+
+	var messages []Email
+	for _, hit := range e.index.Search(intent.Keywords, keep) {
+		messages = append(messages, Email{
+			ID:        fmt.Sprintf("%d", hit.UID),
+			UID:       hit.UID,
+			MessageID: hit.Meta.MessageID,
+			From:      hit.Meta.From,
+			Subject:   hit.Meta.Subject,
+			Date:      hit.Meta.Date,
+			Mailbox:   mbox.Name,
+		})
+	}
+	return messages, true
+}
@@ -0,0 +1,260 @@
+package intentengine
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// Thread is a conversation among search results, oldest message first
+type Thread struct {
+	Messages []Email
+}
+
+// Latest returns the thread's newest message
+func (t *Thread) Latest() Email {
+	return t.Messages[len(t.Messages)-1]
+}
+
+// Participants returns the thread's senders, in the order they joined
+func (t *Thread) Participants() []string {
+	var names []string
+	for _, msg := range t.Messages {
+		name := senderName(msg.From)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Unread counts the thread's unread messages. Messages whose flags
+// weren't fetched count as read.
+func (t *Thread) Unread() int {
+	n := 0
+	for _, msg := range t.Messages {
+		if msg.Flags != nil && !slices.Contains(msg.Flags, imap.SeenFlag) {
+			n++
+		}
+	}
+	return n
+}
+
+// replyPrefix matches the Re: and Fwd: prefixes of a reply's subject
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|sv)(\[\d+\])?:\s*)+`)
+
+// baseSubject strips reply prefixes and case from a subject
+func baseSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(replyPrefix.ReplaceAllString(subject, "")))
+}
+
+// senderName shortens "Name <address>" to the name
+func senderName(from string) string {
+	if i := strings.Index(from, " <"); i > 0 {
+		return strings.Trim(from[:i], `"`)
+	}
+	return from
+}
+
+// groupThreads groups messages into conversations, by the server's thread
+// IDs when every message has one, and otherwise by their reply headers.
+// Threads keep the order of the results: each goes where its first result
+// was, so newest-first results give the newest conversation first.
+func groupThreads(messages []Email) []Thread {
+	byServer := len(messages) > 0
+	for _, msg := range messages {
+		if msg.ThreadID == "" {
+			byServer = false
+			break
+		}
+	}
+
+	var keys []int
+	if byServer {
+		keys = groupByID(messages)
+	} else {
+		keys = groupByHeaders(messages)
+	}
+
+	index := make(map[int]int)
+	var threads []Thread
+	for i, msg := range messages {
+		t, ok := index[keys[i]]
+		if !ok {
+			t = len(threads)
+			index[keys[i]] = t
+			threads = append(threads, Thread{})
+		}
+		threads[t].Messages = append(threads[t].Messages, msg)
+	}
+
+	for _, t := range threads {
+		sort.SliceStable(t.Messages, func(i, j int) bool {
+			return t.Messages[i].Date.Before(t.Messages[j].Date)
+		})
+	}
+	return threads
+}
+
+// groupByID gives messages with the same server thread ID the same key
+func groupByID(messages []Email) []int {
+	ids := make(map[string]int)
+	keys := make([]int, len(messages))
+	for i, msg := range messages {
+		if _, ok := ids[msg.ThreadID]; !ok {
+			ids[msg.ThreadID] = i
+		}
+		keys[i] = ids[msg.ThreadID]
+	}
+	return keys
+}
+
+// groupByHeaders threads messages as JWZ's algorithm does: a message joins
+// the thread of every message its References and In-Reply-To name, even
+// ones missing from the results. Replies without either header are then
+// threaded by subject.
+func groupByHeaders(messages []Email) []int {
+	// Union-find over message positions, plus one node per Message-ID
+	// that no result has
+	parent := make([]int, len(messages))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(n int) int {
+		for parent[n] != n {
+			parent[n] = parent[parent[n]]
+			n = parent[n]
+		}
+		return n
+	}
+	union := func(a, b int) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+
+	nodes := make(map[string]int)
+	node := func(id string) int {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		parent = append(parent, len(parent))
+		nodes[id] = len(parent) - 1
+		return nodes[id]
+	}
+
+	for i, msg := range messages {
+		if id := normalizeMessageID(msg.MessageID); id != "" {
+			if n, ok := nodes[id]; ok {
+				union(n, i)
+			} else {
+				nodes[id] = i
+			}
+		}
+	}
+	for i, msg := range messages {
+		refs := msg.References
+		if msg.InReplyTo != "" {
+			refs = append(slices.Clip(refs), msg.InReplyTo)
+		}
+		for _, ref := range refs {
+			if id := normalizeMessageID(ref); id != "" {
+				union(node(id), i)
+			}
+		}
+	}
+
+	// Replies that lost their headers still match their subject: they join
+	// the first message with the same subject that isn't one of them.
+	// Messages with headers are only threaded by them, so unrelated
+	// conversations that share a subject stay apart.
+	lost := func(msg Email) bool {
+		return len(msg.References) == 0 && msg.InReplyTo == "" && replyPrefix.MatchString(msg.Subject)
+	}
+	subjects := make(map[string]int)
+	for i, msg := range messages {
+		base := baseSubject(msg.Subject)
+		if _, ok := subjects[base]; !ok && base != "" && !lost(msg) {
+			subjects[base] = i
+		}
+	}
+	for i, msg := range messages {
+		base := baseSubject(msg.Subject)
+		if base == "" || !lost(msg) {
+			continue
+		}
+		if first, ok := subjects[base]; ok {
+			union(first, i)
+		} else {
+			subjects[base] = i
+		}
+	}
+
+	keys := make([]int, len(messages))
+	for i := range messages {
+		keys[i] = find(i)
+	}
+	return keys
+}
+
+// normalizeMessageID strips the angle brackets IMAP envelopes and archives
+// keep and JMAP drops. Message-IDs are kept as their source gives them and
+// compared only through it.
+func normalizeMessageID(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
+}
+
+// printThreads prints search results grouped into conversations, numbered
+// for expand, and returns them. Each thread's latest message is what
+// reply <n> answers.
+func (e *Executor) printThreads(messages []Email) []Thread {
+	e.threads = groupThreads(messages)
+	e.lastResults = nil
+
+	for i, t := range e.threads {
+		latest := t.Latest()
+		e.lastResults = append(e.lastResults, latest)
+
+		marker := ""
+		if unread := t.Unread(); unread > 0 {
+			marker = fmt.Sprintf(" • %d unread", unread)
+		}
+		count := ""
+		if len(t.Messages) > 1 {
+			count = fmt.Sprintf(" (%d)", len(t.Messages))
+		}
+
+		fmt.Fprintf(e.out, "[%d] %s%s%s\n", i+1, strings.Join(t.Participants(), ", "), count, marker)
+		fmt.Fprintf(e.out, "    Subject: %s\n", t.Messages[0].Subject)
+		fmt.Fprintf(e.out, "    Date: %s\n", latest.Date.Format("2006-01-02 15:04:05"))
+		if latest.Mailbox != "" && latest.Mailbox != "INBOX" {
+			fmt.Fprintf(e.out, "    Folder: %s\n", latest.Mailbox)
+		}
+		if names := attachmentNames(latest); names != "" {
+			fmt.Fprintf(e.out, "    Attachments: %s\n", names)
+		}
+		fmt.Fprintln(e.out)
+	}
+	if len(e.threads) < len(messages) {
+		fmt.Fprintln(e.out, "Type 'expand <n>' to see the messages of a conversation.")
+	}
+
+	return e.threads
+}
+
+// executeExpand lists the messages of a conversation from the last search.
+// They become the results reply <n> answers.
+func (e *Executor) executeExpand(intent *Intent) (*Result, error) {
+	t := e.threads[intent.Result-1]
+
+	fmt.Fprintf(e.out, "\n=== Conversation %d: %s ===\n\n", intent.Result, t.Messages[0].Subject)
+	e.printResults(t.Messages)
+	e.lastResults = t.Messages
+
+	return &Result{Command: CommandExpand, Count: len(t.Messages), Messages: t.Messages}, nil
+}
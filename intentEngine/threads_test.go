@@ -0,0 +1,40 @@
+package intentengine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGroupThreadsBySubject(t *testing.T) {
+	messages := []Email{
+		// Two conversations with the same subject, threaded by headers
+		{MessageID: "<a1@acme.com>", Subject: "Interview", Date: at(1)},
+		{MessageID: "<a2@me>", Subject: "Re: Interview", InReplyTo: "<a1@acme.com>", Date: at(2)},
+		{MessageID: "<b1@other.com>", Subject: "Interview", Date: at(3)},
+		{MessageID: "<b2@me>", Subject: "Re: Interview", InReplyTo: "<b1@other.com>", References: []string{"<b1@other.com>"}, Date: at(4)},
+		// A reply whose client dropped the headers
+		{MessageID: "<c@me>", Subject: "RE: interview", Date: at(5)},
+		// Replies to a message missing from the results
+		{MessageID: "<d1@me>", Subject: "Re: Lunch", InReplyTo: "<gone@acme.com>", Date: at(6)},
+		{MessageID: "<d2@me>", Subject: "Re: Lunch", InReplyTo: "<gone@acme.com>", Date: at(7)},
+		{MessageID: "<e@me>", Subject: "Re: Offer", Date: at(8)},
+	}
+
+	var got [][]string
+	for _, thread := range groupThreads(messages) {
+		var ids []string
+		for _, msg := range thread.Messages {
+			ids = append(ids, msg.MessageID)
+		}
+		got = append(got, ids)
+	}
+	want := [][]string{
+		{"<a1@acme.com>", "<a2@me>", "<c@me>"},
+		{"<b1@other.com>", "<b2@me>"},
+		{"<d1@me>", "<d2@me>"},
+		{"<e@me>"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("threads = %q, want %q", got, want)
+	}
+}
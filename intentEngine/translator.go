@@ -0,0 +1,273 @@
+package intentengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IntentTranslator turns a free-text request such as "get job applications"
+// into a canonical query the Parser accepts
+type IntentTranslator interface {
+	Translate(text string) (string, error)
+}
+
+// Translator translates free text with an optional LLM-backed translator,
+// falling back to the deterministic rules when it fails or returns
+// something the Parser rejects
+type Translator struct {
+	primary IntentTranslator
+	rules   *RuleTranslator
+	parser  *Parser
+}
+
+// NewTranslator creates a translator. primary may be nil to use rules only.
+func NewTranslator(primary IntentTranslator, parser *Parser) *Translator {
+	return &Translator{
+		primary: primary,
+		rules:   NewRuleTranslator(),
+		parser:  parser,
+	}
+}
+
+// Translate returns the parsed intent and the canonical query it came from,
+// so the caller can show the query for confirmation before executing
+func (t *Translator) Translate(text string) (*Intent, string, error) {
+	if t.primary != nil {
+		query, err := t.primary.Translate(text)
+		if err == nil {
+			if intent, err := t.parser.Parse(query); err == nil {
+				return intent, query, nil
+			}
+		}
+	}
+
+	query, err := t.rules.Translate(text)
+	if err != nil {
+		return nil, "", err
+	}
+	intent, err := t.parser.Parse(query)
+	if err != nil {
+		return nil, "", fmt.Errorf("translated query %q is invalid: %w", query, err)
+	}
+	return intent, query, nil
+}
+
+// OllamaTranslator asks a local Ollama model to write the canonical query
+type OllamaTranslator struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+// NewOllamaTranslator creates a translator for the Ollama server at url
+// (e.g. http://localhost:11434) using the given model
+func NewOllamaTranslator(url, model string) *OllamaTranslator {
+	return &OllamaTranslator{
+		url:    strings.TrimRight(url, "/"),
+		model:  model,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Translate prompts the model with the grammar and examples and returns the
+// first line of its answer that looks like a query
+func (o *OllamaTranslator) Translate(text string) (string, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Translate the user's email request into exactly one command in this grammar.\n")
+	prompt.WriteString(Grammar)
+	prompt.WriteString("\nDate ranges: recent, today, yesterday, last N hours|days|weeks|months, this|last week|month|year, " +
+		"since <weekday or date>, before|after YYYY-MM-DD, older than N days, in <month> [year], week N, " +
+		"YYYY-MM-DD, YYYY-MM-DD to YYYY-MM-DD; append tz:<IANA zone> for another time zone.\n")
+	prompt.WriteString("A sender of \"*@domain.com\" means anyone at that domain.\nExamples:\n")
+	for _, example := range ParseExamples() {
+		prompt.WriteString("  " + example + "\n")
+	}
+	prompt.WriteString("Answer with the command only, no explanation.\nRequest: " + text + "\nCommand:")
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":   o.model,
+		"prompt":  prompt.String(),
+		"stream":  false,
+		"options": map[string]interface{}{"temperature": 0},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.client.Post(o.url+"/api/generate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("ollama request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ollama returned %s", resp.Status)
+	}
+
+	var out struct {
+		Response string `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid ollama response: %w", err)
+	}
+
+	for _, line := range strings.Split(out.Response, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), "`")
+		if verbStart.MatchString(line) {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("ollama returned no command")
+}
+
+// verbStart matches lines that begin with a command verb
+var verbStart = regexp.MustCompile(`(?i)^(search|listen|archive|trash|star|unstar|mark|label|move)\b`)
+
+// RuleTranslator is the deterministic fallback: it spots verbs, senders,
+// dates and content words with fixed rules
+type RuleTranslator struct {
+	emailPattern  *regexp.Regexp
+	domainPattern *regexp.Regexp
+	fromPattern   *regexp.Regexp
+	lastNPattern  *regexp.Regexp
+	olderPattern  *regexp.Regexp
+}
+
+// NewRuleTranslator creates the rule-based translator
+func NewRuleTranslator() *RuleTranslator {
+	return &RuleTranslator{
+		emailPattern:  regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+		domainPattern: regexp.MustCompile(`(?:^|\s)@?([\w-]+(?:\.[\w-]+)*\.(?:com|org|net|edu|io|co|gov|dev|ai))\b`),
+		fromPattern:   regexp.MustCompile(`\bfrom\s+([\w.-]+)`),
+		lastNPattern:  regexp.MustCompile(`\b(?:last|past)\s+(\d+)\s+days?\b`),
+		olderPattern:  regexp.MustCompile(`\bolder\s+than\s+(\d+)\s+days?\b`),
+	}
+}
+
+// fillerWords never become keywords
+var fillerWords = map[string]bool{
+	"get": true, "show": true, "find": true, "fetch": true, "list": true, "give": true,
+	"me": true, "my": true, "all": true, "any": true, "the": true, "a": true, "an": true,
+	"email": true, "emails": true, "mail": true, "mails": true, "message": true,
+	"messages": true, "inbox": true, "please": true, "for": true, "about": true,
+	"of": true, "to": true, "in": true, "and": true, "with": true, "that": true,
+	"search": true, "look": true, "up": true, "i": true, "got": true, "received": true,
+	"archive": true, "delete": true, "trash": true, "star": true, "mark": true,
+	"read": true, "unread": true, "listen": true, "watch": true, "notify": true,
+	"when": true, "new": true, "from": true, "recent": true, "recently": true,
+	"today": true, "yesterday": true, "week": true, "this": true, "last": true,
+	"past": true, "days": true, "day": true, "older": true, "than": true, "month": true,
+	"what": true, "everything": true, "some": true, "writes": true, "sent": true,
+}
+
+// Translate builds a canonical query from free text
+func (r *RuleTranslator) Translate(text string) (string, error) {
+	lower := strings.ToLower(strings.TrimSpace(text))
+	if lower == "" {
+		return "", fmt.Errorf("empty request")
+	}
+
+	// Verb
+	verb := "search"
+	switch {
+	case strings.Contains(lower, "listen") || strings.Contains(lower, "watch") ||
+		strings.Contains(lower, "notify me") || strings.Contains(lower, "let me know"):
+		verb = "listen"
+	case strings.HasPrefix(lower, "archive"):
+		verb = "archive"
+	case strings.HasPrefix(lower, "delete") || strings.HasPrefix(lower, "trash"):
+		verb = "trash"
+	case strings.HasPrefix(lower, "star"):
+		verb = "star"
+	case strings.HasPrefix(lower, "mark") && strings.Contains(lower, "unread"):
+		verb = "mark unread"
+	case strings.HasPrefix(lower, "mark") && strings.Contains(lower, "read"):
+		verb = "mark read"
+	}
+
+	// Sender: an address, a bare domain, or the word after "from"
+	sender := ""
+	rest := lower
+	if m := r.emailPattern.FindString(lower); m != "" {
+		sender = m
+		rest = strings.Replace(rest, m, " ", 1)
+	} else if m := r.domainPattern.FindStringSubmatch(lower); m != nil {
+		sender = "*@" + m[1]
+		rest = strings.Replace(rest, m[0], " ", 1)
+	} else if m := r.fromPattern.FindStringSubmatch(lower); m != nil && !fillerWords[m[1]] {
+		sender = m[1]
+		rest = strings.Replace(rest, m[0], " ", 1)
+	}
+
+	// Date range
+	date := ""
+	switch {
+	case r.lastNPattern.MatchString(rest):
+		date = "last " + r.lastNPattern.FindStringSubmatch(rest)[1] + " days"
+	case r.olderPattern.MatchString(rest):
+		date = "older than " + r.olderPattern.FindStringSubmatch(rest)[1] + " days"
+	case strings.Contains(rest, "yesterday"):
+		date = "yesterday"
+	case strings.Contains(rest, "today"):
+		date = "today"
+	case strings.Contains(rest, "this week"):
+		date = "this week"
+	case strings.Contains(rest, "last week"):
+		date = "last week"
+	case strings.Contains(rest, "this month"):
+		date = "this month"
+	case strings.Contains(rest, "last month"):
+		date = "last month"
+	case strings.Contains(rest, "recent"):
+		date = "recent"
+	}
+	rest = r.lastNPattern.ReplaceAllString(rest, " ")
+	rest = r.olderPattern.ReplaceAllString(rest, " ")
+
+	// Keywords: what's left after filler, as one phrase, with plurals
+	// trimmed so the IMAP substring search also matches the singular
+	var keywords []string
+	for _, word := range strings.FieldsFunc(rest, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-'
+	}) {
+		if fillerWords[word] || len(word) < 2 {
+			continue
+		}
+		if len(word) > 4 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = strings.TrimSuffix(word, "s")
+		}
+		keywords = append(keywords, word)
+	}
+
+	if verb == "listen" {
+		if sender == "" {
+			return "", fmt.Errorf("couldn't tell who to listen for")
+		}
+		return fmt.Sprintf("listen from %q", sender), nil
+	}
+
+	if verb != "search" && sender == "" {
+		return "", fmt.Errorf("couldn't tell whose messages to %s", verb)
+	}
+	if len(keywords) == 0 && sender == "" {
+		return "", fmt.Errorf("couldn't find anything to search for")
+	}
+
+	var query strings.Builder
+	query.WriteString(verb)
+	if len(keywords) > 0 {
+		fmt.Fprintf(&query, " for %q", strings.Join(keywords, " "))
+	}
+	if sender != "" {
+		fmt.Fprintf(&query, " from %q", sender)
+	}
+	if date != "" {
+		fmt.Fprintf(&query, " [%s]", date)
+	}
+	return query.String(), nil
+}
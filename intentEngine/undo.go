@@ -0,0 +1,205 @@
+package intentengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// executeUndo reverses the journal entry named by the intent, or the most
+// recent one when no ID is given
+func (e *Executor) executeUndo(intent *Intent) (*Result, error) {
+	entry, err := e.journal.Undoable(intent.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(e.out, "\n=== Undoing journal entry %s ===\n", entry.ID)
+	fmt.Fprintf(e.out, "Operation: %s on %d messages in %s\n", entry.Operation, len(entry.Messages), entry.Mailbox)
+	fmt.Fprintln(e.out, "Recorded:", entry.Time.Format("2006-01-02 15:04:05"))
+
+	var restored int
+	if flag, ok := actionFlag(entry.Operation); ok {
+		restored, err = e.undoFlag(entry, flag)
+	} else if dest, ok := actionDestination(&Intent{Command: entry.Operation, Target: entry.Target}); ok {
+		restored, err = e.undoMove(entry, dest)
+	} else if entry.Operation == CommandLabel {
+		restored, err = e.undoLabel(entry)
+	} else {
+		err = fmt.Errorf("cannot undo %s", entry.Operation)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("undo failed: %w", err)
+	}
+
+	if err := e.journal.Append(&JournalEntry{
+		Operation:   CommandUndo,
+		Mailbox:     entry.Mailbox,
+		Target:      entry.Target,
+		UIDValidity: entry.UIDValidity,
+		Messages:    entry.Messages,
+		Undoes:      entry.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("undo applied but not journaled: %w", err)
+	}
+
+	fmt.Fprintf(e.out, "✓ Restored %d of %d messages\n", restored, len(entry.Messages))
+
+	return &Result{Command: CommandUndo, Count: restored, JournalID: entry.ID, Recorded: len(entry.Messages)}, nil
+}
+
+// undoFlag puts a single flag back the way each message had it
+func (e *Executor) undoFlag(entry *JournalEntry, flag string) (int, error) {
+	resolved, err := e.resolveJournal(entry.Mailbox, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	var had, hadNot []uint32
+	for uid, msg := range resolved {
+		if hasFlag(msg.Flags, flag) {
+			had = append(had, uid)
+		} else {
+			hadNot = append(hadNot, uid)
+		}
+	}
+
+	if len(had) > 0 {
+		if err := e.backend.Store(had, flag, true); err != nil {
+			return 0, err
+		}
+	}
+	if len(hadNot) > 0 {
+		if err := e.backend.Store(hadNot, flag, false); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(resolved), nil
+}
+
+// undoMove moves messages from the action's destination back to the
+// mailbox they were taken from
+func (e *Executor) undoMove(entry *JournalEntry, dest string) (int, error) {
+	resolved, err := e.resolveJournal(dest, entry)
+	if err != nil {
+		return 0, err
+	}
+	if len(resolved) == 0 {
+		return 0, nil
+	}
+
+	uids := make([]uint32, 0, len(resolved))
+	for uid := range resolved {
+		uids = append(uids, uid)
+	}
+
+	return len(resolved), e.backend.Move(uids, entry.Mailbox)
+}
+
+// undoLabel removes a label from the messages that didn't have it before.
+// A label applied as copies into a folder is undone by deleting exactly
+// the copies the action recorded, never messages matched by Message-ID,
+// which may have been in the folder already.
+func (e *Executor) undoLabel(entry *JournalEntry) (int, error) {
+	if entry.TargetUIDValidity != 0 {
+		folder, err := e.backend.Open(entry.Target, false)
+		if err != nil {
+			return 0, err
+		}
+		if folder.UIDValidity != entry.TargetUIDValidity {
+			return 0, fmt.Errorf("%s was recreated since the label was applied, so its copies can't be found", entry.Target)
+		}
+
+		var copies []uint32
+		for _, msg := range entry.Messages {
+			if msg.CopyUID != 0 {
+				copies = append(copies, msg.CopyUID)
+			}
+		}
+		if len(copies) == 0 {
+			return 0, nil
+		}
+		return len(copies), e.backend.Delete(copies)
+	}
+
+	resolved, err := e.resolveJournal(entry.Mailbox, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	var uids []uint32
+	for uid, msg := range resolved {
+		if !hasLabel(msg.Labels, entry.Target) {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return len(resolved), nil
+	}
+
+	err = e.backend.Label(uids, entry.Target, false)
+	if errors.Is(err, errNoLabels) {
+		return 0, fmt.Errorf("the label was copied into %s without recording the copies' UIDs, so they can't be told apart from messages already there", entry.Target)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(resolved), nil
+}
+
+// resolveJournal opens mailbox and finds the current UID of every message
+// in the entry. Recorded UIDs are trusted only in the mailbox they were
+// recorded in, and only while its UIDVALIDITY is unchanged; otherwise, or
+// when the store has no UIDs, the messages are found again by Message-ID.
+func (e *Executor) resolveJournal(mailbox string, entry *JournalEntry) (map[uint32]JournalMessage, error) {
+	folder, err := e.backend.Open(mailbox, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[uint32]JournalMessage)
+
+	if mailbox == entry.Mailbox && folder.UIDValidity != 0 && folder.UIDValidity == entry.UIDValidity {
+		for _, msg := range entry.Messages {
+			resolved[msg.UID] = msg
+		}
+		return resolved, nil
+	}
+
+	for _, msg := range entry.Messages {
+		if msg.MessageID == "" {
+			continue
+		}
+
+		uids, err := e.backend.FindMessageID(msg.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			resolved[uid] = msg
+		}
+	}
+
+	return resolved, nil
+}
+
+// hasFlag reports whether flags contains flag, ignoring case
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabel reports whether labels contains label
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package jmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities used by this client
+const (
+	CoreCapability = "urn:ietf:params:jmap:core"
+	MailCapability = "urn:ietf:params:jmap:mail"
+)
+
+// Session is the JMAP session resource (RFC 8620 section 2)
+type Session struct {
+	APIURL          string            `json:"apiUrl"`
+	EventSourceURL  string            `json:"eventSourceUrl"`
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+}
+
+// Client talks to one JMAP server with a bearer token
+type Client struct {
+	sessionURL string
+	token      string
+	http       *http.Client
+
+	mu      sync.Mutex
+	session *Session
+}
+
+// New creates a client for the session resource at sessionURL, e.g.
+// https://api.fastmail.com/jmap/session
+func New(sessionURL, token string) *Client {
+	return &Client{
+		sessionURL: sessionURL,
+		token:      token,
+		http:       &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Session fetches the session resource once and caches it
+func (c *Client) Session() (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil {
+		return c.session, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.sessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(c.http, req)
+	if err != nil {
+		return nil, fmt.Errorf("jmap session failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var session Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("invalid jmap session: %w", err)
+	}
+	if session.APIURL == "" || session.PrimaryAccounts[MailCapability] == "" {
+		return nil, fmt.Errorf("jmap server does not offer mail")
+	}
+
+	c.session = &session
+	return c.session, nil
+}
+
+// AccountID returns the primary mail account
+func (c *Client) AccountID() (string, error) {
+	session, err := c.Session()
+	if err != nil {
+		return "", err
+	}
+	return session.PrimaryAccounts[MailCapability], nil
+}
+
+// Invocation is one method call or response: [name, arguments, call id]
+type Invocation struct {
+	Name string
+	Args interface{}
+	ID   string
+}
+
+// MarshalJSON encodes the invocation as a JSON array
+func (inv Invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{inv.Name, inv.Args, inv.ID})
+}
+
+// MethodError is a method-level error response
+type MethodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+func (e *MethodError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("jmap error %s: %s", e.Type, e.Description)
+	}
+	return "jmap error " + e.Type
+}
+
+// Call sends method calls in one request and returns the raw response
+// arguments by call id. A method error fails the whole call.
+func (c *Client) Call(calls ...Invocation) (map[string]json.RawMessage, error) {
+	session, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"using":       []string{CoreCapability, MailCapability},
+		"methodCalls": calls,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, session.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(c.http, req)
+	if err != nil {
+		return nil, fmt.Errorf("jmap request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		MethodResponses [][]json.RawMessage `json:"methodResponses"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid jmap response: %w", err)
+	}
+
+	results := make(map[string]json.RawMessage)
+	for _, r := range out.MethodResponses {
+		if len(r) != 3 {
+			return nil, fmt.Errorf("invalid jmap response")
+		}
+		var name, id string
+		if err := json.Unmarshal(r[0], &name); err != nil {
+			return nil, fmt.Errorf("invalid jmap response: %w", err)
+		}
+		if err := json.Unmarshal(r[2], &id); err != nil {
+			return nil, fmt.Errorf("invalid jmap response: %w", err)
+		}
+		if name == "error" {
+			methodErr := &MethodError{}
+			json.Unmarshal(r[1], methodErr)
+			return nil, methodErr
+		}
+		results[id] = r[1]
+	}
+	return results, nil
+}
+
+// do sends an authenticated request and fails on non-2xx statuses
+func (c *Client) do(hc *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// expandURL fills in an RFC 6570 level 1 URL template such as the
+// eventSourceUrl
+func expandURL(template string, vars map[string]string) string {
+	for name, value := range vars {
+		template = strings.ReplaceAll(template, "{"+name+"}", value)
+	}
+	return template
+}
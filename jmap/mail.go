@@ -0,0 +1,338 @@
+package jmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FilterCondition is an Email/query filter (RFC 8621 section 4.4.1).
+// Empty fields are left out.
+type FilterCondition struct {
+	InMailbox string     `json:"inMailbox,omitempty"`
+	After     *time.Time `json:"after,omitempty"`
+	Before    *time.Time `json:"before,omitempty"`
+	From      string     `json:"from,omitempty"`
+	Text      string     `json:"text,omitempty"`
+	Header    []string   `json:"header,omitempty"` // Name, and optionally a value it contains
+
+	HasAttachment bool  `json:"hasAttachment,omitempty"`
+	MinSize       int64 `json:"minSize,omitempty"`
+}
+
+// FilterOperator combines filters with AND, OR or NOT
+type FilterOperator struct {
+	Operator   string        `json:"operator"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+// Address is an email address with its display name
+type Address struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// BodyPart is the part of a body structure this client reads
+type BodyPart struct {
+	PartID string `json:"partId"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+}
+
+// BodyValue is the decoded content of a text part
+type BodyValue struct {
+	Value string `json:"value"`
+}
+
+// Email is a message with the properties this client fetches
+type Email struct {
+	ID          string               `json:"id"`
+	ThreadID    string               `json:"threadId"`
+	MessageID   []string             `json:"messageId"`
+	From        []Address            `json:"from"`
+	Subject     string               `json:"subject"`
+	ReceivedAt  time.Time            `json:"receivedAt"`
+	Keywords    map[string]bool      `json:"keywords"`
+	MailboxIDs  map[string]bool      `json:"mailboxIds"`
+	Size        int                  `json:"size"`
+	TextBody    []BodyPart           `json:"textBody"`
+	Attachments []BodyPart           `json:"attachments"`
+	BodyValues  map[string]BodyValue `json:"bodyValues"`
+}
+
+// Text joins the decoded text body parts
+func (e *Email) Text() string {
+	text := ""
+	for _, part := range e.TextBody {
+		text += e.BodyValues[part.PartID].Value
+	}
+	return text
+}
+
+// emailProperties are the properties Email/get asks for
+var emailProperties = []string{"id", "threadId", "messageId", "from", "subject", "receivedAt", "keywords", "mailboxIds", "size", "textBody", "attachments", "bodyValues"}
+
+// Mailbox is a folder, or a label when emails are in several at once
+type Mailbox struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Role        string `json:"role"` // inbox, archive, trash, all, ... or empty
+	TotalEmails int    `json:"totalEmails"`
+}
+
+// Mailboxes returns every mailbox of the account
+func (c *Client) Mailboxes() ([]Mailbox, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := c.Call(Invocation{
+		Name: "Mailbox/get",
+		Args: map[string]interface{}{
+			"accountId":  account,
+			"ids":        nil,
+			"properties": []string{"id", "name", "role", "totalEmails"},
+		},
+		ID: "0",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		List []Mailbox `json:"list"`
+	}
+	if err := json.Unmarshal(results["0"], &out); err != nil {
+		return nil, fmt.Errorf("invalid Mailbox/get response: %w", err)
+	}
+	return out.List, nil
+}
+
+// InboxID returns the id of the mailbox with the inbox role
+func (c *Client) InboxID() (string, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return "", err
+	}
+
+	results, err := c.Call(Invocation{
+		Name: "Mailbox/query",
+		Args: map[string]interface{}{
+			"accountId": account,
+			"filter":    map[string]string{"role": "inbox"},
+		},
+		ID: "0",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(results["0"], &out); err != nil {
+		return "", fmt.Errorf("invalid Mailbox/query response: %w", err)
+	}
+	if len(out.IDs) == 0 {
+		return "", fmt.Errorf("no inbox found")
+	}
+	return out.IDs[0], nil
+}
+
+// Comparator is one sort key of Email/query
+type Comparator struct {
+	Property    string `json:"property"`
+	IsAscending bool   `json:"isAscending"`
+}
+
+// Search runs Email/query and fetches the matches with Email/get in the
+// same request, and returns them with the total number of matches. The
+// matches are in sort order, newest first when sort is nil, starting at
+// position. limit 0 uses the server's default.
+func (c *Client) Search(filter interface{}, sort []Comparator, position, limit int) ([]Email, int, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if sort == nil {
+		sort = []Comparator{{Property: "receivedAt"}}
+	}
+	query := map[string]interface{}{
+		"accountId":      account,
+		"filter":         filter,
+		"sort":           sort,
+		"position":       position,
+		"calculateTotal": true,
+	}
+	if limit > 0 {
+		query["limit"] = limit
+	}
+
+	results, err := c.Call(
+		Invocation{Name: "Email/query", Args: query, ID: "0"},
+		Invocation{
+			Name: "Email/get",
+			Args: map[string]interface{}{
+				"accountId":           account,
+				"#ids":                map[string]string{"resultOf": "0", "name": "Email/query", "path": "/ids"},
+				"properties":          emailProperties,
+				"fetchTextBodyValues": true,
+			},
+			ID: "1",
+		},
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total struct {
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(results["0"], &total); err != nil {
+		return nil, 0, fmt.Errorf("invalid Email/query response: %w", err)
+	}
+	emails, _, err := decodeGet(results["1"])
+	return emails, total.Total, err
+}
+
+// Query runs Email/query and returns the ids of every match, newest first
+func (c *Client) Query(filter interface{}) ([]string, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := c.Call(Invocation{
+		Name: "Email/query",
+		Args: map[string]interface{}{
+			"accountId": account,
+			"filter":    filter,
+			"sort":      []Comparator{{Property: "receivedAt"}},
+		},
+		ID: "0",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(results["0"], &out); err != nil {
+		return nil, fmt.Errorf("invalid Email/query response: %w", err)
+	}
+	return out.IDs, nil
+}
+
+// Update applies a patch to each email with Email/set, e.g.
+// {"keywords/$seen": true} or {"mailboxIds/<id>": nil}. It fails when any
+// email wasn't updated.
+func (c *Client) Update(patches map[string]map[string]interface{}) error {
+	return c.set(map[string]interface{}{"update": patches})
+}
+
+// Destroy deletes emails permanently with Email/set
+func (c *Client) Destroy(ids []string) error {
+	return c.set(map[string]interface{}{"destroy": ids})
+}
+
+// set runs Email/set and fails on the first email it couldn't change
+func (c *Client) set(args map[string]interface{}) error {
+	account, err := c.AccountID()
+	if err != nil {
+		return err
+	}
+	args["accountId"] = account
+
+	results, err := c.Call(Invocation{Name: "Email/set", Args: args, ID: "0"})
+	if err != nil {
+		return err
+	}
+
+	var out struct {
+		NotUpdated   map[string]MethodError `json:"notUpdated"`
+		NotDestroyed map[string]MethodError `json:"notDestroyed"`
+	}
+	if err := json.Unmarshal(results["0"], &out); err != nil {
+		return fmt.Errorf("invalid Email/set response: %w", err)
+	}
+	for _, failed := range []map[string]MethodError{out.NotUpdated, out.NotDestroyed} {
+		for id, setErr := range failed {
+			return fmt.Errorf("email %s: %w", id, &setErr)
+		}
+	}
+	return nil
+}
+
+// Get fetches emails by id and returns them with the current Email state
+func (c *Client) Get(ids []string) ([]Email, string, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	results, err := c.Call(Invocation{
+		Name: "Email/get",
+		Args: map[string]interface{}{
+			"accountId":           account,
+			"ids":                 ids,
+			"properties":          emailProperties,
+			"fetchTextBodyValues": true,
+		},
+		ID: "0",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeGet(results["0"])
+}
+
+// Changes returns the ids of emails created since state, and the new state
+func (c *Client) Changes(since string) ([]string, string, error) {
+	account, err := c.AccountID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var created []string
+	for {
+		results, err := c.Call(Invocation{
+			Name: "Email/changes",
+			Args: map[string]interface{}{"accountId": account, "sinceState": since},
+			ID:   "0",
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		var out struct {
+			NewState       string   `json:"newState"`
+			HasMoreChanges bool     `json:"hasMoreChanges"`
+			Created        []string `json:"created"`
+		}
+		if err := json.Unmarshal(results["0"], &out); err != nil {
+			return nil, "", fmt.Errorf("invalid Email/changes response: %w", err)
+		}
+
+		created = append(created, out.Created...)
+		since = out.NewState
+		if !out.HasMoreChanges {
+			return created, since, nil
+		}
+	}
+}
+
+// decodeGet reads an Email/get response
+func decodeGet(raw json.RawMessage) ([]Email, string, error) {
+	var out struct {
+		State string  `json:"state"`
+		List  []Email `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, "", fmt.Errorf("invalid Email/get response: %w", err)
+	}
+	return out.List, out.State, nil
+}
@@ -0,0 +1,82 @@
+package jmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StateChange is a push notification: the new state of each changed type,
+// by account (RFC 8620 section 7.1)
+type StateChange struct {
+	Changed map[string]map[string]string `json:"changed"`
+}
+
+// Watch connects to the EventSource endpoint and calls fn with the new
+// Email state whenever mail in the primary account changes. It returns
+// when ctx is cancelled, the stream ends, or fn fails.
+func (c *Client) Watch(ctx context.Context, fn func(state string) error) error {
+	session, err := c.Session()
+	if err != nil {
+		return err
+	}
+	if session.EventSourceURL == "" {
+		return fmt.Errorf("jmap server does not support push")
+	}
+	account := session.PrimaryAccounts[MailCapability]
+
+	url := expandURL(session.EventSourceURL, map[string]string{
+		"types":      "Email",
+		"closeafter": "no",
+		"ping":       "60",
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The stream stays open, so no client timeout
+	resp, err := c.do(&http.Client{}, req)
+	if err != nil {
+		return fmt.Errorf("jmap event source failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Server-sent events: "event:" and "data:" lines, ended by a blank line
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event, data := "", ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "":
+			if event == "state" && data != "" {
+				var change StateChange
+				if err := json.Unmarshal([]byte(data), &change); err == nil {
+					if state, ok := change.Changed[account]["Email"]; ok {
+						if err := fn(state); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			event, data = "", ""
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("jmap event source failed: %w", err)
+	}
+	return fmt.Errorf("jmap event source closed")
+}
@@ -0,0 +1,113 @@
+package mailsync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// Maildir is one folder in Maildir format: messages are written to tmp,
+// then renamed into cur with their flags in the file name
+type Maildir struct {
+	Path string
+}
+
+// flagLetters maps IMAP flags to Maildir info letters
+var flagLetters = map[string]byte{
+	imap.DraftFlag:    'D',
+	imap.FlaggedFlag:  'F',
+	imap.AnsweredFlag: 'R',
+	imap.SeenFlag:     'S',
+	imap.DeletedFlag:  'T',
+}
+
+// FolderPath returns the Maildir++ directory for an IMAP mailbox under
+// root: INBOX is root itself, others are dot-folders
+func FolderPath(root, mailbox string) string {
+	if strings.EqualFold(mailbox, "INBOX") {
+		return root
+	}
+	name := strings.NewReplacer("/", ".", string(filepath.Separator), ".").Replace(mailbox)
+	return filepath.Join(root, "."+name)
+}
+
+// OpenMaildir creates the cur, new and tmp directories if needed
+func OpenMaildir(path string) (*Maildir, error) {
+	for _, dir := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0o700); err != nil {
+			return nil, fmt.Errorf("unable to create maildir: %w", err)
+		}
+	}
+	return &Maildir{Path: path}, nil
+}
+
+// Deliver stores a message and returns its file name within cur
+func (m *Maildir) Deliver(uid uint32, raw []byte, flags []string) (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "_", ":", "_").Replace(host)
+	base := fmt.Sprintf("%d.U%d_%s.%s", time.Now().Unix(), uid, hex.EncodeToString(b), host)
+
+	tmp := filepath.Join(m.Path, "tmp", base)
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return "", fmt.Errorf("unable to write message: %w", err)
+	}
+
+	name := base + info(flags)
+	if err := os.Rename(tmp, filepath.Join(m.Path, "cur", name)); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("unable to deliver message: %w", err)
+	}
+	return name, nil
+}
+
+// SetFlags renames a message to carry new flags and returns its new name
+func (m *Maildir) SetFlags(name string, flags []string) (string, error) {
+	base, _, _ := strings.Cut(name, ":")
+	renamed := base + info(flags)
+	if renamed == name {
+		return name, nil
+	}
+
+	if err := os.Rename(filepath.Join(m.Path, "cur", name), filepath.Join(m.Path, "cur", renamed)); err != nil {
+		return name, fmt.Errorf("unable to update flags: %w", err)
+	}
+	return renamed, nil
+}
+
+// Remove deletes a message
+func (m *Maildir) Remove(name string) error {
+	err := os.Remove(filepath.Join(m.Path, "cur", name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Open opens a message for reading
+func (m *Maildir) Open(name string) (*os.File, error) {
+	return os.Open(filepath.Join(m.Path, "cur", name))
+}
+
+// info builds the ":2,<letters>" suffix for a flag set
+func info(flags []string) string {
+	var letters []byte
+	for _, flag := range flags {
+		if l, ok := flagLetters[imap.CanonicalFlag(flag)]; ok {
+			letters = append(letters, l)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return ":2," + string(letters)
+}
@@ -0,0 +1,62 @@
+package mailsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateFile holds a folder's sync metadata inside its Maildir
+const stateFile = ".intent-sync.json"
+
+// Entry is the synced state of one message
+type Entry struct {
+	File      string   `json:"file"`
+	MessageID string   `json:"message_id,omitempty"`
+	Flags     []string `json:"flags"`
+	ModSeq    uint64   `json:"modseq,omitempty"`
+}
+
+// State is the metadata DB for one folder
+type State struct {
+	Mailbox       string            `json:"mailbox"`
+	UIDValidity   uint32            `json:"uid_validity"`
+	HighestModSeq uint64            `json:"highest_modseq,omitempty"`
+	LastUID       uint32            `json:"last_uid"`
+	Messages      map[uint32]*Entry `json:"messages"`
+}
+
+// loadState reads a folder's state, or returns an empty one
+func loadState(dir, mailbox string) (*State, error) {
+	state := &State{Mailbox: mailbox, Messages: make(map[uint32]*Entry)}
+
+	b, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sync state: %w", err)
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("corrupt sync state: %w", err)
+	}
+	if state.Messages == nil {
+		state.Messages = make(map[uint32]*Entry)
+	}
+	return state, nil
+}
+
+// save writes the state atomically
+func (s *State) save(dir string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write sync state: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, stateFile))
+}
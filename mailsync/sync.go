@@ -0,0 +1,400 @@
+package mailsync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+)
+
+// fetchBatch is how many new messages are downloaded per round trip
+const fetchBatch = 50
+
+// Stats summarizes one folder sync
+type Stats struct {
+	Mailbox string
+	Mode    string // QRESYNC, CONDSTORE or UID diff
+	Added   int
+	Updated int
+	Removed int
+	Rebuilt bool // UIDVALIDITY changed and the folder was downloaded again
+}
+
+// Syncer mirrors IMAP folders into Maildirs under a root directory
+type Syncer struct {
+	c         *client.Client
+	root      string
+	condstore bool
+	qresync   bool
+}
+
+// New creates a syncer. QRESYNC can only be enabled before a mailbox is
+// selected, so create the syncer on a fresh connection to get it.
+func New(c *client.Client, root string) (*Syncer, error) {
+	caps, err := c.Capability()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Syncer{
+		c:         c,
+		root:      root,
+		condstore: caps["CONDSTORE"] || caps["QRESYNC"],
+	}
+
+	if caps["QRESYNC"] && c.State() == imap.AuthenticatedState {
+		if _, err := c.Enable([]string{"QRESYNC"}); err == nil {
+			s.qresync = true
+		}
+	}
+
+	return s, nil
+}
+
+// Mode names the change detection the syncer uses
+func (s *Syncer) Mode() string {
+	switch {
+	case s.qresync:
+		return "QRESYNC"
+	case s.condstore:
+		return "CONDSTORE"
+	default:
+		return "UID diff"
+	}
+}
+
+// Sync brings the local copy of mailbox up to date
+func (s *Syncer) Sync(mailbox string) (*Stats, error) {
+	dir := FolderPath(s.root, mailbox)
+	md, err := OpenMaildir(dir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(dir, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Mailbox: mailbox, Mode: s.Mode()}
+
+	// HIGHESTMODSEQ comes from STATUS, before selecting; anything that
+	// changes in between is simply seen again on the next sync
+	var highest uint64
+	if s.condstore {
+		status, err := s.c.Status(mailbox, []imap.StatusItem{"HIGHESTMODSEQ"})
+		if err != nil {
+			return nil, fmt.Errorf("status failed: %w", err)
+		}
+		highest = parseModSeq(status.Items["HIGHESTMODSEQ"])
+	}
+
+	// Read-only, so downloading never sets \Seen
+	mbox, err := s.c.Select(mailbox, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %w", mailbox, err)
+	}
+
+	if state.UIDValidity != mbox.UidValidity {
+		if state.UIDValidity != 0 {
+			// Every UID we know is meaningless now: start over
+			for _, entry := range state.Messages {
+				md.Remove(entry.File)
+			}
+			stats.Rebuilt = true
+		}
+		state = &State{Mailbox: mailbox, UIDValidity: mbox.UidValidity, Messages: make(map[uint32]*Entry)}
+	}
+
+	if len(state.Messages) > 0 {
+		if err := s.syncKnown(md, state, highest, stats); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.syncNew(md, state, mbox, stats); err != nil {
+		return nil, err
+	}
+
+	state.HighestModSeq = highest
+	if err := state.save(dir); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// syncKnown applies flag changes and expunges to messages already mirrored
+func (s *Syncer) syncKnown(md *Maildir, state *State, highest uint64, stats *Stats) error {
+	known := new(imap.SeqSet)
+	known.AddRange(1, state.LastUID)
+
+	var changed []*imap.Message
+	var vanished *imap.SeqSet
+	var err error
+
+	switch {
+	case s.condstore && state.HighestModSeq > 0 && highest == state.HighestModSeq:
+		// Nothing changed since the last sync, and with QRESYNC that
+		// includes expunges
+		if s.qresync {
+			return nil
+		}
+	case s.condstore && state.HighestModSeq > 0:
+		changed, vanished, err = s.fetchChangedSince(known, state.HighestModSeq)
+	default:
+		changed, err = s.fetchFlags(known)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range changed {
+		entry, ok := state.Messages[msg.Uid]
+		if !ok || sameFlags(entry.Flags, msg.Flags) {
+			continue
+		}
+		name, err := md.SetFlags(entry.File, msg.Flags)
+		if err != nil {
+			return err
+		}
+		entry.File = name
+		entry.Flags = msg.Flags
+		entry.ModSeq = parseModSeq(msg.Items["MODSEQ"])
+		stats.Updated++
+	}
+
+	// Expunges: QRESYNC reports them as VANISHED, otherwise compare UIDs
+	var gone []uint32
+	if s.qresync {
+		for uid := range state.Messages {
+			if vanished != nil && vanished.Contains(uid) {
+				gone = append(gone, uid)
+			}
+		}
+	} else {
+		uids, err := s.c.UidSearch(imap.NewSearchCriteria())
+		if err != nil {
+			return fmt.Errorf("search failed: %w", err)
+		}
+		present := make(map[uint32]bool, len(uids))
+		for _, uid := range uids {
+			present[uid] = true
+		}
+		for uid := range state.Messages {
+			if !present[uid] {
+				gone = append(gone, uid)
+			}
+		}
+	}
+
+	for _, uid := range gone {
+		if err := md.Remove(state.Messages[uid].File); err != nil {
+			return err
+		}
+		delete(state.Messages, uid)
+		stats.Removed++
+	}
+
+	return nil
+}
+
+// syncNew downloads every message above the last synced UID
+func (s *Syncer) syncNew(md *Maildir, state *State, mbox *imap.MailboxStatus, stats *Stats) error {
+	if mbox.UidNext != 0 && mbox.UidNext <= state.LastUID+1 {
+		return nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(state.LastUID+1, 0)
+
+	found, err := s.c.UidSearch(criteria)
+	if err != nil {
+		return fmt.Errorf("search failed: %w", err)
+	}
+
+	// "n:*" always includes the highest UID, even when it is below n
+	var uids []uint32
+	for _, uid := range found {
+		if uid > state.LastUID {
+			uids = append(uids, uid)
+		}
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchEnvelope, section.FetchItem()}
+	if s.condstore {
+		items = append(items, "MODSEQ")
+	}
+
+	for start := 0; start < len(uids); start += fetchBatch {
+		end := start + fetchBatch
+		if end > len(uids) {
+			end = len(uids)
+		}
+
+		set := new(imap.SeqSet)
+		set.AddNum(uids[start:end]...)
+
+		messages := make(chan *imap.Message, fetchBatch)
+		done := make(chan error, 1)
+		go func() {
+			done <- s.c.UidFetch(set, items, messages)
+		}()
+
+		var deliverErr error
+		for msg := range messages {
+			if deliverErr != nil {
+				continue
+			}
+			deliverErr = s.deliver(md, state, msg, section)
+			if deliverErr == nil {
+				stats.Added++
+			}
+		}
+		if err := <-done; err != nil {
+			return fmt.Errorf("fetch failed: %w", err)
+		}
+		if deliverErr != nil {
+			return deliverErr
+		}
+	}
+
+	return nil
+}
+
+// deliver writes one downloaded message into the Maildir and the state
+func (s *Syncer) deliver(md *Maildir, state *State, msg *imap.Message, section *imap.BodySectionName) error {
+	body := msg.GetBody(section)
+	if body == nil {
+		return fmt.Errorf("server returned no body for UID %d", msg.Uid)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	name, err := md.Deliver(msg.Uid, raw, msg.Flags)
+	if err != nil {
+		return err
+	}
+
+	entry := &Entry{File: name, Flags: msg.Flags, ModSeq: parseModSeq(msg.Items["MODSEQ"])}
+	if msg.Envelope != nil {
+		entry.MessageID = msg.Envelope.MessageId
+	}
+	state.Messages[msg.Uid] = entry
+	if msg.Uid > state.LastUID {
+		state.LastUID = msg.Uid
+	}
+	return nil
+}
+
+// fetchFlags fetches the current flags of every known message
+func (s *Syncer) fetchFlags(set *imap.SeqSet) ([]*imap.Message, error) {
+	messages := make(chan *imap.Message, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.c.UidFetch(set, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, messages)
+	}()
+
+	var result []*imap.Message
+	for msg := range messages {
+		result = append(result, msg)
+	}
+	return result, <-done
+}
+
+// fetchChangedSince runs UID FETCH with the CONDSTORE CHANGEDSINCE modifier,
+// plus VANISHED under QRESYNC, which go-imap v1 has no builder for
+func (s *Syncer) fetchChangedSince(set *imap.SeqSet, modseq uint64) ([]*imap.Message, *imap.SeqSet, error) {
+	modifier := fmt.Sprintf("(CHANGEDSINCE %d)", modseq)
+	if s.qresync {
+		modifier = fmt.Sprintf("(CHANGEDSINCE %d VANISHED)", modseq)
+	}
+
+	cmd := &RawCommand{
+		Name: "UID",
+		Args: []interface{}{imap.RawString("FETCH"), set, imap.RawString("(UID FLAGS MODSEQ)"), imap.RawString(modifier)},
+	}
+
+	messages := make(chan *imap.Message, 100)
+	fetch := &responses.Fetch{Messages: messages, SeqSet: set, Uid: true}
+	vanished := new(imap.SeqSet)
+
+	handler := responses.HandlerFunc(func(resp imap.Resp) error {
+		if name, fields, ok := imap.ParseNamedResp(resp); ok && name == "VANISHED" && len(fields) > 0 {
+			uids, err := imap.ParseSeqSet(fmt.Sprint(fields[len(fields)-1]))
+			if err != nil {
+				return err
+			}
+			vanished.AddSet(uids)
+			return nil
+		}
+		return fetch.Handle(resp)
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		status, err := s.c.Execute(cmd, handler)
+		if err == nil {
+			err = status.Err()
+		}
+		done <- err
+	}()
+
+	var result []*imap.Message
+	for msg := range messages {
+		result = append(result, msg)
+	}
+	if err := <-done; err != nil {
+		return nil, nil, fmt.Errorf("fetch changes failed: %w", err)
+	}
+	return result, vanished, nil
+}
+
+// RawCommand is an IMAP command go-imap has no type for, built from
+// already formatted arguments
+type RawCommand struct {
+	Name string
+	Args []interface{}
+}
+
+func (c *RawCommand) Command() *imap.Command {
+	return &imap.Command{Name: c.Name, Arguments: c.Args}
+}
+
+// parseModSeq reads a MODSEQ value, which may be bare or in a list and
+// doesn't fit the uint32 go-imap parses numbers into
+func parseModSeq(v interface{}) uint64 {
+	if list, ok := v.([]interface{}); ok && len(list) > 0 {
+		v = list[0]
+	}
+	if v == nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(strings.TrimSpace(fmt.Sprint(v)), 10, 64)
+	return n
+}
+
+// sameFlags compares two flag sets, ignoring order, case and \Recent
+func sameFlags(a, b []string) bool {
+	return strings.Join(flagSet(a), " ") == strings.Join(flagSet(b), " ")
+}
+
+func flagSet(flags []string) []string {
+	var out []string
+	for _, flag := range flags {
+		flag = imap.CanonicalFlag(flag)
+		if flag != imap.RecentFlag {
+			out = append(out, flag)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -2,29 +2,89 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/PlantingTrees/intent/auth"
+	"github.com/PlantingTrees/intent/daemon"
+	"github.com/PlantingTrees/intent/index"
 	engine "github.com/PlantingTrees/intent/intentEngine"
+	"github.com/PlantingTrees/intent/jmap"
+	"github.com/PlantingTrees/intent/mailsync"
+	"github.com/PlantingTrees/intent/mcp"
+	"github.com/PlantingTrees/intent/responder"
+	"github.com/PlantingTrees/intent/schedule"
+	"github.com/PlantingTrees/intent/semantic"
+	"github.com/PlantingTrees/intent/server"
+	"github.com/emersion/go-imap/client"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		runSync(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schedule" {
+		runSchedule(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "listen", "listeners", "unlisten", "hits":
+			runDaemonClient(os.Args[1], os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "mcp":
+			runMCP()
+			return
+		}
+	}
+
 	fmt.Println("=== Intent Engine Initalizing ===")
 
-	fmt.Println("Authenticating with Gmail...\n")
-	// 1. Authenticate with Gmail
-	c, err := auth.Authenticate()
-	if err != nil {
-		log.Fatal(err)
+	// 1. Create the parser, and
+	// 2. when no daemon is running, authenticate with Gmail, unless a JMAP
+	// server is configured, and create the executor
+	macros := loadMacros()
+	parser := engine.NewParser()
+	parser.SetMacros(macros)
+
+	// A running daemon holds the session, so commands and listeners run
+	// there and outlive the REPL
+	var background *daemon.Client
+	if socket, err := daemon.DefaultSocket(); err == nil {
+		if background, err = daemon.Dial(socket); err == nil {
+			defer background.Close()
+			fmt.Println("Connected to the intent daemon, commands and listeners run there")
+		}
 	}
-	defer c.Logout()
 
-	// 2. Create parser and executor
-	parser := engine.NewParser()
-	executor := engine.NewExecutor(c) // Pass the IMAP client
+	var executor *engine.Executor
+	if background == nil {
+		var closeSession func()
+		var err error
+		if executor, closeSession, err = newSession(macros, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		defer closeSession()
+	}
 
 	fmt.Println("\n=== Ready! ===")
 	fmt.Println("\nExample commands:")
@@ -37,7 +97,40 @@ func main() {
 
 	reader := bufio.NewReader(os.Stdin)
 
+	confirm := func(prompt string) bool {
+		fmt.Printf("%s [y/N] ", prompt)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+
+	// Bulk actions above the threshold ask before touching the mailbox
+	if executor != nil {
+		executor.SetConfirm(confirm, engine.DefaultConfirmThreshold)
+	}
+
+	// Messages the daemon's listeners match are shown at the next prompt
+	lastHit := 0
+	if background != nil {
+		if hits, err := background.Hits(0); err == nil && len(hits) > 0 {
+			lastHit = hits[len(hits)-1].Seq
+		}
+	}
+
+	// Free text goes through a local LLM when configured, otherwise rules
+	var llm engine.IntentTranslator
+	if url := os.Getenv("INTENT_LLM_URL"); url != "" {
+		llm = engine.NewOllamaTranslator(url, os.Getenv("INTENT_LLM_MODEL"))
+	}
+	translator := engine.NewTranslator(llm, parser)
+
 	for {
+		if background != nil {
+			lastHit = printHits(background, lastHit)
+		}
 		fmt.Print("\nIntent > ")
 
 		// Read user input
@@ -64,20 +157,60 @@ func main() {
 			for i, example := range engine.ParseExamples() {
 				fmt.Printf("  %d. %s\n", i+1, example)
 			}
+			if saved := macros.List(); len(saved) > 0 {
+				fmt.Println("\nSaved commands:")
+				for _, macro := range saved {
+					fmt.Printf("  %s\n", macro)
+				}
+			}
+			continue
+		}
+
+		if input == "listeners" {
+			if background == nil {
+				fmt.Println("No daemon running, start one with 'intent daemon'")
+				continue
+			}
+			printListeners(background)
 			continue
 		}
 
-		// Parse the intent
+		// Parse the intent, falling back to translating free text. A likely
+		// typo is pointed out instead of being sent to the translator.
 		intent, err := parser.Parse(input)
+		var perr *engine.ParseError
+		if errors.As(err, &perr) && perr.Suggestion != "" {
+			fmt.Println(perr.Render())
+			continue
+		}
+		if err != nil {
+			if translated, query, terr := translator.Translate(input); terr == nil {
+				fmt.Printf("Interpreted as: %s\n", query)
+				if confirm("Run this?") {
+					intent, err = translated, nil
+				} else {
+					continue
+				}
+			}
+		}
 		if err != nil {
+			if perr != nil {
+				fmt.Println(perr.Render())
+			} else {
+				fmt.Println(err)
+			}
 			fmt.Println("\nExpected format:")
-			fmt.Println(`  SEARCH for "keywords" from "sender" [date_range]`)
-			fmt.Println(`  LISTEN from "sender"`)
+			fmt.Println(engine.Grammar)
 			continue
 		}
 
 		fmt.Println("✓ Parsed successfully!")
 
+		if background != nil {
+			runInDaemon(background, intent, confirm)
+			continue
+		}
+
 		// Validate the intent
 		if err := executor.Validate(intent); err != nil {
 			fmt.Printf("Validation error: %v\n", err)
@@ -94,3 +227,457 @@ func main() {
 		}
 	}
 }
+
+// newSession signs in to Gmail, or connects to the JMAP server when one is
+// configured, and sets up an executor with the local state files that
+// prints to out. It returns how to close the connection.
+func newSession(macros *engine.Macros, out io.Writer) (*engine.Executor, func(), error) {
+	var c *client.Client
+	var mailServer *jmap.Client
+	closer := func() {}
+	if url := os.Getenv("INTENT_JMAP_URL"); url != "" {
+		fmt.Fprint(out, "Using JMAP server ", url, "\n\n")
+		mailServer = jmap.New(url, os.Getenv("INTENT_JMAP_TOKEN"))
+		if _, err := mailServer.Session(); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		fmt.Fprint(out, "Authenticating with Gmail...\n\n")
+		var err error
+		c, err = auth.Authenticate()
+		if err != nil {
+			return nil, nil, err
+		}
+		closer = func() { c.Logout() }
+	}
+
+	executor := engine.NewExecutor(c) // Pass the IMAP client
+	executor.SetOutput(out)
+	if mailServer != nil {
+		executor.SetJMAP(mailServer)
+	} else {
+		// Searches over all folders open extra connections to run concurrently
+		executor.SetDialer(auth.Authenticate, engine.DefaultFolderWorkers)
+	}
+	journal, err := engine.DefaultJournalPath()
+	if err != nil {
+		closer()
+		return nil, nil, err
+	}
+	executor.SetJournal(engine.NewJournal(journal, auth.Account))
+	executor.SetResponder(responder.New(responder.GmailSMTP, auth.Account, auth.Token))
+
+	// Semantic search uses a remote embeddings endpoint when configured,
+	// otherwise the built-in local embedder
+	var embedder semantic.Embedder = semantic.NewHashEmbedder()
+	if url := os.Getenv("INTENT_EMBEDDINGS_URL"); url != "" {
+		embedder = semantic.NewHTTPEmbedder(url, os.Getenv("INTENT_EMBEDDINGS_MODEL"), os.Getenv("INTENT_EMBEDDINGS_KEY"))
+	}
+	vectors, err := semantic.LoadCache("vectors.json")
+	if err != nil {
+		closer()
+		return nil, nil, err
+	}
+	executor.SetEmbedder(embedder, vectors)
+
+	ix, err := index.Open("index.gob")
+	if err != nil {
+		closer()
+		return nil, nil, err
+	}
+	executor.SetIndex(ix)
+
+	// Saved searches, macros and schedules live in the user's config directory
+	if macros != nil {
+		executor.SetMacros(macros)
+	}
+	if path, err := schedule.DefaultPath(); err != nil {
+		log.Printf("Scheduling disabled: %v", err)
+	} else {
+		executor.SetSchedule(schedule.Open(path))
+	}
+
+	return executor, closer, nil
+}
+
+// loadMacros loads the saved macros, or returns nil when they can't be
+func loadMacros() *engine.Macros {
+	path, err := engine.DefaultMacrosPath()
+	if err != nil {
+		log.Printf("Macros disabled: %v", err)
+		return nil
+	}
+	macros, err := engine.LoadMacros(path)
+	if err != nil {
+		log.Printf("Macros disabled: %v", err)
+		return nil
+	}
+	return macros
+}
+
+// runSync mirrors folders into a local Maildir: intent sync [-dir maildir] [folder...]
+func runSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	dir := flags.String("dir", "maildir", "Maildir root to sync into")
+	flags.Parse(args)
+
+	folders := flags.Args()
+	if len(folders) == 0 {
+		folders = []string{"INBOX"}
+	}
+
+	c, err := auth.Authenticate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Logout()
+
+	syncer, err := mailsync.New(c, *dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Syncing into %s using %s\n", *dir, syncer.Mode())
+
+	for _, folder := range folders {
+		stats, err := syncer.Sync(folder)
+		if err != nil {
+			log.Fatalf("sync of %s failed: %v", folder, err)
+		}
+		if stats.Rebuilt {
+			fmt.Printf("%s: UIDVALIDITY changed, downloaded again\n", folder)
+		}
+		fmt.Printf("%s: %d new, %d updated, %d removed\n", folder, stats.Added, stats.Updated, stats.Removed)
+	}
+}
+
+// runSchedule manages and runs scheduled commands:
+// intent schedule [list | remove <id> | run [-wait] [-jitter d] [-catch-up d]]
+func runSchedule(args []string) {
+	path, err := schedule.DefaultPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := schedule.Open(path)
+
+	if len(args) == 0 || args[0] == "list" {
+		jobs, err := store.Jobs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(jobs) == 0 {
+			fmt.Println(`No scheduled commands. Add one with e.g. every weekday at 08:00 run jobs notify file:~/digest.md`)
+		}
+		scheduler := schedule.New(store, nil)
+		for _, job := range jobs {
+			next, err := scheduler.Next(job)
+			if err != nil {
+				fmt.Printf("  %s. %s (%v)\n", job.ID, job, err)
+				continue
+			}
+			fmt.Printf("  %s. %s (next %s)\n", job.ID, job, next.Format("Mon 2006-01-02 15:04"))
+		}
+		return
+	}
+
+	switch args[0] {
+	case "remove":
+		if len(args) != 2 {
+			log.Fatal("usage: intent schedule remove <id>")
+		}
+		if err := store.Remove(args[1]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed job %s\n", args[1])
+	case "run":
+		flags := flag.NewFlagSet("schedule run", flag.ExitOnError)
+		wait := flags.Bool("wait", false, "Keep running jobs as they come due instead of exiting")
+		jitter := flags.Duration("jitter", 0, "Delay each run by up to this much")
+		catchUp := flags.Duration("catch-up", schedule.DefaultCatchUp, "Make up runs missed by no more than this")
+		flags.Parse(args[1:])
+
+		run, closeSession := newJobRunner()
+		scheduler := schedule.New(store, run)
+		scheduler.SetJitter(*jitter)
+		scheduler.SetCatchUp(*catchUp)
+		if *wait {
+			err := scheduler.Run(context.Background())
+			closeSession()
+			log.Fatal(err)
+		}
+		ran, err := scheduler.RunDue()
+		closeSession()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Ran %d scheduled commands\n", ran)
+	default:
+		log.Fatalf("unknown schedule command %q", args[0])
+	}
+}
+
+// newJobRunner returns a runner that executes scheduled commands, and a
+// function that closes its session. It only signs in once a job is due,
+// so frequent runs from cron stay cheap.
+func newJobRunner() (schedule.Runner, func()) {
+	var parser *engine.Parser
+	var executor *engine.Executor
+	closer := func() {}
+
+	run := func(job schedule.Job) (string, error) {
+		if executor == nil {
+			macros := loadMacros()
+			var err error
+			if executor, closer, err = newSession(macros, os.Stdout); err != nil {
+				closer = func() {}
+				return "", err
+			}
+			parser = engine.NewParser()
+			parser.SetMacros(macros)
+		}
+
+		intent, err := parser.Parse(job.Query)
+		if err != nil {
+			return "", err
+		}
+		if err := executor.Validate(intent); err != nil {
+			return "", err
+		}
+		result, err := executor.Execute(intent)
+		if err != nil {
+			return "", err
+		}
+		return engine.Digest(result), nil
+	}
+	return run, func() { closer() }
+}
+
+// runDaemon holds sessions, listeners and schedules in the background:
+// intent daemon [-socket path] [-jitter d]
+func runDaemon(args []string) {
+	socket, err := daemon.DefaultSocket()
+	if err != nil {
+		log.Fatal(err)
+	}
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	flags.StringVar(&socket, "socket", socket, "Control socket path")
+	jitter := flags.Duration("jitter", 0, "Delay each scheduled run by up to this much")
+	flags.Parse(args)
+
+	config, err := os.UserConfigDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	listeners := filepath.Join(config, "intent", "listeners.json")
+
+	d := daemon.New(socket, listeners,
+		func() (*engine.Executor, func(), error) {
+			return newSession(loadMacros(), os.Stdout)
+		},
+		func() (*engine.Parser, error) {
+			parser := engine.NewParser()
+			parser.SetMacros(loadMacros())
+			return parser, nil
+		})
+	if path, err := schedule.DefaultPath(); err == nil {
+		d.SetSchedule(schedule.Open(path), *jitter)
+	}
+
+	if err := d.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runServe serves the HTTP API: intent serve [-addr 127.0.0.1:7777]
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", server.DefaultAddr, "Address to listen on")
+	token := flags.String("token", os.Getenv("INTENT_API_TOKEN"), "Bearer token clients must send, default $INTENT_API_TOKEN")
+	flags.Parse(args)
+
+	// Without a token, make one up for this run
+	if *token == "" {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+		*token = hex.EncodeToString(b)
+		fmt.Printf("API token: %s\n", *token)
+	}
+
+	parser := engine.NewParser()
+	parser.SetMacros(loadMacros())
+	s := server.New(*token, parser, func() (*engine.Executor, func(), error) {
+		return newSession(loadMacros(), os.Stdout)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Serving the intent API on http://%s (spec at /openapi.json)", *addr)
+	if err := s.ListenAndServe(ctx, *addr); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runMCP serves the MCP tools to an assistant over stdin and stdout
+func runMCP() {
+	// The protocol owns stdout, so sign-in and the engine's progress go to
+	// stderr
+	auth.Output = os.Stderr
+
+	path, err := mcp.DefaultConfigPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := mcp.LoadConfig(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	parser := engine.NewParser()
+	parser.SetMacros(loadMacros())
+	s := mcp.New(parser, func() (*engine.Executor, func(), error) {
+		return newSession(loadMacros(), os.Stderr)
+	}, config)
+	if socket, err := daemon.DefaultSocket(); err == nil {
+		s.SetDaemon(socket)
+	}
+	defer s.Close()
+
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runDaemonClient sends a command to the daemon:
+// intent listen 'from "sender"', intent listeners, intent unlisten <id>,
+// intent hits [-follow]
+func runDaemonClient(command string, args []string) {
+	socket, err := daemon.DefaultSocket()
+	if err != nil {
+		log.Fatal(err)
+	}
+	background, err := daemon.Dial(socket)
+	if err != nil {
+		log.Fatalf("%v (start it with 'intent daemon')", err)
+	}
+	defer background.Close()
+
+	switch command {
+	case "listen":
+		query := strings.Join(args, " ")
+		if !strings.HasPrefix(strings.ToLower(query), "listen") {
+			query = "listen " + query
+		}
+		l, err := background.Listen(query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Listener %s: %s\n", l.ID, l.Query)
+	case "listeners":
+		printListeners(background)
+	case "unlisten":
+		if len(args) != 1 {
+			log.Fatal("usage: intent unlisten <id>")
+		}
+		l, err := background.Unlisten(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Stopped listener %s: %s\n", l.ID, l.Query)
+	case "hits":
+		flags := flag.NewFlagSet("hits", flag.ExitOnError)
+		follow := flags.Bool("follow", false, "Keep printing new hits until interrupted")
+		flags.Parse(args)
+
+		last := printHits(background, 0)
+		for *follow {
+			time.Sleep(2 * time.Second)
+			last = printHits(background, last)
+		}
+	}
+}
+
+// runInDaemon sends a command to the daemon and prints what it printed.
+// Listeners are handed over instead of blocking the prompt, and commands
+// the daemon stops to confirm are asked about here.
+func runInDaemon(background *daemon.Client, intent *engine.Intent, confirm func(string) bool) {
+	if intent.Command == engine.CommandListen {
+		l, err := background.Listen(intent.String())
+		if err != nil {
+			fmt.Printf("Daemon error: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ Listener %s running in the daemon, 'listeners' shows them all\n", l.ID)
+		return
+	}
+
+	// The daemon may run elsewhere, so relative paths are resolved here
+	intent.Archive = absPath(intent.Archive)
+	if intent.Command == engine.CommandExport || intent.Command == engine.CommandSaveAttachments {
+		intent.Target = absPath(intent.Target)
+	}
+
+	query := intent.String()
+	reply, err := background.Run(query)
+	if err == nil && reply.Prompt != "" {
+		fmt.Print(reply.Output)
+		if !confirm(reply.Prompt) {
+			fmt.Println("Cancelled.")
+			return
+		}
+		shown := reply.Output
+		reply, err = background.Confirm(query, reply)
+		reply.Output = strings.TrimPrefix(reply.Output, shown)
+	}
+	if err != nil {
+		fmt.Printf("Execution error: %v\n", err)
+		return
+	}
+	fmt.Print(reply.Output)
+}
+
+// absPath makes a relative path absolute, keeping a trailing slash. Paths
+// starting with ~ are left for the daemon to expand.
+func absPath(path string) string {
+	if path == "" || strings.HasPrefix(path, "~") || filepath.IsAbs(path) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasSuffix(path, "/") {
+		abs += "/"
+	}
+	return abs
+}
+
+// printHits prints the messages the daemon's listeners matched after the
+// hit numbered after, and returns the number of the last one printed
+func printHits(background *daemon.Client, after int) int {
+	hits, err := background.Hits(after)
+	if err != nil {
+		return after
+	}
+	for _, h := range hits {
+		fmt.Printf("📧 Listener %s: %s · %s · %s\n", h.Listener, h.Date.Format("2006-01-02 15:04"), h.From, h.Subject)
+		after = h.Seq
+	}
+	return after
+}
+
+// printListeners lists the daemon's listeners
+func printListeners(background *daemon.Client) {
+	list, err := background.Listeners()
+	if err != nil {
+		fmt.Printf("Daemon error: %v\n", err)
+		return
+	}
+	if len(list) == 0 {
+		fmt.Println("No listeners running")
+	}
+	for _, l := range list {
+		fmt.Printf("  %s. %s (%s since %s)\n", l.ID, l.Query, l.Status, l.Started.Format("2006-01-02 15:04"))
+	}
+}
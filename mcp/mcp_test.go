@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+	"github.com/PlantingTrees/intent/server"
+)
+
+// client drives a server over pipes, as an assistant would over stdio
+type client struct {
+	t   *testing.T
+	in  *io.PipeWriter
+	out *json.Decoder
+	id  int
+}
+
+// newTestClient serves the tools on an in-memory store, allowing the
+// actions in allow
+func newTestClient(t *testing.T, allow ...string) (*client, *engine.MemoryBackend) {
+	t.Helper()
+	store := engine.NewMemoryBackend("INBOX", "[Gmail]/All Mail")
+	session := store.Session(engine.NewJournal(filepath.Join(t.TempDir(), "journal.jsonl"), "me@example.com"))
+	s := New(engine.NewParser(), session, Config{Allow: allow})
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.Serve(inR, outW)
+		outW.Close()
+		done <- err
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return &client{t: t, in: inW, out: json.NewDecoder(outR)}, store
+}
+
+// call sends a request and decodes the result into v
+func (c *client) call(method string, params, v interface{}) {
+	c.t.Helper()
+	c.id++
+	b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if _, err := c.in.Write(append(b, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var resp struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := c.out.Decode(&resp); err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.Error != nil || resp.ID != c.id {
+		c.t.Fatalf("%s: response %+v", method, resp)
+	}
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+// callTool calls a tool with a query, returning its result
+func (c *client) callTool(name, query string, confirm bool) callResult {
+	c.t.Helper()
+	args := map[string]interface{}{"query": query}
+	if confirm {
+		args["confirm"] = true
+	}
+	var result callResult
+	c.call("tools/call", map[string]interface{}{"name": name, "arguments": args}, &result)
+	return result
+}
+
+func TestServe(t *testing.T) {
+	c, store := newTestClient(t)
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Interview", Date: time.Now().Add(-time.Hour)})
+	store.Add("INBOX", engine.Email{From: "news@other.com", Subject: "Weekly", Date: time.Now()})
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Instructions    string `json:"instructions"`
+	}
+	c.call("initialize", map[string]string{"protocolVersion": "2025-03-26"}, &init)
+	if init.ProtocolVersion != "2025-03-26" || init.Instructions == "" {
+		t.Errorf("initialize = %+v, want the client's revision and instructions", init)
+	}
+
+	var list struct {
+		Tools []tool `json:"tools"`
+	}
+	c.call("tools/list", nil, &list)
+	var names []string
+	for _, t := range list.Tools {
+		names = append(names, t.Name)
+	}
+	if want := []string{"search_mail", "get_message", "list_listeners", "draft_reply", "apply_action"}; !slices.Equal(names, want) {
+		t.Errorf("tools = %q, want %q", names, want)
+	}
+
+	result := c.callTool("search_mail", `search from "acme.com"`, false)
+	var found server.SearchResponse
+	if result.IsError || json.Unmarshal([]byte(result.Content[0].Text), &found) != nil {
+		t.Fatalf("search_mail = %+v", result)
+	}
+	if found.Count != 1 || found.Messages[0].Subject != "Interview" {
+		t.Errorf("search_mail found %+v", found)
+	}
+}
+
+func TestApplyActionAllowList(t *testing.T) {
+	c, store := newTestClient(t, "archive")
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Interview", Date: time.Now()})
+	starred := func() bool {
+		return slices.Contains(store.Messages("INBOX")[0].Flags, "\\Flagged")
+	}
+
+	result := c.callTool("apply_action", `star from "acme.com"`, false)
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "not allowed") {
+		t.Errorf("star without permission = %+v, want refused", result)
+	}
+	if starred() {
+		t.Fatal("refused action starred the message")
+	}
+
+	result = c.callTool("apply_action", `star from "acme.com" --dry-run`, false)
+	var resp server.ActionResponse
+	if result.IsError || json.Unmarshal([]byte(result.Content[0].Text), &resp) != nil {
+		t.Fatalf("dry run = %+v, want allowed", result)
+	}
+	if !resp.DryRun || resp.Count != 1 || starred() {
+		t.Errorf("dry run = %+v, starred %v", resp, starred())
+	}
+
+	if result = c.callTool("apply_action", `archive from "acme.com"`, false); result.IsError {
+		t.Errorf("allowed archive = %+v", result)
+	}
+	if n := len(store.Messages("INBOX")); n != 0 {
+		t.Errorf("%d messages left in INBOX after archiving", n)
+	}
+}
+
+func TestApplyActionConfirm(t *testing.T) {
+	c, store := newTestClient(t, "star")
+	for i := 0; i <= engine.DefaultConfirmThreshold; i++ {
+		store.Add("INBOX", engine.Email{From: "bulk@spam.com", Subject: "Sale", Date: time.Now()})
+	}
+
+	if result := c.callTool("apply_action", `star from "spam.com"`, false); !result.IsError {
+		t.Errorf("bulk action without confirm = %+v, want refused", result)
+	}
+	if result := c.callTool("apply_action", `star from "spam.com"`, true); result.IsError {
+		t.Errorf("bulk action with confirm = %+v", result)
+	}
+	for _, msg := range store.Messages("INBOX") {
+		if !slices.Contains(msg.Flags, "\\Flagged") {
+			t.Fatalf("confirmed action left %+v unstarred", msg)
+		}
+	}
+}
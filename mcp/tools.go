@@ -0,0 +1,393 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PlantingTrees/intent/daemon"
+	engine "github.com/PlantingTrees/intent/intentEngine"
+	"github.com/PlantingTrees/intent/server"
+)
+
+// instructions tell the model how to write queries
+var instructions = "Queries use the intent command grammar below. Put quotes around keywords, senders and folder names.\n\n" + engine.Grammar
+
+// Tools that take a message name it by UID and mailbox, as search_mail
+// returns them
+const (
+	messageSchema = `{
+  "type": "object",
+  "properties": {
+    "id": {"type": "integer", "minimum": 1, "description": "The message's UID, from search_mail"},
+    "mailbox": {"type": "string", "description": "The message's mailbox, from search_mail; default INBOX"}
+  },
+  "required": ["id"],
+  "additionalProperties": false
+}`
+	replySchema = `{
+  "type": "object",
+  "properties": {
+    "id": {"type": "integer", "minimum": 1, "description": "The message's UID, from search_mail"},
+    "mailbox": {"type": "string", "description": "The message's mailbox, from search_mail; default INBOX"},
+    "text": {"type": "string", "description": "The reply's body"}
+  },
+  "required": ["id", "text"],
+  "additionalProperties": false
+}`
+)
+
+// Config says which commands that change mail the tools may run. Nothing
+// is allowed unless listed, and dry runs are always allowed.
+type Config struct {
+	Allow []string `json:"allow"` // e.g. ["archive", "star", "label"]
+}
+
+// DefaultConfigPath is intent/mcp.json under the user's config directory
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "intent", "mcp.json"), nil
+}
+
+// LoadConfig reads the config at path. A missing file allows nothing.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("unable to read MCP config: %w", err)
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("corrupt MCP config %s: %w", path, err)
+	}
+
+	for _, name := range config.Allow {
+		command := engine.CommandType(strings.ToLower(name))
+		if !command.IsAction() && command != engine.CommandUndo {
+			return config, fmt.Errorf("MCP config %s: %q is not an action", path, name)
+		}
+	}
+	return config, nil
+}
+
+// Server answers MCP requests with the parser and an executor, signed in
+// on the first tool call that needs one
+type Server struct {
+	parser  *engine.Parser
+	session engine.SessionFunc
+	allow   map[engine.CommandType]bool
+	socket  string
+	tools   []*tool
+
+	executor *engine.Executor
+	closer   func()
+}
+
+// tool is a tool as tools/list describes it, and the function behind it
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations annotations     `json:"annotations"`
+
+	call func(args json.RawMessage) (interface{}, error)
+}
+
+// annotations are hints to the client about what a tool does
+type annotations struct {
+	ReadOnly    bool `json:"readOnlyHint"`
+	Destructive bool `json:"destructiveHint"`
+}
+
+// New creates a server. Actions are limited to those config allows.
+func New(parser *engine.Parser, session engine.SessionFunc, config Config) *Server {
+	s := &Server{
+		parser:  parser,
+		session: session,
+		allow:   make(map[engine.CommandType]bool),
+	}
+	for _, name := range config.Allow {
+		s.allow[engine.CommandType(strings.ToLower(name))] = true
+	}
+
+	// Commands go in as query text or as an intent in its JSON form
+	querySchema := func(extra string) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "A command in the intent grammar"},
+    "intent": %s%s
+  },
+  "additionalProperties": false
+}`, engine.IntentSchema, extra))
+	}
+
+	s.tools = []*tool{
+		{
+			Name:        "search_mail",
+			Description: "Search the mailbox, e.g. `search for \"invoice\" from \"*@acme.com\" [last 30 days]`. Returns the matching messages without bodies.",
+			InputSchema: querySchema(""),
+			Annotations: annotations{ReadOnly: true},
+			call:        s.searchMail,
+		},
+		{
+			Name:        "get_message",
+			Description: "Fetch one message with its body. It stays unread.",
+			InputSchema: json.RawMessage(messageSchema),
+			Annotations: annotations{ReadOnly: true},
+			call:        s.getMessage,
+		},
+		{
+			Name:        "list_listeners",
+			Description: "List the listeners running in the intent daemon.",
+			InputSchema: json.RawMessage(`{"type": "object", "additionalProperties": false}`),
+			Annotations: annotations{ReadOnly: true},
+			call:        s.listListeners,
+		},
+		{
+			Name:        "draft_reply",
+			Description: "Save a reply to a message in Drafts for the user to review. Nothing is sent.",
+			InputSchema: json.RawMessage(replySchema),
+			call:        s.draftReply,
+		},
+		{
+			Name:        "apply_action",
+			Description: s.actionDescription(),
+			InputSchema: querySchema(`,
+    "confirm": {"type": "boolean", "description": "Allow actions on more than 10 messages"}`),
+			Annotations: annotations{Destructive: true},
+			call:        s.applyAction,
+		},
+	}
+	return s
+}
+
+// SetDaemon sets the socket of the daemon whose listeners are listed
+func (s *Server) SetDaemon(socket string) {
+	s.socket = socket
+}
+
+// Close closes the session, if one was opened
+func (s *Server) Close() {
+	if s.closer != nil {
+		s.closer()
+	}
+}
+
+func (s *Server) tool(name string) *tool {
+	for _, t := range s.tools {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// actionDescription tells the model which actions it may run
+func (s *Server) actionDescription() string {
+	desc := "Archive, trash, star, label or move the messages a query matches, or undo an earlier action. Add --dry-run to see what would change. "
+	if len(s.allow) == 0 {
+		return desc + "Only dry runs are allowed; the user has not enabled any actions."
+	}
+	var allowed []string
+	for command := range s.allow {
+		allowed = append(allowed, string(command))
+	}
+	sort.Strings(allowed)
+	return desc + "Allowed without --dry-run: " + strings.Join(allowed, ", ") + "."
+}
+
+// queryArgs are the arguments of tools that take a command
+type queryArgs struct {
+	Query   string         `json:"query"`
+	Intent  *engine.Intent `json:"intent"`
+	Confirm bool           `json:"confirm"`
+}
+
+// messageArgs are the arguments of tools that take a message
+type messageArgs struct {
+	ID      uint32 `json:"id"`
+	Mailbox string `json:"mailbox"`
+	Text    string `json:"text"`
+}
+
+func (s *Server) searchMail(raw json.RawMessage) (interface{}, error) {
+	intent, _, err := s.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if intent.Command != engine.CommandSearch {
+		return nil, fmt.Errorf("%s is not a search; search_mail only searches", intent.Command)
+	}
+
+	e, err := s.executorFor(intent)
+	if err != nil {
+		return nil, err
+	}
+	result, err := e.Execute(intent)
+	if err != nil {
+		return nil, err
+	}
+	return server.NewSearchResponse(intent, result), nil
+}
+
+func (s *Server) getMessage(raw json.RawMessage) (interface{}, error) {
+	args, err := readMessageArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.executorFor(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := e.Message(args.Mailbox, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	m := server.NewMessage(*msg)
+	m.Body = msg.Body
+	return m, nil
+}
+
+func (s *Server) listListeners(raw json.RawMessage) (interface{}, error) {
+	if s.socket == "" {
+		return nil, fmt.Errorf("no daemon configured")
+	}
+	client, err := daemon.Dial(s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("%v (the user can start it with 'intent daemon')", err)
+	}
+	defer client.Close()
+
+	list, err := client.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []daemon.Listener{}
+	}
+	return map[string]interface{}{"listeners": list}, nil
+}
+
+func (s *Server) draftReply(raw json.RawMessage) (interface{}, error) {
+	args, err := readMessageArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.executorFor(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.DraftReply(args.Mailbox, args.ID, args.Text); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"drafted": true, "id": args.ID, "mailbox": args.Mailbox}, nil
+}
+
+func (s *Server) applyAction(raw json.RawMessage) (interface{}, error) {
+	intent, args, err := s.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !intent.Command.IsAction() && intent.Command != engine.CommandUndo {
+		return nil, fmt.Errorf("%s is not an action", intent.Command)
+	}
+	if !intent.DryRun && !s.allow[intent.Command] {
+		return nil, fmt.Errorf("%s is not allowed; add --dry-run to preview it, or ask the user to allow it in the MCP config", intent.Command)
+	}
+
+	e, err := s.executorFor(intent)
+	if err != nil {
+		return nil, err
+	}
+	var refused string
+	e.SetConfirm(func(prompt string) bool {
+		if !args.Confirm {
+			refused = prompt
+		}
+		return args.Confirm
+	}, engine.DefaultConfirmThreshold)
+	result, err := e.Execute(intent)
+	if err != nil {
+		return nil, err
+	}
+	if refused != "" {
+		return nil, fmt.Errorf("%s: call again with confirm to go ahead", strings.TrimSpace(refused))
+	}
+
+	return server.ActionResponse{
+		Query:     intent.String(),
+		Count:     result.Count,
+		DryRun:    intent.DryRun,
+		JournalID: result.JournalID,
+		Messages:  server.NewMessages(result.Messages),
+	}, nil
+}
+
+// parse reads a command from tool arguments, as query text or an intent.
+// Parse errors come back with the caret and suggestions, for the model to
+// correct itself.
+func (s *Server) parse(raw json.RawMessage) (*engine.Intent, queryArgs, error) {
+	var args queryArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, args, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	query := args.Query
+	if args.Intent != nil {
+		query = args.Intent.String()
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, args, fmt.Errorf("query or intent is required")
+	}
+
+	intent, err := s.parser.Parse(query)
+	var perr *engine.ParseError
+	if errors.As(err, &perr) {
+		return nil, args, fmt.Errorf("%s\n\n%s", perr.Render(), engine.Grammar)
+	}
+	return intent, args, err
+}
+
+// executorFor returns the session's executor, signing in on first use, and
+// checks it can run intent
+func (s *Server) executorFor(intent *engine.Intent) (*engine.Executor, error) {
+	if s.executor == nil {
+		e, closer, err := s.session()
+		if err != nil {
+			return nil, err
+		}
+		s.executor, s.closer = e, closer
+	}
+	if intent != nil {
+		if err := s.executor.Validate(intent); err != nil {
+			return nil, err
+		}
+	}
+	return s.executor, nil
+}
+
+func readMessageArgs(raw json.RawMessage) (messageArgs, error) {
+	var args messageArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return args, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.ID == 0 {
+		return args, fmt.Errorf("id is required")
+	}
+	if args.Mailbox == "" {
+		args.Mailbox = "INBOX"
+	}
+	return args, nil
+}
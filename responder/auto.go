@@ -0,0 +1,205 @@
+package responder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Defaults for the auto-responder limits
+const (
+	DefaultMaxPerHour = 20
+	DefaultCooldown   = 24 * time.Hour
+)
+
+// automatedSenders are local parts that never read replies
+var automatedSenders = []string{"noreply", "no-reply", "donotreply", "do-not-reply", "mailer-daemon", "postmaster"}
+
+// SentResponse is one line of the auto-responder log
+type SentResponse struct {
+	Time      time.Time `json:"time"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	MessageID string    `json:"message_id"` // The message that was answered
+	Thread    string    `json:"thread"`
+	Template  string    `json:"template"`
+}
+
+// AutoResponder answers matching messages with a template, at most once per
+// thread, and refuses anything that looks automated
+type AutoResponder struct {
+	MaxPerHour int           // Replies allowed in any rolling hour
+	Cooldown   time.Duration // Minimum gap between replies to one sender
+
+	responder *Responder
+	tmpl      *template.Template
+	logPath   string
+
+	mu       sync.Mutex
+	recent   []time.Time          // Send times within the last hour
+	lastSent map[string]time.Time // By sender address
+	threads  map[string]bool      // Threads already answered
+}
+
+// NewAutoResponder creates an auto-responder that logs to logPath. Earlier
+// entries in the log are replayed, so threads stay answered across restarts.
+func NewAutoResponder(r *Responder, tmpl *template.Template, logPath string) (*AutoResponder, error) {
+	a := &AutoResponder{
+		MaxPerHour: DefaultMaxPerHour,
+		Cooldown:   DefaultCooldown,
+		responder:  r,
+		tmpl:       tmpl,
+		logPath:    logPath,
+		lastSent:   make(map[string]time.Time),
+		threads:    make(map[string]bool),
+	}
+
+	f, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sent SentResponse
+		if err := json.Unmarshal(scanner.Bytes(), &sent); err != nil {
+			continue
+		}
+		if sent.Thread != "" {
+			a.threads[sent.Thread] = true
+		}
+		if sent.Time.After(a.lastSent[sent.To]) {
+			a.lastSent[sent.To] = sent.Time
+		}
+		if time.Since(sent.Time) < time.Hour {
+			a.recent = append(a.recent, sent.Time)
+		}
+	}
+
+	return a, scanner.Err()
+}
+
+// Respond auto-replies to orig. It returns whether a reply was sent and,
+// when it wasn't, why not.
+func (a *AutoResponder) Respond(orig *Original) (bool, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if reason := a.skipReason(orig); reason != "" {
+		return false, reason, nil
+	}
+
+	now := time.Now()
+	sender := strings.ToLower(orig.From.Address)
+	thread := orig.ThreadID()
+
+	// A message without Message-ID or reply headers has no thread to
+	// remember, so only the sender cooldown applies
+	if thread != "" && a.threads[thread] {
+		return false, "thread already answered", nil
+	}
+	if last, ok := a.lastSent[sender]; ok && now.Sub(last) < a.Cooldown {
+		return false, fmt.Sprintf("sender in cooldown until %s", last.Add(a.Cooldown).Format("2006-01-02 15:04")), nil
+	}
+
+	kept := a.recent[:0]
+	for _, t := range a.recent {
+		if now.Sub(t) < time.Hour {
+			kept = append(kept, t)
+		}
+	}
+	a.recent = kept
+	if len(a.recent) >= a.MaxPerHour {
+		return false, "hourly rate limit reached", nil
+	}
+
+	body, err := Render(a.tmpl, VarsFor(orig))
+	if err != nil {
+		return false, "", err
+	}
+	msg, err := BuildReply(a.responder.Account(), orig, body)
+	if err != nil {
+		return false, "", err
+	}
+
+	// RFC 3834: mark the reply so other responders don't answer it
+	msg = append([]byte("Auto-Submitted: auto-replied\r\n"), msg...)
+
+	if err := a.responder.Send([]string{orig.From.Address}, msg); err != nil {
+		return false, "", err
+	}
+
+	if thread != "" {
+		a.threads[thread] = true
+	}
+	a.lastSent[sender] = now
+	a.recent = append(a.recent, now)
+
+	return true, "", a.log(SentResponse{
+		Time:      now,
+		To:        orig.From.Address,
+		Subject:   ReplySubject(orig.Subject),
+		MessageID: orig.MessageID,
+		Thread:    thread,
+		Template:  a.tmpl.Name(),
+	})
+}
+
+// skipReason is the loop guard: it explains why orig must never be
+// auto-answered, or returns "" when replying is safe
+func (a *AutoResponder) skipReason(orig *Original) string {
+	h := orig.Header
+
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return "auto-submitted message"
+	}
+	// A null reverse-path marks bounces and other notices (RFC 3834)
+	for _, path := range h.Values("Return-Path") {
+		if strings.Join(strings.Fields(path), "") == "<>" {
+			return "null return path"
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		return "bulk or list precedence"
+	}
+	if h.Get("List-Id") != "" || h.Get("List-Unsubscribe") != "" {
+		return "mailing list message"
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return "auto-reply"
+	}
+
+	sender := strings.ToLower(orig.From.Address)
+	if sender == strings.ToLower(a.responder.Account()) {
+		return "sent by this account"
+	}
+	local, _, _ := strings.Cut(sender, "@")
+	for _, automated := range automatedSenders {
+		if local == automated {
+			return "automated sender"
+		}
+	}
+
+	return ""
+}
+
+// log appends a sent response to the response log
+func (a *AutoResponder) log(sent SentResponse) error {
+	f, err := os.OpenFile(a.logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to write response log: %w", err)
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(sent)
+}
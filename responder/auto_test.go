@@ -0,0 +1,74 @@
+package responder
+
+import (
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func newTestAutoResponder(t *testing.T) *AutoResponder {
+	t.Helper()
+	addr, _ := serveSMTP(t)
+	r := New(addr, "me@example.com", func() (string, error) { return "token", nil })
+	tmpl := template.Must(template.New("ack").Parse("Thanks, {{.SenderAddress}}."))
+
+	a, err := NewAutoResponder(r, tmpl, filepath.Join(t.TempDir(), "responses.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestRespondWithoutThreadHeaders(t *testing.T) {
+	a := newTestAutoResponder(t)
+
+	// Neither message has a Message-ID or reply headers, so they share no
+	// thread and each sender gets an answer
+	for _, sender := range []string{"ann@example.org", "bob@example.org"} {
+		orig := &Original{From: &mail.Address{Address: sender}, Subject: "Hello", Header: textproto.MIMEHeader{}}
+		sent, reason, err := a.Respond(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sent {
+			t.Errorf("no reply to %s: %s", sender, reason)
+		}
+	}
+}
+
+func TestRespondOncePerThread(t *testing.T) {
+	a := newTestAutoResponder(t)
+
+	first := &Original{MessageID: "<1@example.org>", From: &mail.Address{Address: "ann@example.org"}, Header: textproto.MIMEHeader{}}
+	if sent, reason, err := a.Respond(first); err != nil || !sent {
+		t.Fatalf("first message: sent=%v reason=%q err=%v", sent, reason, err)
+	}
+
+	reply := &Original{
+		MessageID:  "<2@example.org>",
+		References: []string{"<1@example.org>"},
+		From:       &mail.Address{Address: "bob@example.org"},
+		Header:     textproto.MIMEHeader{},
+	}
+	if sent, reason, _ := a.Respond(reply); sent || reason != "thread already answered" {
+		t.Errorf("second message in the thread: sent=%v reason=%q", sent, reason)
+	}
+}
+
+func TestSkipNullReturnPath(t *testing.T) {
+	a := newTestAutoResponder(t)
+
+	for _, path := range []string{"<>", " < > "} {
+		orig := &Original{From: &mail.Address{Address: "ann@example.org"}, Header: textproto.MIMEHeader{"Return-Path": {path}}}
+		if sent, reason, _ := a.Respond(orig); sent || reason != "null return path" {
+			t.Errorf("Return-Path %q: sent=%v reason=%q", path, sent, reason)
+		}
+	}
+
+	orig := &Original{From: &mail.Address{Address: "ann@example.org"}, Header: textproto.MIMEHeader{"Return-Path": {"<ann@example.org>"}}}
+	if sent, reason, err := a.Respond(orig); err != nil || !sent {
+		t.Errorf("ordinary Return-Path: sent=%v reason=%q err=%v", sent, reason, err)
+	}
+}
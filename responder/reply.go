@@ -0,0 +1,167 @@
+package responder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Original is the message being replied to
+type Original struct {
+	MessageID  string
+	References []string
+	From       *mail.Address // Who the reply goes to (Reply-To, else From)
+	Subject    string
+	Date       time.Time
+	Text       string
+	Header     textproto.MIMEHeader // All top-level headers of the original
+}
+
+// ParseOriginal reads a raw RFC 5322 message into the fields a reply needs
+func ParseOriginal(r io.Reader) (*Original, error) {
+	env, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse message: %w", err)
+	}
+
+	orig := &Original{
+		MessageID:  strings.TrimSpace(env.GetHeader("Message-Id")),
+		References: strings.Fields(env.GetHeader("References")),
+		Subject:    env.GetHeader("Subject"),
+		Text:       env.Text,
+		Header:     textproto.MIMEHeader{},
+	}
+	if env.Root != nil {
+		orig.Header = env.Root.Header
+	}
+
+	// Reply-To wins over From when the sender asked for it
+	for _, key := range []string{"Reply-To", "From"} {
+		if addrs, err := env.AddressList(key); err == nil && len(addrs) > 0 {
+			orig.From = addrs[0]
+			break
+		}
+	}
+	if orig.From == nil {
+		return nil, fmt.Errorf("message has no sender to reply to")
+	}
+
+	if date, err := mail.ParseDate(env.GetHeader("Date")); err == nil {
+		orig.Date = date
+	}
+
+	return orig, nil
+}
+
+// BuildReply builds an RFC 5322 reply to orig from the given address, with
+// threading headers and the original text quoted below the body
+func BuildReply(from string, orig *Original, body string) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+
+	messageID, err := newMessageID(fromAddr.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", fromAddr.String())
+	writeHeader(&buf, "To", orig.From.String())
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", ReplySubject(orig.Subject)))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	if orig.MessageID != "" {
+		writeHeader(&buf, "In-Reply-To", orig.MessageID)
+		writeHeader(&buf, "References", strings.Join(append(orig.References, orig.MessageID), " "))
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+	writeHeader(&buf, "Content-Type", "text/plain; charset=utf-8")
+	writeHeader(&buf, "Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		buf.WriteString(strings.TrimRight(line, "\r") + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(Quote(orig))
+
+	return buf.Bytes(), nil
+}
+
+// ThreadID returns the Message-ID of the first message in the original's
+// thread, or its own Message-ID when it starts one
+func (o *Original) ThreadID() string {
+	if len(o.References) > 0 {
+		return o.References[0]
+	}
+	if inReplyTo := strings.TrimSpace(o.Header.Get("In-Reply-To")); inReplyTo != "" {
+		return inReplyTo
+	}
+	return o.MessageID
+}
+
+// ReplySubject prefixes subject with "Re: " unless it already has one
+func ReplySubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if len(subject) >= 3 && strings.EqualFold(subject[:3], "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+// Quote renders the original text as a quoted attribution block
+func Quote(orig *Original) string {
+	var buf strings.Builder
+
+	who := orig.From.Name
+	if who == "" {
+		who = orig.From.Address
+	}
+	if orig.Date.IsZero() {
+		fmt.Fprintf(&buf, "%s wrote:\r\n", who)
+	} else {
+		fmt.Fprintf(&buf, "On %s, %s wrote:\r\n", orig.Date.Format("Mon, Jan 2, 2006 at 3:04 PM"), who)
+	}
+
+	text := strings.ReplaceAll(strings.TrimRight(orig.Text, "\r\n"), "\r\n", "\n")
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ">") {
+			buf.WriteString(">" + line + "\r\n")
+		} else {
+			buf.WriteString("> " + line + "\r\n")
+		}
+	}
+
+	return buf.String()
+}
+
+// writeHeader writes a single unfolded header field
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + value + "\r\n")
+}
+
+// newMessageID generates a unique Message-ID in the sender's domain
+func newMessageID(address string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate Message-ID: %w", err)
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		domain = address[at+1:]
+	}
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().Unix(), hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,86 @@
+package responder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// GmailSMTP is Gmail's submission endpoint (STARTTLS)
+const GmailSMTP = "smtp.gmail.com:587"
+
+// draftsMailbox is where Gmail keeps drafts
+const draftsMailbox = "[Gmail]/Drafts"
+
+// Responder sends replies over SMTP, or saves them as drafts over IMAP
+type Responder struct {
+	addr    string
+	account string
+	token   func() (string, error)
+}
+
+// New creates a responder that submits through addr as account, getting a
+// fresh OAuth2 access token from token for each message
+func New(addr, account string, token func() (string, error)) *Responder {
+	return &Responder{
+		addr:    addr,
+		account: account,
+		token:   token,
+	}
+}
+
+// Account returns the address replies are sent from
+func (r *Responder) Account() string {
+	return r.account
+}
+
+// Send submits msg to the recipients over SMTP with XOAUTH2
+func (r *Responder) Send(to []string, msg []byte) error {
+	token, err := r.token()
+	if err != nil {
+		return fmt.Errorf("unable to get access token: %w", err)
+	}
+
+	auth := &xoauth2Auth{username: r.account, token: token}
+	if err := smtp.SendMail(r.addr, auth, r.account, to, msg); err != nil {
+		return fmt.Errorf("send failed: %w", err)
+	}
+	return nil
+}
+
+// SaveDraft appends msg to the Drafts mailbox with IMAP APPEND
+func (r *Responder) SaveDraft(c *client.Client, msg []byte) error {
+	if err := c.Append(draftsMailbox, []string{imap.DraftFlag}, time.Now(), bytes.NewBuffer(msg)); err != nil {
+		return fmt.Errorf("unable to save draft: %w", err)
+	}
+	return nil
+}
+
+// xoauth2Auth implements the SASL XOAUTH2 mechanism for net/smtp
+type xoauth2Auth struct {
+	username string
+	token    string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Never send a bearer token in the clear, except to a local server
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" {
+		return "", nil, errors.New("XOAUTH2 requires an encrypted connection")
+	}
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.token)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sent a JSON error; an empty reply makes it finish with
+		// the failure status
+		return []byte{}, nil
+	}
+	return nil, nil
+}
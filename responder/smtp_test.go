@@ -0,0 +1,149 @@
+package responder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what a stand-in SMTP server received
+type smtpSession struct {
+	auth string // Decoded AUTH XOAUTH2 response
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts submissions on a local port, offering only XOAUTH2,
+// and returns the address and each session as it ends
+func serveSMTP(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan smtpSession, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			done <- session(conn)
+		}
+	}()
+
+	return ln.Addr().String(), done
+}
+
+// session runs one SMTP conversation until QUIT or the connection drops
+func session(conn net.Conn) smtpSession {
+	defer conn.Close()
+
+	var s smtpSession
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH XOAUTH2")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			s.auth = string(decoded)
+			reply("235 2.7.0 Accepted")
+		case "MAIL":
+			s.from = arg
+			reply("250 OK")
+		case "RCPT":
+			s.to = append(s.to, arg)
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return s
+		default:
+			reply("502 Not implemented")
+		}
+	}
+	return s
+}
+
+func TestSendReply(t *testing.T) {
+	addr, done := serveSMTP(t)
+
+	orig := &Original{
+		MessageID:  "<second@example.org>",
+		References: []string{"<first@example.org>"},
+		From:       &mail.Address{Name: "Recruiter", Address: "jobs@example.org"},
+		Subject:    "Interview",
+		Text:       "When are you free?",
+	}
+	msg, err := BuildReply("me@example.com", orig, "Tuesday works.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(addr, "me@example.com", func() (string, error) { return "token-123", nil })
+	if err := r.Send([]string{orig.From.Address}, msg); err != nil {
+		t.Fatal(err)
+	}
+	s := <-done
+
+	if want := "user=me@example.com\x01auth=Bearer token-123\x01\x01"; s.auth != want {
+		t.Errorf("XOAUTH2 response = %q, want %q", s.auth, want)
+	}
+	if s.from != "FROM:<me@example.com>" || len(s.to) != 1 || s.to[0] != "TO:<jobs@example.org>" {
+		t.Errorf("envelope = %s %v", s.from, s.to)
+	}
+
+	sent, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("unable to read the sent message: %v", err)
+	}
+	if got := sent.Header.Get("In-Reply-To"); got != "<second@example.org>" {
+		t.Errorf("In-Reply-To = %q", got)
+	}
+	if got := sent.Header.Get("References"); got != "<first@example.org> <second@example.org>" {
+		t.Errorf("References = %q", got)
+	}
+	if got := sent.Header.Get("Subject"); got != "Re: Interview" {
+		t.Errorf("Subject = %q", got)
+	}
+}
+
+func TestXOAUTH2NeedsTLS(t *testing.T) {
+	auth := &xoauth2Auth{username: "me@example.com", token: "token-123"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false}); err == nil {
+		t.Error("XOAUTH2 sent a token over a plain connection to a remote server")
+	}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true}); err != nil {
+		t.Errorf("XOAUTH2 over TLS: %v", err)
+	}
+}
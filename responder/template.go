@@ -0,0 +1,147 @@
+package responder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// TemplateVars are the per-message values available to reply templates
+type TemplateVars struct {
+	SenderName    string    // Display name, or the local part of the address
+	SenderAddress string    // Bare email address
+	Company       string    // Guessed from the sender's domain
+	Subject       string    // Original subject
+	Date          time.Time // When the original was sent
+	Dates         []string  // Dates mentioned in the original body
+	Today         string
+}
+
+// datePatterns match the date forms commonly found in scheduling mail
+var datePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`),
+	regexp.MustCompile(`\b\d{1,2}/\d{1,2}/\d{2,4}\b`),
+	regexp.MustCompile(`(?i)\b(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{1,2}(?:st|nd|rd|th)?(?:,?\s+\d{4})?\b`),
+	regexp.MustCompile(`(?i)\b\d{1,2}(?:st|nd|rd|th)?\s+(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?(?:\s+\d{4})?\b`),
+}
+
+// mailSubdomains are host labels that say nothing about the company
+var mailSubdomains = map[string]bool{
+	"mail": true, "email": true, "e": true, "em": true, "news": true,
+	"careers": true, "jobs": true, "noreply": true, "notifications": true,
+}
+
+// secondLevelSuffixes sit between a company name and a country TLD
+var secondLevelSuffixes = map[string]bool{
+	"co": true, "com": true, "org": true, "net": true, "ac": true, "gov": true, "edu": true,
+}
+
+// LoadTemplate reads the template <name>.tmpl from dir
+func LoadTemplate(dir, name string) (*template.Template, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid template name: %s", name)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read template %q: %w", name, err)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// VarsFor extracts the template variables from a message
+func VarsFor(orig *Original) TemplateVars {
+	vars := TemplateVars{
+		SenderName:    orig.From.Name,
+		SenderAddress: orig.From.Address,
+		Subject:       orig.Subject,
+		Date:          orig.Date,
+		Dates:         extractDates(orig.Text),
+		Today:         time.Now().Format("January 2, 2006"),
+	}
+
+	local, domain, _ := strings.Cut(orig.From.Address, "@")
+	if vars.SenderName == "" {
+		vars.SenderName = local
+	}
+	vars.Company = companyFromDomain(domain)
+
+	return vars
+}
+
+// Render executes the template for one message
+func Render(tmpl *template.Template, vars TemplateVars) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("unable to render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// companyFromDomain guesses a company name from a sender domain,
+// e.g. "careers.acme-corp.com" becomes "Acme Corp"
+func companyFromDomain(domain string) string {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	if len(labels) < 2 {
+		return domain
+	}
+
+	// Drop the TLD, plus a second-level suffix like "co" in "acme.co.uk"
+	labels = labels[:len(labels)-1]
+	if len(labels) > 1 && secondLevelSuffixes[labels[len(labels)-1]] {
+		labels = labels[:len(labels)-1]
+	}
+	for len(labels) > 1 && mailSubdomains[labels[0]] {
+		labels = labels[1:]
+	}
+
+	name := labels[len(labels)-1]
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' })
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+// extractDates returns the distinct dates mentioned in text, in order
+func extractDates(text string) []string {
+	type match struct {
+		pos  int
+		text string
+	}
+
+	var matches []match
+	for _, p := range datePatterns {
+		for _, loc := range p.FindAllStringIndex(text, -1) {
+			matches = append(matches, match{loc[0], text[loc[0]:loc[1]]})
+		}
+	}
+
+	// Order by position, so the first date in the mail comes first
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].pos < matches[j].pos
+	})
+
+	seen := make(map[string]bool)
+	dates := []string{}
+	for _, m := range matches {
+		if !seen[m.text] {
+			seen[m.text] = true
+			dates = append(dates, m.text)
+		}
+	}
+	return dates
+}
@@ -0,0 +1,281 @@
+package schedule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed schedule: the minutes, hours, days of the month, months
+// and weekdays it fires on, in one time zone
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+
+	// Vixie cron fires on either day field when both are restricted
+	domStar, dowStar bool
+
+	loc *time.Location
+}
+
+// field describes one of the five cron fields
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{0, 59, nil}
+	hourField   = field{0, 23, nil}
+	domField    = field{1, 31, nil}
+	monthField  = field{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Schedules written in words
+var (
+	everyNPattern   = regexp.MustCompile(`^every\s+(\d+)\s+(minute|hour)s?$`)
+	everyDayPattern = regexp.MustCompile(`^every\s+([a-z,\s]+?)(?:\s+at\s+([\d:,\s]+))?$`)
+	tzPattern       = regexp.MustCompile(`(?i)(?:^|\s)tz:(\S+)`)
+)
+
+// everyDays maps the day words of "every ..." to cron weekday fields
+var everyDays = map[string]string{
+	"day": "*", "weekday": "1-5", "weekend": "0,6",
+	"sunday": "0", "monday": "1", "tuesday": "2", "wednesday": "3",
+	"thursday": "4", "friday": "5", "saturday": "6",
+}
+
+// Parse parses a schedule, either a five-field cron expression such as
+// "0 8 * * 1-5" or words such as "every weekday at 08:00". A "tz:Zone"
+// modifier sets the time zone; the default is local time.
+func Parse(spec string) (*Cron, error) {
+	loc := time.Local
+	if m := tzPattern.FindStringSubmatch(spec); m != nil {
+		var err error
+		if loc, err = time.LoadLocation(m[1]); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", m[1])
+		}
+		spec = strings.Replace(spec, m[0], "", 1)
+	}
+	spec = strings.Join(strings.Fields(strings.ToLower(spec)), " ")
+
+	expr := spec
+	if strings.HasPrefix(spec, "every ") {
+		var err error
+		if expr, err = everyToCron(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.loc = loc
+	return c, nil
+}
+
+// everyToCron turns "every ..." into a cron expression. Day schedules run
+// at midnight unless given times.
+func everyToCron(spec string) (string, error) {
+	switch spec {
+	case "every minute":
+		return "* * * * *", nil
+	case "every hour":
+		return "0 * * * *", nil
+	}
+
+	if m := everyNPattern.FindStringSubmatch(spec); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "minute" {
+			if n < 1 || n > 59 {
+				return "", fmt.Errorf("every %d minutes is out of range", n)
+			}
+			return fmt.Sprintf("*/%d * * * *", n), nil
+		}
+		if n < 1 || n > 23 {
+			return "", fmt.Errorf("every %d hours is out of range", n)
+		}
+		return fmt.Sprintf("0 */%d * * *", n), nil
+	}
+
+	m := everyDayPattern.FindStringSubmatch(spec)
+	if m == nil {
+		return "", fmt.Errorf("unrecognized schedule: %s", spec)
+	}
+
+	var days []string
+	for _, word := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+		if word == "and" {
+			continue
+		}
+		day, ok := everyDays[strings.TrimSuffix(word, "s")]
+		if !ok {
+			return "", fmt.Errorf("unknown day %q", word)
+		}
+		days = append(days, day)
+	}
+
+	minutes, hours := "0", "0"
+	if m[2] != "" {
+		var mins, hrs []string
+		for _, at := range strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ' ' }) {
+			t, err := time.Parse("15:04", at)
+			if err != nil {
+				return "", fmt.Errorf("invalid time %q, use HH:MM", at)
+			}
+			mins = append(mins, strconv.Itoa(t.Minute()))
+			hrs = append(hrs, strconv.Itoa(t.Hour()))
+		}
+		// Several times must share their minute to fit one expression
+		for _, min := range mins {
+			if min != mins[0] {
+				return "", fmt.Errorf("times in one schedule must be on the same minute")
+			}
+		}
+		minutes, hours = mins[0], strings.Join(hrs, ",")
+	}
+
+	return fmt.Sprintf("%s %s * * %s", minutes, hours, strings.Join(days, ",")), nil
+}
+
+// parseCron parses the five fields of a cron expression
+func parseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	c := &Cron{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		def  field
+	}{
+		{&c.minute, minuteField},
+		{&c.hour, hourField},
+		{&c.dom, domField},
+		{&c.month, monthField},
+		{&c.dow, dowField},
+	} {
+		if *f.bits, err = parseField(fields[i], f.def); err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %w", fields[i], err)
+		}
+	}
+
+	// Sunday may be written as 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseField parses a list of values, ranges and steps into a bit set
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step %q", part[i+1:])
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = fieldValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = fieldValue(bounds[1], f); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %s is backwards", part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// fieldValue parses a number or name within a field's bounds
+func fieldValue(s string, f field) (int, error) {
+	if v, ok := f.names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time the schedule fires after t
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+
+	// Skip whole months, days and hours that can't match; give up after
+	// five years, which only an impossible date like Feb 30 reaches
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule for the two day fields
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrLocked is returned when another process is running the job
+var ErrLocked = errors.New("job is already running")
+
+// staleLock is how old a lock may get before its holder is assumed dead
+const staleLock = 6 * time.Hour
+
+// lock takes the lock file at path, so a job never runs twice at once
+// even when the daemon and system cron overlap. Locks older than
+// staleLock at now are broken.
+func lock(path string, now time.Time) (func(), error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			fmt.Fprintln(f, strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("unable to lock job: %w", err)
+		}
+
+		// Break locks left behind by a crash
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) < staleLock {
+			return nil, ErrLocked
+		}
+		os.Remove(path)
+	}
+	return nil, ErrLocked
+}
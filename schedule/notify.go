@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkTarget rejects notify targets that can't be delivered to
+func checkTarget(target string) error {
+	switch {
+	case target == "", target == "stdout":
+		return nil
+	case strings.HasPrefix(target, "file:") && len(target) > len("file:"):
+		return nil
+	}
+	return fmt.Errorf("unknown notify target %q, use stdout or file:path", target)
+}
+
+// deliver sends a job's output to its notify target. Files get a
+// Markdown section appended for each run, building up a digest.
+func deliver(job Job, at time.Time, output string) error {
+	section := fmt.Sprintf("## %s — %s\n\n%s\n\n", job.Query, at.Format("Mon 2006-01-02 15:04"), strings.TrimSpace(output))
+
+	if !strings.HasPrefix(job.Notify, "file:") {
+		fmt.Print(section)
+		return nil
+	}
+
+	path := strings.TrimPrefix(job.Notify, "file:")
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(section); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
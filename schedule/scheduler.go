@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultCatchUp is how late a missed run may still be made up
+const DefaultCatchUp = 24 * time.Hour
+
+// pollInterval bounds how long the loop sleeps, so jobs added by another
+// process are picked up
+const pollInterval = time.Minute
+
+// Runner runs a job's command and returns the text to deliver
+type Runner func(job Job) (string, error)
+
+// Scheduler runs the jobs in a store as they come due
+type Scheduler struct {
+	store   *Store
+	run     Runner
+	clock   Clock
+	jitter  time.Duration
+	catchUp time.Duration
+}
+
+// New creates a scheduler for the jobs in store
+func New(store *Store, run Runner) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		run:     run,
+		clock:   SystemClock{},
+		catchUp: DefaultCatchUp,
+	}
+}
+
+// SetClock sets the clock that decides when jobs are due, for the
+// scheduler and its store
+func (s *Scheduler) SetClock(c Clock) {
+	s.clock = c
+	s.store.SetClock(c)
+}
+
+// SetJitter delays each run by up to d, so jobs sharing a schedule don't
+// all hit the server at once. The delay is fixed for a job and time.
+func (s *Scheduler) SetJitter(d time.Duration) {
+	s.jitter = d
+}
+
+// SetCatchUp sets how late a missed run may still be made up. Runs missed
+// by more are skipped.
+func (s *Scheduler) SetCatchUp(d time.Duration) {
+	s.catchUp = d
+}
+
+// RunDue runs every job that is due, once each however many runs were
+// missed, and returns how many ran. It is what one-shot runs from system
+// cron call.
+func (s *Scheduler) RunDue() (int, error) {
+	jobs, err := s.store.Jobs()
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for _, job := range jobs {
+		ok, err := s.runJob(job)
+		if err != nil {
+			log.Printf("Job %s failed: %v", job.ID, err)
+		}
+		if ok {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+// Run runs jobs as they come due until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if _, err := s.RunDue(); err != nil {
+			log.Printf("Scheduler error: %v", err)
+		}
+
+		wait := pollInterval
+		if next, ok := s.nextDue(); ok {
+			if d := next.Sub(s.clock.Now()); d < wait {
+				wait = d
+			}
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+// Next returns when a job will next run, jitter included
+func (s *Scheduler) Next(job Job) (time.Time, error) {
+	cron, err := Parse(job.Spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	last, err := s.store.lastRun(job)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	at := cron.Next(last)
+	if at.IsZero() {
+		return at, fmt.Errorf("schedule %q never fires", job.Spec)
+	}
+	return at.Add(s.delay(job, at)), nil
+}
+
+// nextDue returns the earliest time any job runs
+func (s *Scheduler) nextDue() (time.Time, bool) {
+	jobs, err := s.store.Jobs()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var earliest time.Time
+	for _, job := range jobs {
+		next, err := s.Next(job)
+		if err != nil {
+			continue
+		}
+		if earliest.IsZero() || next.Before(earliest) {
+			earliest = next
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// runJob runs the job if it is due, holding its lock so no other process
+// runs it at the same time
+func (s *Scheduler) runJob(job Job) (bool, error) {
+	if next, err := s.Next(job); err != nil || s.clock.Now().Before(next) {
+		return false, err
+	}
+
+	if err := os.MkdirAll(s.store.stateDir(), 0o700); err != nil {
+		return false, fmt.Errorf("unable to create job state: %w", err)
+	}
+	unlock, err := lock(s.store.lockPath(job.ID), s.clock.Now())
+	if err == ErrLocked {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// Another process may have run it while we waited for the lock
+	cron, err := Parse(job.Spec)
+	if err != nil {
+		return false, err
+	}
+	last, err := s.store.lastRun(job)
+	if err != nil {
+		return false, err
+	}
+	now := s.clock.Now()
+	at := cron.Next(last)
+	if at.IsZero() || now.Before(at.Add(s.delay(job, at))) {
+		return false, nil
+	}
+
+	// Missed runs are made up by one run for the latest of them
+	missed := 0
+	for next := at; !next.IsZero() && !next.After(now); next = cron.Next(next) {
+		at = next
+		missed++
+	}
+	if err := s.store.setLastRun(job.ID, at); err != nil {
+		return false, err
+	}
+
+	if now.Sub(at) > s.catchUp {
+		log.Printf("Job %s: skipped %d missed runs, the latest at %s", job.ID, missed, at.Format("2006-01-02 15:04"))
+		return false, nil
+	}
+	if missed > 1 {
+		log.Printf("Job %s: catching up on %d missed runs", job.ID, missed)
+	}
+
+	output, err := s.run(job)
+	if err != nil {
+		return true, err
+	}
+	return true, deliver(job, at, output)
+}
+
+// delay is the job's jitter for the run at t: up to the scheduler's jitter,
+// and the same every time it is computed
+func (s *Scheduler) delay(job Job, t time.Time) time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s@%d", job.ID, t.Unix())
+	return time.Duration(h.Sum64() % uint64(s.jitter))
+}
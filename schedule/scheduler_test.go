@@ -0,0 +1,149 @@
+package schedule
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScheduler runs jobs from a store in a temporary directory on a fake
+// clock, counting the runs and delivering to a file
+type testScheduler struct {
+	*Scheduler
+	store  *Store
+	clock  *FakeClock
+	digest string
+	runs   int
+}
+
+func newTestScheduler(t *testing.T, spec string) (*testScheduler, Job) {
+	t.Helper()
+	dir := t.TempDir()
+	ts := &testScheduler{
+		store:  Open(filepath.Join(dir, "schedule.json")),
+		clock:  NewFakeClock(time.Date(2025, 3, 10, 7, 0, 0, 0, time.UTC)),
+		digest: filepath.Join(dir, "digest.md"),
+	}
+	ts.Scheduler = New(ts.store, func(job Job) (string, error) {
+		ts.runs++
+		return "done", nil
+	})
+	ts.SetClock(ts.clock)
+
+	job, err := ts.store.Add(Job{Spec: spec, Query: "jobs", Notify: "file:" + ts.digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, job
+}
+
+// runDue runs the due jobs and checks how many ran
+func (ts *testScheduler) runDue(t *testing.T, want int) {
+	t.Helper()
+	ran, err := ts.RunDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran != want {
+		t.Errorf("at %s %d jobs ran, want %d", ts.clock.Now().Format("Jan 2 15:04"), ran, want)
+	}
+}
+
+func TestAddStampsWithClock(t *testing.T) {
+	ts, job := newTestScheduler(t, "every day at 08:00 tz:UTC")
+	if !job.Created.Equal(ts.clock.Now()) {
+		t.Errorf("created at %v, want the clock's %v", job.Created, ts.clock.Now())
+	}
+}
+
+func TestCatchUpRunsOnce(t *testing.T) {
+	ts, _ := newTestScheduler(t, "every day at 08:00 tz:UTC")
+	ts.runDue(t, 0)
+
+	// Runs on the 10th to the 13th were missed; only the latest is made up
+	ts.clock.Advance(3*24*time.Hour + 2*time.Hour)
+	ts.runDue(t, 1)
+	ts.runDue(t, 0)
+	if ts.runs != 1 {
+		t.Errorf("ran %d times, want once", ts.runs)
+	}
+
+	b, err := os.ReadFile(ts.digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "2025-03-13 08:00") {
+		t.Errorf("digest %q isn't for the latest missed run", b)
+	}
+}
+
+func TestCatchUpSkipsLateRuns(t *testing.T) {
+	ts, _ := newTestScheduler(t, "every day at 08:00 tz:UTC")
+	ts.SetCatchUp(time.Hour)
+
+	// Two hours late is beyond catching up
+	ts.clock.Advance(3*24*time.Hour + 3*time.Hour)
+	ts.runDue(t, 0)
+	if ts.runs != 0 {
+		t.Errorf("ran %d times, want the late run skipped", ts.runs)
+	}
+
+	// The skipped runs aren't made up later either
+	ts.clock.Advance(22*time.Hour + 30*time.Minute)
+	ts.runDue(t, 1)
+}
+
+func TestJitterIsDeterministic(t *testing.T) {
+	ts, job := newTestScheduler(t, "every day at 08:00 tz:UTC")
+	ts.SetJitter(time.Hour)
+
+	next, err := ts.Next(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ts.Next(job)
+	other := New(ts.store, nil)
+	other.SetJitter(time.Hour)
+	fromOther, _ := other.Next(job)
+	if !next.Equal(again) || !next.Equal(fromOther) {
+		t.Errorf("Next gave %v, %v and %v, want one time", next, again, fromOther)
+	}
+
+	due := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	if next.Before(due) || !next.Before(due.Add(time.Hour)) {
+		t.Fatalf("next run at %v, want within an hour after %v", next, due)
+	}
+
+	ts.clock.Advance(next.Sub(ts.clock.Now()) - time.Second)
+	ts.runDue(t, 0)
+	ts.clock.Advance(time.Second)
+	ts.runDue(t, 1)
+}
+
+func TestLockUsesClock(t *testing.T) {
+	ts, job := newTestScheduler(t, "every day at 08:00 tz:UTC")
+	ts.clock.Advance(2 * time.Hour)
+
+	// Another process took the lock an hour ago, by the scheduler's clock
+	if err := os.MkdirAll(ts.store.stateDir(), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	path := ts.store.lockPath(job.ID)
+	if err := os.WriteFile(path, []byte("1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	taken := ts.clock.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, taken, taken); err != nil {
+		t.Fatal(err)
+	}
+	ts.runDue(t, 0)
+
+	// Past staleLock its holder is assumed dead and the lock is broken
+	ts.clock.Advance(staleLock)
+	ts.runDue(t, 1)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock left behind after the run: %v", err)
+	}
+}
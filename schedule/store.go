@@ -0,0 +1,201 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job runs a command on a schedule
+type Job struct {
+	ID      string    `json:"id"`
+	Spec    string    `json:"spec"`             // When to run, see Parse
+	Query   string    `json:"query"`            // Command to run, usually a saved search
+	Notify  string    `json:"notify,omitempty"` // Where results go: stdout or file:path
+	Created time.Time `json:"created"`
+}
+
+// String describes the job the way it is scheduled
+func (j Job) String() string {
+	spec := j.Spec
+	if !strings.HasPrefix(spec, "every ") {
+		spec = `cron "` + spec + `"`
+	}
+	s := spec + " run " + j.Query
+	if strings.ContainsAny(j.Notify, " \t") {
+		s += ` notify "` + j.Notify + `"`
+	} else if j.Notify != "" {
+		s += " notify " + j.Notify
+	}
+	return s
+}
+
+// Store keeps jobs in a JSON file. Each job's last run is kept in its own
+// file next to it, so processes running different jobs don't collide.
+type Store struct {
+	path  string
+	clock Clock
+}
+
+// jobState is what a job remembers between runs
+type jobState struct {
+	LastRun time.Time `json:"last_run"`
+}
+
+// DefaultPath is where jobs are kept unless told otherwise
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "intent", "schedule.json"), nil
+}
+
+// Open returns the store at path; it is created by the first Add
+func Open(path string) *Store {
+	return &Store{path: path, clock: SystemClock{}}
+}
+
+// SetClock sets the clock that stamps when jobs are created
+func (s *Store) SetClock(c Clock) {
+	s.clock = c
+}
+
+// Jobs returns every job, in the order they were added
+func (s *Store) Jobs() ([]Job, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schedule: %w", err)
+	}
+
+	var jobs []Job
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return nil, fmt.Errorf("corrupt schedule: %w", err)
+	}
+	return jobs, nil
+}
+
+// Add checks and stores a new job, assigning its ID
+func (s *Store) Add(job Job) (Job, error) {
+	if _, err := Parse(job.Spec); err != nil {
+		return job, err
+	}
+	if err := checkTarget(job.Notify); err != nil {
+		return job, err
+	}
+
+	jobs, err := s.Jobs()
+	if err != nil {
+		return job, err
+	}
+
+	last := 0
+	for _, j := range jobs {
+		if n, _ := strconv.Atoi(j.ID); n > last {
+			last = n
+		}
+	}
+	job.ID = strconv.Itoa(last + 1)
+	if job.Created.IsZero() {
+		job.Created = s.clock.Now()
+	}
+
+	return job, s.write(append(jobs, job))
+}
+
+// Remove deletes a job and its state
+func (s *Store) Remove(id string) error {
+	jobs, err := s.Jobs()
+	if err != nil {
+		return err
+	}
+
+	for i, j := range jobs {
+		if j.ID == id {
+			os.Remove(s.statePath(id))
+			return s.write(append(jobs[:i], jobs[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no job %s", id)
+}
+
+// write replaces the jobs file atomically
+func (s *Store) write(jobs []Job) error {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, _ := strconv.Atoi(jobs[i].ID)
+		b, _ := strconv.Atoi(jobs[j].ID)
+		return a < b
+	})
+	b, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("unable to write schedule: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write schedule: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write schedule: %w", err)
+	}
+	return nil
+}
+
+// stateDir holds each job's state and lock files
+func (s *Store) stateDir() string {
+	return strings.TrimSuffix(s.path, filepath.Ext(s.path)) + ".d"
+}
+
+func (s *Store) statePath(id string) string {
+	return filepath.Join(s.stateDir(), id+".json")
+}
+
+func (s *Store) lockPath(id string) string {
+	return filepath.Join(s.stateDir(), id+".lock")
+}
+
+// lastRun returns the scheduled time of the job's last run, or when it
+// was created if it never ran
+func (s *Store) lastRun(job Job) (time.Time, error) {
+	b, err := os.ReadFile(s.statePath(job.ID))
+	if os.IsNotExist(err) {
+		return job.Created, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read job state: %w", err)
+	}
+
+	var state jobState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return time.Time{}, fmt.Errorf("corrupt job state: %w", err)
+	}
+	return state.LastRun, nil
+}
+
+// setLastRun records the scheduled time of the job's latest run
+func (s *Store) setLastRun(id string, at time.Time) error {
+	b, err := json.Marshal(jobState{LastRun: at})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.statePath(id) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write job state: %w", err)
+	}
+	if err := os.Rename(tmp, s.statePath(id)); err != nil {
+		return fmt.Errorf("unable to write job state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package semantic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Cache stores message vectors on disk, keyed by model and Message-ID
+type Cache struct {
+	path  string
+	mu    sync.Mutex
+	dirty bool
+	// vectors maps model -> Message-ID -> vector
+	vectors map[string]map[string][]float32
+}
+
+// LoadCache reads the vector cache at path, starting empty if it doesn't
+// exist yet
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		vectors: make(map[string]map[string][]float32),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vector cache: %w", err)
+	}
+	if err := json.Unmarshal(b, &c.vectors); err != nil {
+		return nil, fmt.Errorf("corrupt vector cache: %w", err)
+	}
+
+	return c, nil
+}
+
+// Get returns the cached vector for a message. A nil cache or an empty ID
+// never hits.
+func (c *Cache) Get(model, id string) ([]float32, bool) {
+	if c == nil || id == "" {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.vectors[model][id]
+	return v, ok
+}
+
+// Put caches a message's vector
+func (c *Cache) Put(model, id string, v []float32) {
+	if c == nil || id == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.vectors[model] == nil {
+		c.vectors[model] = make(map[string][]float32)
+	}
+	c.vectors[model][id] = v
+	c.dirty = true
+}
+
+// Save writes the cache back to disk if anything changed
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	b, err := json.Marshal(c.vectors)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so a crash never leaves a half-written cache
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("unable to write vector cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("unable to write vector cache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
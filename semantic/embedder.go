@@ -0,0 +1,89 @@
+package semantic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close their meanings are
+type Embedder interface {
+	// Model names the vector space, so cached vectors are never mixed
+	// across embedders
+	Model() string
+	Embed(texts []string) ([][]float32, error)
+}
+
+// Doc is a message to rank
+type Doc struct {
+	ID   string // Message-ID, used as the cache key
+	Text string
+}
+
+// Scored is a ranked document
+type Scored struct {
+	Index int // Position in the docs passed to Rank
+	Score float32
+}
+
+// Rank orders docs by cosine similarity to query, most similar first.
+// Vectors for docs with an ID are read from and written to cache.
+func Rank(e Embedder, cache *Cache, query string, docs []Doc) ([]Scored, error) {
+	vectors := make([][]float32, len(docs))
+
+	var missing []int
+	var texts []string
+	for i, doc := range docs {
+		if v, ok := cache.Get(e.Model(), doc.ID); ok {
+			vectors[i] = v
+			continue
+		}
+		missing = append(missing, i)
+		texts = append(texts, doc.Text)
+	}
+
+	texts = append(texts, query)
+	embedded, err := e.Embed(texts)
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+	if len(embedded) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(texts))
+	}
+
+	for j, i := range missing {
+		vectors[i] = embedded[j]
+		cache.Put(e.Model(), docs[i].ID, embedded[j])
+	}
+	queryVector := embedded[len(embedded)-1]
+
+	scored := make([]Scored, len(docs))
+	for i, v := range vectors {
+		scored[i] = Scored{Index: i, Score: Cosine(queryVector, v)}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	return scored, nil
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 when their
+// sizes differ or either is zero
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,97 @@
+package semantic
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultDims is the vector size of the built-in embedder
+const DefaultDims = 512
+
+// HashEmbedder is a built-in local embedder. It hashes words, word pairs and
+// character trigrams into a fixed-size vector, so texts sharing vocabulary
+// (including inflections like "reject" / "rejected") land close together.
+type HashEmbedder struct {
+	Dims int
+}
+
+// NewHashEmbedder creates a local embedder with DefaultDims dimensions
+func NewHashEmbedder() *HashEmbedder {
+	return &HashEmbedder{Dims: DefaultDims}
+}
+
+// Model identifies the hashing scheme and size
+func (h *HashEmbedder) Model() string {
+	return fmt.Sprintf("hash-ngram-%d", h.Dims)
+}
+
+// Embed hashes every text into a unit vector
+func (h *HashEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = h.embed(text)
+	}
+	return vectors, nil
+}
+
+func (h *HashEmbedder) embed(text string) []float32 {
+	v := make([]float32, h.Dims)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		h.add(v, "w:"+word, 1)
+		if i+1 < len(words) {
+			h.add(v, "b:"+word+" "+words[i+1], 0.5)
+		}
+
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			h.add(v, "c:"+string(padded[j:j+3]), 0.3)
+		}
+	}
+
+	// Normalize, so long messages don't dominate short ones
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= scale
+		}
+	}
+
+	return v
+}
+
+// add hashes a feature into a bucket, with a hashed sign to cancel out
+// collisions on average
+func (h *HashEmbedder) add(v []float32, feature string, weight float32) {
+	f := fnv.New64a()
+	f.Write([]byte(feature))
+	sum := f.Sum64()
+
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	v[sum%uint64(len(v))] += weight
+}
+
+// stopWords carry no meaning for similarity
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "has": true, "have": true, "i": true, "in": true,
+	"is": true, "it": true, "of": true, "on": true, "or": true, "our": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "we": true, "will": true,
+	"with": true, "you": true, "your": true,
+}
@@ -0,0 +1,477 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+)
+
+// DefaultAddr keeps the API on the local machine
+const DefaultAddr = "127.0.0.1:7777"
+
+// OpenAPI is the API's OpenAPI 3 description
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// Server exposes the engine over HTTP. Every endpoint but the spec needs
+// the bearer token.
+type Server struct {
+	token   string
+	parser  *engine.Parser
+	session engine.SessionFunc
+
+	// The main session runs one request at a time; listeners get their own
+	mu       sync.Mutex
+	executor *engine.Executor
+	closer   func()
+}
+
+// New creates a server that accepts the given bearer token
+func New(token string, parser *engine.Parser, session engine.SessionFunc) *Server {
+	return &Server{
+		token:   token,
+		parser:  parser,
+		session: session,
+	}
+}
+
+// Message is a message as the API returns it
+type Message struct {
+	UID       uint32    `json:"uid,omitempty"`
+	Mailbox   string    `json:"mailbox,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	ThreadID  string    `json:"thread_id,omitempty"` // Server's conversation ID, when it has one
+	From      string    `json:"from"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+	Flags     []string  `json:"flags,omitempty"`
+	Body      string    `json:"body,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment describes a file attached to a message
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// QueryRequest carries a command, as query text or as an intent
+type QueryRequest struct {
+	Query   string         `json:"query,omitempty"`
+	Intent  *engine.Intent `json:"intent,omitempty"`
+	Confirm bool           `json:"confirm,omitempty"` // Allow actions above the confirmation threshold
+}
+
+// ParseResponse is a parsed command
+type ParseResponse struct {
+	Intent    *engine.Intent `json:"intent"`
+	Canonical string         `json:"canonical"`
+}
+
+// SearchResponse lists the page of messages a search matched
+type SearchResponse struct {
+	Query    string    `json:"query"`
+	Count    int       `json:"count"` // Matches on every page
+	Page     int       `json:"page"`  // 1-based page of Messages
+	Messages []Message `json:"messages"`
+}
+
+// NewSearchResponse describes the page of result that a search for intent
+// returned
+func NewSearchResponse(intent *engine.Intent, result *engine.Result) SearchResponse {
+	return SearchResponse{
+		Query:    intent.String(),
+		Count:    result.Count,
+		Page:     max(intent.Page, 1),
+		Messages: NewMessages(result.Messages),
+	}
+}
+
+// ActionResponse describes an applied action
+type ActionResponse struct {
+	Query     string    `json:"query"`
+	Count     int       `json:"count"`
+	DryRun    bool      `json:"dry_run,omitempty"`
+	JournalID string    `json:"journal_id,omitempty"`
+	Messages  []Message `json:"messages"`
+}
+
+// ErrorResponse is returned with every error status. Parse errors carry
+// their position and suggestions.
+type ErrorResponse struct {
+	Error      string             `json:"error"`
+	ParseError *engine.ParseError `json:"parse_error,omitempty"`
+}
+
+// Handler returns the API's routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	mux.Handle("POST /parse", s.auth(s.handleParse))
+	mux.Handle("POST /search", s.auth(s.handleSearch))
+	mux.Handle("GET /messages/{uid}", s.auth(s.handleMessage))
+	mux.Handle("POST /actions", s.auth(s.handleAction))
+	mux.Handle("GET /listen", s.auth(s.handleListen))
+	return mux
+}
+
+// ListenAndServe serves on addr until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done. Requests see ctx, so event streams
+// end with it rather than holding up the shutdown
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:     s.Handler(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	err := srv.Serve(ln)
+	s.mu.Lock()
+	if s.closer != nil {
+		s.closer()
+	}
+	s.mu.Unlock()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// auth rejects requests without the bearer token
+func (s *Server) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="intent"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong bearer token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPI)
+}
+
+// handleParse parses a query without running it
+func (s *Server) handleParse(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	intent, err := s.parse(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ParseResponse{Intent: intent, Canonical: intent.String()})
+}
+
+// handleSearch runs a search and returns the matched messages
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	intent, err := s.parse(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if intent.Command != engine.CommandSearch {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not a search, use /actions", intent.Command))
+		return
+	}
+
+	var result *engine.Result
+	err = s.withExecutor(func(e *engine.Executor) error {
+		if err := e.Validate(intent); err != nil {
+			return badRequest{err}
+		}
+		result, err = e.Execute(intent)
+		return err
+	})
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewSearchResponse(intent, result))
+}
+
+// handleMessage returns one message with its body
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(r.PathValue("uid"), 10, 32)
+	if err != nil || uid == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid UID %q", r.PathValue("uid")))
+		return
+	}
+	mailbox := r.URL.Query().Get("mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	var msg *engine.Email
+	err = s.withExecutor(func(e *engine.Executor) error {
+		var err error
+		msg, err = e.Message(mailbox, uint32(uid))
+		return err
+	})
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	m := NewMessage(*msg)
+	m.Body = msg.Body
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleAction applies an action such as archive or label
+func (s *Server) handleAction(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	intent, err := s.parse(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !intent.Command.IsAction() && intent.Command != engine.CommandUndo {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not an action", intent.Command))
+		return
+	}
+
+	resp := ActionResponse{Query: intent.String(), DryRun: intent.DryRun}
+	err = s.withExecutor(func(e *engine.Executor) error {
+		if err := e.Validate(intent); err != nil {
+			return badRequest{err}
+		}
+
+		// Large actions need the client to say it means it
+		var refused string
+		e.SetConfirm(func(prompt string) bool {
+			if !req.Confirm {
+				refused = prompt
+			}
+			return req.Confirm
+		}, engine.DefaultConfirmThreshold)
+		result, err := e.Execute(intent)
+		if err != nil {
+			return err
+		}
+		if refused != "" {
+			return needsConfirm{fmt.Errorf("%s: send confirm to go ahead", strings.TrimSpace(refused))}
+		}
+
+		resp.Count, resp.JournalID = result.Count, result.JournalID
+		resp.Messages = NewMessages(result.Messages)
+		return nil
+	})
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleListen streams the messages a listener matches as Server-Sent
+// Events, until the client goes away
+func (s *Server) handleListen(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(query)), "listen") {
+		query = "listen " + query
+	}
+	intent, err := s.parse(QueryRequest{Query: query})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if intent.Command != engine.CommandListen {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not a listen command", intent.Command))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	// Each stream watches on its own connection
+	e, closer, err := s.session()
+	if err != nil {
+		writeError(w, statusOf(badGateway{err}), err)
+		return
+	}
+	defer closer()
+	if err := e.Validate(intent); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var mu sync.Mutex
+	send := func(event string, v interface{}) {
+		b, _ := json.Marshal(v)
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		flusher.Flush()
+	}
+	e.SetListenHook(func(msg engine.Email) {
+		send("message", NewMessage(msg))
+	})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send("listening", map[string]string{"query": intent.String()})
+
+	if err := e.Listen(r.Context(), intent); err != nil {
+		send("error", ErrorResponse{Error: err.Error()})
+	}
+}
+
+// parse turns a request into an intent, from its query or its intent
+func (s *Server) parse(req QueryRequest) (*engine.Intent, error) {
+	if req.Intent != nil {
+		// Round-trip through the grammar, so intents get the same checks
+		return s.parser.Parse(req.Intent.String())
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("query or intent is required")
+	}
+	return s.parser.Parse(req.Query)
+}
+
+// withExecutor runs fn on the main session, signing in on first use
+func (s *Server) withExecutor(fn func(e *engine.Executor) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.executor == nil {
+		e, closer, err := s.session()
+		if err != nil {
+			return badGateway{err}
+		}
+		s.executor, s.closer = e, closer
+	}
+	return fn(s.executor)
+}
+
+// badRequest marks errors caused by the request rather than the server
+type badRequest struct {
+	error
+}
+
+// needsConfirm marks actions refused for want of the confirm flag
+type needsConfirm struct {
+	error
+}
+
+// badGateway marks failures to reach the mail server
+type badGateway struct {
+	error
+}
+
+func statusOf(err error) int {
+	var (
+		bad     badRequest
+		confirm needsConfirm
+		gateway badGateway
+	)
+	switch {
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	case errors.As(err, &confirm):
+		return http.StatusConflict
+	case errors.Is(err, engine.ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &gateway):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// NewMessage converts an executor result to its API form, without the body
+func NewMessage(m engine.Email) Message {
+	msg := Message{
+		UID:       m.UID,
+		Mailbox:   m.Mailbox,
+		MessageID: m.MessageID,
+		ThreadID:  m.ThreadID,
+		From:      m.From,
+		Subject:   m.Subject,
+		Date:      m.Date,
+		Flags:     m.Flags,
+	}
+	for _, a := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, Attachment{Filename: a.Filename, ContentType: a.ContentType, Size: a.Size})
+	}
+	return msg
+}
+
+// NewMessages converts a list of results
+func NewMessages(found []engine.Email) []Message {
+	list := make([]Message, 0, len(found))
+	for _, m := range found {
+		list = append(list, NewMessage(m))
+	}
+	return list
+}
+
+// readJSON decodes the request body, answering 400 when it can't
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API response error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	resp := ErrorResponse{Error: err.Error()}
+	errors.As(err, &resp.ParseError)
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	engine "github.com/PlantingTrees/intent/intentEngine"
+)
+
+const testToken = "secret"
+
+// newTestServer serves the API on an in-memory store, with every session
+// sharing it
+func newTestServer(t *testing.T) (*httptest.Server, *engine.MemoryBackend) {
+	t.Helper()
+	store := engine.NewMemoryBackend("INBOX")
+	session := store.Session(engine.NewJournal(filepath.Join(t.TempDir(), "journal.jsonl"), "me@example.com"))
+	srv := httptest.NewServer(New(testToken, engine.NewParser(), session).Handler())
+	t.Cleanup(srv.Close)
+	return srv, store
+}
+
+// post sends body as JSON and decodes the reply into v, returning the status
+func post(t *testing.T, srv *httptest.Server, path string, body, v interface{}) int {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", srv.URL+path, bytes.NewReader(b))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("POST %s: decoding reply: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest("POST", srv.URL+"/parse", strings.NewReader(`{"query":"search"}`))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", header, resp.StatusCode)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	srv, _ := newTestServer(t)
+	var resp ErrorResponse
+	if status := post(t, srv, "/parse", QueryRequest{Query: "serch from boss"}, &resp); status != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", status)
+	}
+	if resp.ParseError == nil || resp.Error == "" {
+		t.Errorf("reply %+v, want a parse error", resp)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv, store := newTestServer(t)
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Interview", Date: time.Now().Add(-time.Hour)})
+	store.Add("INBOX", engine.Email{From: "news@other.com", Subject: "Weekly", Date: time.Now()})
+
+	var resp SearchResponse
+	if status := post(t, srv, "/search", QueryRequest{Query: `search from "acme.com"`}, &resp); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if resp.Count != 1 || len(resp.Messages) != 1 || resp.Messages[0].Subject != "Interview" {
+		t.Errorf("reply %+v, want the interview", resp)
+	}
+
+	var bad ErrorResponse
+	if status := post(t, srv, "/search", QueryRequest{Query: `star from "acme.com"`}, &bad); status != http.StatusBadRequest {
+		t.Errorf("action sent to /search: status %d, want 400", status)
+	}
+}
+
+func TestMessageNotFound(t *testing.T) {
+	srv, _ := newTestServer(t)
+	req, _ := http.NewRequest("GET", srv.URL+"/messages/42", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestActionConfirm(t *testing.T) {
+	srv, store := newTestServer(t)
+	for i := 0; i <= engine.DefaultConfirmThreshold; i++ {
+		store.Add("INBOX", engine.Email{From: "bulk@spam.com", Subject: fmt.Sprint(i), Date: time.Now()})
+	}
+	flagged := func() int {
+		n := 0
+		for _, msg := range store.Messages("INBOX") {
+			if slices.Contains(msg.Flags, "\\Flagged") {
+				n++
+			}
+		}
+		return n
+	}
+
+	var refused ErrorResponse
+	if status := post(t, srv, "/actions", QueryRequest{Query: `star from "spam.com"`}, &refused); status != http.StatusConflict {
+		t.Fatalf("without confirm: status %d, want 409", status)
+	}
+	if n := flagged(); n != 0 {
+		t.Fatalf("%d messages starred without confirm", n)
+	}
+
+	var resp ActionResponse
+	if status := post(t, srv, "/actions", QueryRequest{Query: `star from "spam.com"`, Confirm: true}, &resp); status != http.StatusOK {
+		t.Fatalf("with confirm: status %d", status)
+	}
+	want := engine.DefaultConfirmThreshold + 1
+	if resp.Count != want || len(resp.Messages) != want || resp.JournalID == "" {
+		t.Errorf("reply count %d, %d messages, journal %q", resp.Count, len(resp.Messages), resp.JournalID)
+	}
+	if n := flagged(); n != want {
+		t.Errorf("%d messages starred, want %d", n, want)
+	}
+}
+
+func TestListenStream(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/listen?query="+url.QueryEscape(`from "acme.com"`), nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, ct)
+	}
+
+	// Wait for the listener to start before anything arrives
+	for !store.Watching() {
+		time.Sleep(time.Millisecond)
+	}
+	store.Add("INBOX", engine.Email{From: "news@other.com", Subject: "Weekly", Date: time.Now()})
+	store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: "Offer", Date: time.Now()})
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if event, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, event)
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || events[len(events)-1] != "message" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != "Offer" {
+			t.Errorf("streamed %+v, want only offers", msg)
+		}
+		break
+	}
+	if len(events) == 0 || events[0] != "listening" || events[len(events)-1] != "message" {
+		t.Errorf("events %q, want listening then message (%v)", events, scanner.Err())
+	}
+}
+
+func TestSearchCountsEveryPage(t *testing.T) {
+	srv, store := newTestServer(t)
+	for i := range 3 {
+		store.Add("INBOX", engine.Email{From: "hr@acme.com", Subject: fmt.Sprintf("Round %d", i+1), Date: time.Now().Add(time.Duration(i-3) * time.Hour)})
+	}
+
+	var resp SearchResponse
+	if status := post(t, srv, "/search", QueryRequest{Query: `search from "acme.com" limit 2 page 2`}, &resp); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if resp.Count != 3 || resp.Page != 2 || len(resp.Messages) != 1 || resp.Messages[0].Subject != "Round 1" {
+		t.Errorf("reply %+v, want the last of 3 on page 2", resp)
+	}
+}
+
+func TestShutdownEndsStreams(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := engine.NewMemoryBackend("INBOX").Session(nil)
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- New(testToken, engine.NewParser(), session).Serve(ctx, ln) }()
+
+	// Shutdown gives up after 5 seconds, so a stream still open after 3 was
+	// never told to stop
+	wait, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(wait, "GET", "http://"+ln.Addr().String()+"/listen?query="+url.QueryEscape(`from "acme.com"`), nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	stop()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Errorf("stream still open after shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}